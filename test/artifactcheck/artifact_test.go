@@ -0,0 +1,55 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+// The test of artifact_test in defs.bzl: checks the BINARY against the zig
+// target triple TARGET, that linux binaries need no newer glibc and no
+// libraries but the ones of their libc and the comma-separated NEEDED, and
+// that macOS binaries need no macOS newer than MIN_OS and that dylibs have
+// the INSTALL_NAME.
+package artifactcheck_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/runfiles"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/hermetic_cc_toolchain/test/artifactcheck"
+)
+
+func TestArtifact(t *testing.T) {
+	if os.Getenv("BINARY") == "" {
+		t.Skip("BINARY is not set; run it with artifact_test of defs.bzl")
+	}
+
+	target, err := artifactcheck.ParseTarget(os.Getenv("TARGET"))
+	require.NoError(t, err)
+	binary, err := runfiles.Rlocation(os.Getenv("BINARY"))
+	require.NoError(t, err, "locate binary")
+	assert.NoError(t, artifactcheck.Check(binary, target))
+
+	if target.OS == "linux" {
+		needs, err := artifactcheck.CheckGlibc(binary, target)
+		assert.NoError(t, err)
+		t.Logf("needs glibc %s, libstdc++ %s", needs.Glibc, needs.Glibcxx)
+
+		var needed []string
+		if env := os.Getenv("NEEDED"); env != "" {
+			needed = strings.Split(env, ",")
+		}
+		deps, err := artifactcheck.CheckDeps(binary, target, needed...)
+		assert.NoError(t, err)
+		t.Logf("dependencies: %s", deps)
+	}
+
+	if target.OS == "macos" {
+		m, err := artifactcheck.CheckMachO(binary, target, artifactcheck.MachOContract{
+			MinOS:       os.Getenv("MIN_OS"),
+			InstallName: os.Getenv("INSTALL_NAME"),
+		})
+		assert.NoError(t, err)
+		t.Logf("needs macOS %s, install name %q, header padding %d bytes", m.MinOS, m.InstallName, m.HeaderPad)
+	}
+}
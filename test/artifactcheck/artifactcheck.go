@@ -0,0 +1,122 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+// Package artifactcheck checks binaries built by the zig toolchain against
+// their zig target triple, without running them. It reads ELF, Mach-O, PE
+// and WebAssembly files, so every target can be checked on any host.
+package artifactcheck
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Format is an object file format.
+type Format string
+
+// Object file formats.
+const (
+	FormatELF   Format = "ELF"
+	FormatMachO Format = "Mach-O"
+	FormatPE    Format = "PE"
+	FormatWasm  Format = "WebAssembly"
+)
+
+// Kind is what an artifact is for.
+type Kind string
+
+// Kinds of artifacts.
+const (
+	KindExecutable    Kind = "executable"
+	KindSharedLibrary Kind = "shared library"
+)
+
+// Artifact is what Inspect reads from a binary.
+type Artifact struct {
+	Format Format
+	Kind   Kind
+	// Arch is the zig name of the architecture, e.g. x86_64.
+	Arch string
+	// OS is the zig name of the OS that the binary says it is for, e.g.
+	// linux. ELF binaries of the System V ABI are for linux, and Wasm
+	// modules that import WASI are for wasi.
+	OS string
+	// PIE is whether an executable is position independent: ET_DYN for
+	// ELF, MH_PIE for Mach-O and /DYNAMICBASE for PE.
+	PIE bool
+	// Interp is the dynamic linker of an executable: PT_INTERP for ELF
+	// and LC_LOAD_DYLINKER for Mach-O.
+	Interp string
+}
+
+// Inspect reads the artifact at path.
+func Inspect(path string) (Artifact, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Artifact{}, err
+	}
+	defer f.Close()
+
+	var magic [4]byte
+	if _, err := io.ReadFull(f, magic[:]); err != nil {
+		return Artifact{}, fmt.Errorf("%s: read magic: %w", path, err)
+	}
+	var a Artifact
+	switch {
+	case bytes.Equal(magic[:], []byte("\x7fELF")):
+		a, err = inspectELF(f)
+	case isMachO(magic):
+		a, err = inspectMachO(f)
+	case bytes.Equal(magic[:2], []byte("MZ")):
+		a, err = inspectPE(f)
+	case bytes.Equal(magic[:], []byte("\x00asm")):
+		a, err = inspectWasm(f)
+	default:
+		err = fmt.Errorf("unknown magic %x", magic)
+	}
+	if err != nil {
+		return Artifact{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return a, nil
+}
+
+// Check checks that the artifact at path is built for target.
+func Check(path string, target Target) error {
+	a, err := Inspect(path)
+	if err != nil {
+		return err
+	}
+	if err := a.Check(target); err != nil {
+		return fmt.Errorf("%s is not a %s %s: %w", path, target, a.Kind, err)
+	}
+	return nil
+}
+
+// Check checks that a is built for target. The PIE-ness and interpreter
+// are only checked for executables, and the PIE-ness only where the target
+// forces it.
+func (a Artifact) Check(target Target) error {
+	var errs []error
+	if want := target.Format(); a.Format != want {
+		// Nothing else is comparable.
+		return fmt.Errorf("format is %s, want %s", a.Format, want)
+	}
+	if a.Arch != target.Arch {
+		errs = append(errs, fmt.Errorf("arch is %s, want %s", a.Arch, target.Arch))
+	}
+	if a.OS != target.OS {
+		errs = append(errs, fmt.Errorf("os is %s, want %s", a.OS, target.OS))
+	}
+	if a.Kind == KindExecutable {
+		if target.PIE() && !a.PIE {
+			errs = append(errs, errors.New("pie is false, want true"))
+		}
+		if want := target.Interp(); a.Interp != want {
+			errs = append(errs, fmt.Errorf("interpreter is %q, want %q", a.Interp, want))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,309 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+package artifactcheck
+
+import (
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/hermetic_cc_toolchain/test/artifactcheck/testbin"
+)
+
+const _glibcInterp = "/lib64/ld-linux-x86-64.so.2"
+
+func TestInspect(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    Artifact
+		wantErr string
+	}{
+		{
+			name: "linux gnu",
+			data: testbin.ELF{Machine: elf.EM_X86_64, Type: elf.ET_EXEC, Interp: _glibcInterp}.Bytes(),
+			want: Artifact{Format: FormatELF, Kind: KindExecutable, Arch: "x86_64", OS: "linux", Interp: _glibcInterp},
+		},
+		{
+			name: "linux gnu pie",
+			data: testbin.ELF{Machine: elf.EM_X86_64, Type: elf.ET_DYN, Interp: _glibcInterp}.Bytes(),
+			want: Artifact{Format: FormatELF, Kind: KindExecutable, Arch: "x86_64", OS: "linux", PIE: true, Interp: _glibcInterp},
+		},
+		{
+			name: "linux musl static",
+			data: testbin.ELF{Machine: elf.EM_AARCH64, OSABI: elf.ELFOSABI_LINUX, Type: elf.ET_EXEC}.Bytes(),
+			want: Artifact{Format: FormatELF, Kind: KindExecutable, Arch: "aarch64", OS: "linux"},
+		},
+		{
+			name: "linux musl static pie",
+			data: testbin.ELF{
+				Machine: elf.EM_X86_64,
+				Type:    elf.ET_DYN,
+				Dynamic: []testbin.Dyn{{Tag: elf.DT_FLAGS_1, Val: uint64(elf.DF_1_PIE | elf.DF_1_NOW)}},
+			}.Bytes(),
+			want: Artifact{Format: FormatELF, Kind: KindExecutable, Arch: "x86_64", OS: "linux", PIE: true},
+		},
+		{
+			name: "linux shared library",
+			data: testbin.ELF{
+				Machine: elf.EM_X86_64,
+				Type:    elf.ET_DYN,
+				Dynamic: []testbin.Dyn{{Tag: elf.DT_SONAME, Str: "libadd.so"}, {Tag: elf.DT_FLAGS_1, Val: uint64(elf.DF_1_NOW)}},
+			}.Bytes(),
+			want: Artifact{Format: FormatELF, Kind: KindSharedLibrary, Arch: "x86_64", OS: "linux"},
+		},
+		{
+			name: "freebsd",
+			data: testbin.ELF{Machine: elf.EM_386, OSABI: elf.ELFOSABI_FREEBSD, Type: elf.ET_EXEC}.Bytes(),
+			want: Artifact{Format: FormatELF, Kind: KindExecutable, Arch: "EM_386", OS: "freebsd"},
+		},
+		{
+			name:    "object file",
+			data:    testbin.ELF{Machine: elf.EM_X86_64, Type: elf.ET_REL}.Bytes(),
+			wantErr: "unexpected ELF type ET_REL",
+		},
+		{
+			name: "macos",
+			data: testbin.MachO{
+				Cpu:      macho.CpuArm64,
+				Type:     macho.TypeExec,
+				Flags:    macho.FlagPIE | macho.FlagDyldLink,
+				Dylinker: "/usr/lib/dyld",
+				Platform: 1,
+			}.Bytes(),
+			want: Artifact{Format: FormatMachO, Kind: KindExecutable, Arch: "aarch64", OS: "macos", PIE: true, Interp: "/usr/lib/dyld"},
+		},
+		{
+			name: "macos dylib",
+			data: testbin.MachO{Cpu: macho.CpuAmd64, Type: macho.TypeDylib, VersionMin: true}.Bytes(),
+			want: Artifact{Format: FormatMachO, Kind: KindSharedLibrary, Arch: "x86_64", OS: "macos"},
+		},
+		{
+			name: "ios",
+			data: testbin.MachO{Cpu: macho.CpuArm64, Type: macho.TypeExec, Platform: 2}.Bytes(),
+			want: Artifact{Format: FormatMachO, Kind: KindExecutable, Arch: "aarch64", OS: "ios"},
+		},
+		{
+			name:    "macos object file",
+			data:    testbin.MachO{Cpu: macho.CpuArm64, Type: macho.TypeObj}.Bytes(),
+			wantErr: "unexpected Mach-O type Obj",
+		},
+		{
+			name: "windows",
+			data: testbin.PE{
+				Machine:            pe.IMAGE_FILE_MACHINE_AMD64,
+				Characteristics:    pe.IMAGE_FILE_EXECUTABLE_IMAGE | pe.IMAGE_FILE_LARGE_ADDRESS_AWARE,
+				DllCharacteristics: pe.IMAGE_DLLCHARACTERISTICS_DYNAMIC_BASE | pe.IMAGE_DLLCHARACTERISTICS_NX_COMPAT,
+			}.Bytes(),
+			want: Artifact{Format: FormatPE, Kind: KindExecutable, Arch: "x86_64", OS: "windows", PIE: true},
+		},
+		{
+			name: "windows dll",
+			data: testbin.PE{
+				Machine:         pe.IMAGE_FILE_MACHINE_ARM64,
+				Characteristics: pe.IMAGE_FILE_EXECUTABLE_IMAGE | pe.IMAGE_FILE_DLL,
+			}.Bytes(),
+			want: Artifact{Format: FormatPE, Kind: KindSharedLibrary, Arch: "aarch64", OS: "windows"},
+		},
+		{
+			name: "wasi",
+			data: testbin.Wasm("env", "wasi_snapshot_preview1"),
+			want: Artifact{Format: FormatWasm, Kind: KindExecutable, Arch: "wasm32", OS: "wasi"},
+		},
+		{
+			name: "wasm freestanding",
+			data: testbin.Wasm("env"),
+			want: Artifact{Format: FormatWasm, Kind: KindExecutable, Arch: "wasm32", OS: "freestanding"},
+		},
+		{
+			name:    "wasm version",
+			data:    []byte("\x00asm\x02\x00\x00\x00"),
+			wantErr: "unknown wasm version 2",
+		},
+		{
+			name:    "truncated wasm",
+			data:    testbin.Wasm("wasi_snapshot_preview1")[:30],
+			wantErr: "read wasm imports",
+		},
+		{
+			name:    "script",
+			data:    []byte("#!/bin/sh\n"),
+			wantErr: "unknown magic 23212f62",
+		},
+		{
+			name:    "empty",
+			data:    nil,
+			wantErr: "read magic: EOF",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := testbin.WriteFile(t, "artifact", tt.data)
+			got, err := Inspect(path)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, path+": ")
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// TestInspectSelf inspects the test binary, which the Go linker wrote.
+func TestInspectSelf(t *testing.T) {
+	var want Artifact
+	switch runtime.GOOS {
+	case "linux":
+		want.Format, want.OS = FormatELF, "linux"
+	case "darwin":
+		want.Format, want.OS = FormatMachO, "macos"
+	case "windows":
+		want.Format, want.OS = FormatPE, "windows"
+	default:
+		t.Skipf("no zig target for %s", runtime.GOOS)
+	}
+	switch runtime.GOARCH {
+	case "amd64":
+		want.Arch = "x86_64"
+	case "arm64":
+		want.Arch = "aarch64"
+	default:
+		t.Skipf("no zig target for %s", runtime.GOARCH)
+	}
+
+	self, err := os.Executable()
+	require.NoError(t, err)
+	got, err := Inspect(self)
+	require.NoError(t, err)
+	assert.Equal(t, want.Format, got.Format)
+	assert.Equal(t, want.Arch, got.Arch)
+	assert.Equal(t, want.OS, got.OS)
+	assert.Equal(t, KindExecutable, got.Kind)
+}
+
+func TestArtifactCheck(t *testing.T) {
+	glibc := Artifact{Format: FormatELF, Kind: KindExecutable, Arch: "x86_64", OS: "linux", Interp: _glibcInterp}
+	with := func(f func(a *Artifact)) Artifact {
+		a := glibc
+		f(&a)
+		return a
+	}
+
+	tests := []struct {
+		name     string
+		artifact Artifact
+		target   string
+		wantErr  []string
+	}{
+		{
+			name:     "ok",
+			artifact: glibc,
+			target:   "x86_64-linux-gnu.2.28",
+		},
+		{
+			name:     "musl",
+			artifact: with(func(a *Artifact) { a.Interp = "" }),
+			target:   "x86_64-linux-musl",
+		},
+		{
+			name:     "shared library",
+			artifact: with(func(a *Artifact) { a.Kind, a.Interp = KindSharedLibrary, "" }),
+			target:   "x86_64-linux-gnu.2.28",
+		},
+		{
+			name:     "format",
+			artifact: glibc,
+			target:   "x86_64-macos-none",
+			wantErr:  []string{"format is ELF, want Mach-O"},
+		},
+		{
+			name:     "arch",
+			artifact: glibc,
+			target:   "aarch64-linux-gnu.2.28",
+			wantErr: []string{
+				"arch is x86_64, want aarch64",
+				`interpreter is "/lib64/ld-linux-x86-64.so.2", want "/lib/ld-linux-aarch64.so.1"`,
+			},
+		},
+		{
+			name:     "os",
+			artifact: with(func(a *Artifact) { a.OS = "freebsd" }),
+			target:   "x86_64-linux-gnu.2.28",
+			wantErr:  []string{"os is freebsd, want linux"},
+		},
+		{
+			name:     "glibc instead of musl",
+			artifact: glibc,
+			target:   "x86_64-linux-musl",
+			wantErr:  []string{`interpreter is "/lib64/ld-linux-x86-64.so.2", want ""`},
+		},
+		{
+			// -pie is up to the build on linux.
+			name:     "linux pie",
+			artifact: with(func(a *Artifact) { a.PIE = true }),
+			target:   "x86_64-linux-gnu.2.28",
+		},
+		{
+			name: "macos not pie",
+			artifact: Artifact{
+				Format: FormatMachO,
+				Kind:   KindExecutable,
+				Arch:   "aarch64",
+				OS:     "macos",
+				Interp: "/usr/lib/dyld",
+			},
+			target:  "aarch64-macos-none",
+			wantErr: []string{"pie is false, want true"},
+		},
+		{
+			name:     "wasm",
+			artifact: Artifact{Format: FormatWasm, Kind: KindExecutable, Arch: "wasm32", OS: "freestanding"},
+			target:   "wasm32-wasi-musl",
+			wantErr:  []string{"os is freestanding, want wasi"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target, err := ParseTarget(tt.target)
+			require.NoError(t, err)
+			err = tt.artifact.Check(target)
+			if len(tt.wantErr) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			for _, want := range tt.wantErr {
+				assert.ErrorContains(t, err, want)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	path := testbin.WriteFile(t, "artifact", testbin.MachO{
+		Cpu:      macho.CpuArm64,
+		Type:     macho.TypeExec,
+		Flags:    macho.FlagPIE,
+		Dylinker: "/usr/lib/dyld",
+		Platform: 1,
+	}.Bytes())
+
+	arm64, err := ParseTarget("aarch64-macos-none")
+	require.NoError(t, err)
+	assert.NoError(t, Check(path, arm64))
+
+	amd64, err := ParseTarget("x86_64-macos-none")
+	require.NoError(t, err)
+	assert.EqualError(t, Check(path, amd64), path+" is not a x86_64-macos-none executable: arch is aarch64, want x86_64")
+
+	assert.ErrorIs(t, Check(path+".missing", arm64), os.ErrNotExist)
+}
@@ -0,0 +1,79 @@
+# Copyright 2023 Uber Technologies, Inc.
+# Licensed under the MIT License
+
+load("@rules_go//go:def.bzl", "go_test")
+
+def artifact_test(
+        name,
+        binary,
+        target,
+        needed = [],
+        min_os = "13.0",
+        install_name = "",
+        **kwargs):
+    """Checks a binary against its zig target triple without running it.
+
+    The format, architecture, OS and interpreter of binary must be the
+    ones of target, e.g. x86_64-linux-gnu.2.28, macOS and Windows
+    executables must be PIE (linux ones may be either), and a linux binary
+    may not need a glibc newer than the one of target (or any, for musl).
+    musl executables must be static, and glibc ones may only need the
+    libraries of glibc and needed. A macOS binary must be for every CPU of
+    its arch, run on min_os, and have the header padding to rewrite its
+    dylib paths; a dylib must have an install name. The test runs on any
+    host, whatever the target.
+
+    Args:
+        name: name of the go_test.
+        binary: the binary to check, e.g. a platform_binary.
+        target: the zig target triple that binary is built for.
+        needed: the other shared libraries that binary may need, e.g. the
+            ones of the same build.
+        min_os: the newest macOS that binary may need. The default is the
+            oldest macOS that zig supports.
+        install_name: the file name of the install name of a dylib, e.g.
+            libadd.dylib.
+        **kwargs: passed to go_test, e.g. tags.
+    """
+    go_test(
+        name = name,
+        data = [binary],
+        embed = [Label("//test/artifactcheck:artifact_test")],
+        env = {
+            "BINARY": "$(rlocationpath {})".format(binary),
+            "INSTALL_NAME": install_name,
+            "MIN_OS": min_os,
+            "NEEDED": ",".join(needed),
+            "TARGET": target,
+        },
+        **kwargs
+    )
+
+def shared_library_test(name, library, soname, exports, consumers = [], **kwargs):
+    """Checks the contract of an ELF shared library without running it.
+
+    library must have DT_SONAME soname and export exactly exports, besides
+    the symbols of the C runtime. Every consumer, a binary linked with
+    library, must need it by its soname rather than by its build path. The
+    runpaths of all of them must be relative to $ORIGIN.
+
+    Args:
+        name: name of the go_test.
+        library: the shared library to check, e.g. a platform_binary.
+        soname: the DT_SONAME of library, e.g. libadd.so.
+        exports: the symbols that library exports.
+        consumers: binaries linked with library.
+        **kwargs: passed to go_test, e.g. tags.
+    """
+    go_test(
+        name = name,
+        data = [library] + consumers,
+        embed = [Label("//test/artifactcheck:shared_library_test")],
+        env = {
+            "CONSUMERS": " ".join(["$(rlocationpath {})".format(c) for c in consumers]),
+            "EXPORTS": ",".join(exports),
+            "LIBRARY": "$(rlocationpath {})".format(library),
+            "SONAME": soname,
+        },
+        **kwargs
+    )
@@ -0,0 +1,117 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+package artifactcheck
+
+import (
+	"debug/elf"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// _glibcLibraries are the shared libraries of glibc itself, which a
+// linux-gnu binary may need. Anything else, e.g. libstdc++.so.6 or
+// libgcc_s.so.1, is not on every host and must be linked statically.
+var _glibcLibraries = map[string]bool{
+	"ld-linux-aarch64.so.1": true,
+	"ld-linux-x86-64.so.2":  true,
+	"libanl.so.1":           true,
+	"libc.so.6":             true,
+	"libdl.so.2":            true,
+	"libm.so.6":             true,
+	"libmvec.so.1":          true,
+	"libpthread.so.0":       true,
+	"libresolv.so.2":        true,
+	"librt.so.1":            true,
+	"libutil.so.1":          true,
+}
+
+// _muslLibrary is the libc of musl, which a musl shared library needs.
+const _muslLibrary = "libc.so"
+
+// Deps are the dynamic dependencies of an ELF file.
+type Deps struct {
+	Interp string   // PT_INTERP, or empty if the file has none
+	Needed []string // DT_NEEDED, in link order
+}
+
+// String returns the interpreter and libraries of d, or "static".
+func (d Deps) String() string {
+	var parts []string
+	if d.Interp != "" {
+		parts = append(parts, "interpreter "+d.Interp)
+	}
+	if len(d.Needed) > 0 {
+		parts = append(parts, "needs "+strings.Join(d.Needed, ", "))
+	}
+	if len(parts) == 0 {
+		return "static"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// ReadDeps reads the dynamic dependencies of the ELF file at path.
+func ReadDeps(path string) (Deps, error) {
+	f, err := elf.Open(path)
+	if err != nil {
+		return Deps{}, err
+	}
+	defer f.Close()
+
+	var d Deps
+	if d.Interp, err = elfInterp(f); err != nil {
+		return Deps{}, fmt.Errorf("%s: %w", path, err)
+	}
+	if d.Needed, err = f.ImportedLibraries(); err != nil {
+		return Deps{}, fmt.Errorf("%s: read DT_NEEDED: %w", path, err)
+	}
+	return d, nil
+}
+
+// CheckDeps checks that the ELF file at path needs only the libraries of
+// the libc of target. musl executables must be static, without an
+// interpreter or libraries; musl shared libraries may only need musl.
+// glibc binaries may only need the libraries of glibc. allowed are the
+// other libraries that the file may need, e.g. the ones of the same build.
+func CheckDeps(path string, target Target, allowed ...string) (Deps, error) {
+	if target.OS != "linux" {
+		return Deps{}, fmt.Errorf("%s is not a linux target", target)
+	}
+	a, err := Inspect(path)
+	if err != nil {
+		return Deps{}, err
+	}
+	d, err := ReadDeps(path)
+	if err != nil {
+		return Deps{}, err
+	}
+
+	libc := func(lib string) bool { return _glibcLibraries[lib] }
+	if target.ABI == "musl" {
+		if a.Kind == KindExecutable {
+			if len(d.Needed) > 0 || d.Interp != "" {
+				return d, fmt.Errorf("%s is not static: %s", path, d)
+			}
+			return d, nil
+		}
+		libc = func(lib string) bool { return lib == _muslLibrary }
+	}
+
+	var errs []error
+	for _, lib := range d.Needed {
+		if !libc(lib) && !slices.Contains(allowed, lib) {
+			errs = append(errs, fmt.Errorf("%s needs %s, which is not part of %s", path, lib, target.libc()))
+		}
+	}
+	return d, errors.Join(errs...)
+}
+
+// libc returns the name of the libc of a linux target.
+func (t Target) libc() string {
+	if t.ABI == "musl" {
+		return "musl"
+	}
+	return "glibc"
+}
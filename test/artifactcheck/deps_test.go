@@ -0,0 +1,157 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+package artifactcheck
+
+import (
+	"debug/elf"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/hermetic_cc_toolchain/test/artifactcheck/testbin"
+)
+
+func TestReadDeps(t *testing.T) {
+	path := testbin.WriteFile(t, "main", testbin.ELF{
+		Machine: elf.EM_X86_64,
+		Type:    elf.ET_EXEC,
+		Interp:  _glibcInterp,
+		Needed:  []string{"libm.so.6", "libc.so.6"},
+	}.Bytes())
+	got, err := ReadDeps(path)
+	require.NoError(t, err)
+	assert.Equal(t, Deps{Interp: _glibcInterp, Needed: []string{"libm.so.6", "libc.so.6"}}, got)
+	assert.Equal(t, "interpreter "+_glibcInterp+", needs libm.so.6, libc.so.6", got.String())
+
+	path = testbin.WriteFile(t, "main", testbin.ELF{Machine: elf.EM_X86_64, Type: elf.ET_EXEC}.Bytes())
+	got, err = ReadDeps(path)
+	require.NoError(t, err)
+	assert.Equal(t, Deps{}, got)
+	assert.Equal(t, "static", got.String())
+
+	path = testbin.WriteFile(t, "main", testbin.Wasm())
+	_, err = ReadDeps(path)
+	assert.ErrorContains(t, err, "bad magic number")
+}
+
+func TestCheckDeps(t *testing.T) {
+	write := func(name string, e testbin.ELF) string {
+		if e.Machine == 0 {
+			e.Machine = elf.EM_X86_64
+		}
+		return testbin.WriteFile(t, name, e.Bytes())
+	}
+	static := write("static", testbin.ELF{Type: elf.ET_EXEC})
+	staticPIE := write("static_pie", testbin.ELF{
+		Type:    elf.ET_DYN,
+		Dynamic: []testbin.Dyn{{Tag: elf.DT_FLAGS_1, Val: uint64(elf.DF_1_PIE)}},
+	})
+	glibc := write("glibc", testbin.ELF{
+		Type:   elf.ET_EXEC,
+		Interp: _glibcInterp,
+		Needed: []string{"libm.so.6", "libpthread.so.0", "libc.so.6", "ld-linux-x86-64.so.2"},
+	})
+	libstdcxx := write("libstdcxx", testbin.ELF{
+		Type:   elf.ET_EXEC,
+		Interp: _glibcInterp,
+		Needed: []string{"libstdc++.so.6", "libgcc_s.so.1", "libc.so.6"},
+	})
+	greeter := write("greeter", testbin.ELF{
+		Type:   elf.ET_EXEC,
+		Interp: _glibcInterp,
+		Needed: []string{"libgreeter.so.1", "libc.so.6"},
+	})
+	muslDynamic := write("musl_dynamic", testbin.ELF{
+		Type:   elf.ET_EXEC,
+		Interp: "/lib/ld-musl-x86_64.so.1",
+		Needed: []string{"libc.so"},
+	})
+	muslInterp := write("musl_interp", testbin.ELF{Type: elf.ET_EXEC, Interp: "/lib/ld-musl-x86_64.so.1"})
+	muslLibrary := write("libmusl.so", testbin.ELF{
+		Type:    elf.ET_DYN,
+		Needed:  []string{"libc.so"},
+		Dynamic: []testbin.Dyn{{Tag: elf.DT_SONAME, Str: "libmusl.so"}},
+	})
+	muslLibraryGlibc := write("libmusl_glibc.so", testbin.ELF{
+		Type:    elf.ET_DYN,
+		Needed:  []string{"libc.so.6"},
+		Dynamic: []testbin.Dyn{{Tag: elf.DT_SONAME, Str: "libmusl_glibc.so"}},
+	})
+
+	tests := []struct {
+		name    string
+		path    string
+		target  string
+		allowed []string
+		wantErr []string
+	}{
+		{name: "musl static", path: static, target: "x86_64-linux-musl"},
+		{name: "musl static pie", path: staticPIE, target: "x86_64-linux-musl"},
+		{
+			name:    "musl dynamic",
+			path:    muslDynamic,
+			target:  "x86_64-linux-musl",
+			wantErr: []string{muslDynamic + " is not static: interpreter /lib/ld-musl-x86_64.so.1, needs libc.so"},
+		},
+		{
+			name:    "musl allowed is still static",
+			path:    muslDynamic,
+			target:  "x86_64-linux-musl",
+			allowed: []string{"libc.so"},
+			wantErr: []string{"is not static"},
+		},
+		{
+			name:    "musl interpreter",
+			path:    muslInterp,
+			target:  "x86_64-linux-musl",
+			wantErr: []string{muslInterp + " is not static: interpreter /lib/ld-musl-x86_64.so.1"},
+		},
+		{name: "musl shared library", path: muslLibrary, target: "x86_64-linux-musl"},
+		{
+			name:    "musl shared library needs glibc",
+			path:    muslLibraryGlibc,
+			target:  "x86_64-linux-musl",
+			wantErr: []string{muslLibraryGlibc + " needs libc.so.6, which is not part of musl"},
+		},
+		{name: "glibc", path: glibc, target: "x86_64-linux-gnu.2.28"},
+		{name: "glibc static", path: static, target: "x86_64-linux-gnu.2.28"},
+		{
+			name:   "libstdc++",
+			path:   libstdcxx,
+			target: "x86_64-linux-gnu.2.28",
+			wantErr: []string{
+				libstdcxx + " needs libstdc++.so.6, which is not part of glibc",
+				libstdcxx + " needs libgcc_s.so.1, which is not part of glibc",
+			},
+		},
+		{
+			name:    "not allowed",
+			path:    greeter,
+			target:  "x86_64-linux-gnu.2.28",
+			wantErr: []string{greeter + " needs libgreeter.so.1, which is not part of glibc"},
+		},
+		{name: "allowed", path: greeter, target: "x86_64-linux-gnu.2.28", allowed: []string{"libgreeter.so.1"}},
+		{
+			name:    "not linux",
+			path:    glibc,
+			target:  "x86_64-windows-gnu",
+			wantErr: []string{"x86_64-windows-gnu is not a linux target"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target, err := ParseTarget(tt.target)
+			require.NoError(t, err)
+			_, err = CheckDeps(tt.path, target, tt.allowed...)
+			if len(tt.wantErr) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			for _, want := range tt.wantErr {
+				assert.ErrorContains(t, err, want)
+			}
+		})
+	}
+}
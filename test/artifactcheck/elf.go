@@ -0,0 +1,75 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+package artifactcheck
+
+import (
+	"debug/elf"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var _elfArchs = map[elf.Machine]string{
+	elf.EM_X86_64:  "x86_64",
+	elf.EM_AARCH64: "aarch64",
+}
+
+func inspectELF(r io.ReaderAt) (Artifact, error) {
+	f, err := elf.NewFile(r)
+	if err != nil {
+		return Artifact{}, err
+	}
+	defer f.Close()
+
+	a := Artifact{Format: FormatELF}
+	var ok bool
+	if a.Arch, ok = _elfArchs[f.Machine]; !ok {
+		a.Arch = f.Machine.String()
+	}
+	switch f.OSABI {
+	// zig and lld set ELFOSABI_GNU (a.k.a. LINUX) if the binary uses GNU
+	// extensions like IFUNCs, and ELFOSABI_NONE otherwise.
+	case elf.ELFOSABI_NONE, elf.ELFOSABI_LINUX:
+		a.OS = "linux"
+	default:
+		a.OS = strings.ToLower(strings.TrimPrefix(f.OSABI.String(), "ELFOSABI_"))
+	}
+
+	if a.Interp, err = elfInterp(f); err != nil {
+		return Artifact{}, err
+	}
+
+	switch f.Type {
+	case elf.ET_EXEC:
+		a.Kind = KindExecutable
+	case elf.ET_DYN:
+		// A shared library has neither an interpreter nor DF_1_PIE.
+		a.Kind = KindSharedLibrary
+		flags, err := f.DynValue(elf.DT_FLAGS_1)
+		if err != nil {
+			return Artifact{}, fmt.Errorf("read DT_FLAGS_1: %w", err)
+		}
+		if a.Interp != "" || len(flags) > 0 && elf.DynFlag1(flags[0])&elf.DF_1_PIE != 0 {
+			a.Kind, a.PIE = KindExecutable, true
+		}
+	default:
+		return Artifact{}, fmt.Errorf("unexpected ELF type %s", f.Type)
+	}
+	return a, nil
+}
+
+// elfInterp returns the PT_INTERP of f, or empty if it has none.
+func elfInterp(f *elf.File) (string, error) {
+	for _, prog := range f.Progs {
+		if prog.Type != elf.PT_INTERP {
+			continue
+		}
+		data, err := io.ReadAll(prog.Open())
+		if err != nil {
+			return "", fmt.Errorf("read PT_INTERP: %w", err)
+		}
+		return strings.TrimRight(string(data), "\x00"), nil
+	}
+	return "", nil
+}
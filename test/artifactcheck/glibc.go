@@ -0,0 +1,231 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+package artifactcheck
+
+import (
+	"debug/elf"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	_glibcPrefix   = "GLIBC_"
+	_glibcxxPrefix = "GLIBCXX_"
+)
+
+// _glibcABIVersions are the glibc releases of the GLIBC_ versions that are
+// not numbers. A binary linked with -z pack-relative-relocs needs
+// GLIBC_ABI_DT_RELR, which no glibc before 2.36 has. GLIBC_PRIVATE is not
+// an ABI and is ignored.
+var _glibcABIVersions = map[string]string{
+	"GLIBC_ABI_DT_RELR": "2.36",
+}
+
+// VersionNeed is the highest version of a versioned library that an ELF
+// file needs, and its symbols that need exactly that version.
+type VersionNeed struct {
+	// Version is the version without its prefix, e.g. "2.34" of
+	// GLIBC_2.34, or empty if the file needs none.
+	Version string
+	// Name is the name of Version in the file, e.g. GLIBC_2.34 or
+	// GLIBC_ABI_DT_RELR.
+	Name    string
+	Symbols []string
+}
+
+// GlibcNeeds are the highest glibc and libstdc++ versions that an ELF file
+// needs, from .gnu.version_r.
+type GlibcNeeds struct {
+	Glibc   VersionNeed // GLIBC_
+	Glibcxx VersionNeed // GLIBCXX_
+}
+
+// ReadGlibcNeeds reads the glibc and libstdc++ versions that the ELF file
+// at path needs.
+func ReadGlibcNeeds(path string) (GlibcNeeds, error) {
+	f, err := elf.Open(path)
+	if err != nil {
+		return GlibcNeeds{}, err
+	}
+	defer f.Close()
+
+	needs, err := versionNeeds(f)
+	if err != nil {
+		return GlibcNeeds{}, fmt.Errorf("%s: read .gnu.version_r: %w", path, err)
+	}
+	syms, err := f.DynamicSymbols()
+	if err != nil && !errors.Is(err, elf.ErrNoSymbols) {
+		return GlibcNeeds{}, fmt.Errorf("%s: read dynamic symbols: %w", path, err)
+	}
+
+	var ret GlibcNeeds
+	for _, name := range needs {
+		switch {
+		case strings.HasPrefix(name, _glibcxxPrefix):
+			ret.Glibcxx.raise(name, strings.TrimPrefix(name, _glibcxxPrefix))
+		case _glibcABIVersions[name] != "":
+			ret.Glibc.raise(name, _glibcABIVersions[name])
+		case strings.HasPrefix(name, _glibcPrefix):
+			ret.Glibc.raise(name, strings.TrimPrefix(name, _glibcPrefix))
+		}
+	}
+	for _, need := range []*VersionNeed{&ret.Glibc, &ret.Glibcxx} {
+		if need.Name == "" {
+			continue
+		}
+		for _, sym := range syms {
+			if sym.Section == elf.SHN_UNDEF && sym.Version == need.Name {
+				need.Symbols = append(need.Symbols, sym.Name)
+			}
+		}
+		sort.Strings(need.Symbols)
+	}
+	return ret, nil
+}
+
+// raise sets n to version named name, if it is a higher version. Versions
+// that are not numbers are ignored.
+func (n *VersionNeed) raise(name, version string) {
+	if _, ok := parseVersion(version); !ok {
+		return
+	}
+	if n.Version == "" || compareVersions(version, n.Version) > 0 {
+		n.Version, n.Name = version, name
+	}
+}
+
+// CheckGlibc checks that the ELF file at path needs no glibc newer than the
+// one of target. Targets without glibc (musl) may not need any.
+func CheckGlibc(path string, target Target) (GlibcNeeds, error) {
+	if target.OS != "linux" {
+		return GlibcNeeds{}, fmt.Errorf("%s is not a linux target", target)
+	}
+	if target.ABI == "gnu" && target.Glibc == "" {
+		return GlibcNeeds{}, fmt.Errorf("%s has no glibc version, e.g. %s.2.28", target, target)
+	}
+	needs, err := ReadGlibcNeeds(path)
+	if err != nil {
+		return needs, err
+	}
+	need := needs.Glibc
+	switch {
+	case need.Version == "":
+		return needs, nil
+	case target.ABI != "gnu":
+		return needs, fmt.Errorf("%s needs %s%s, but %s has no glibc", path, need.Name, need.symbols(), target)
+	case compareVersions(need.Version, target.Glibc) > 0:
+		return needs, fmt.Errorf("%s needs %s%s, newer than glibc %s of %s", path, need.Name, need.symbols(), target.Glibc, target)
+	}
+	return needs, nil
+}
+
+// symbols returns up to 3 of the symbols of n, for errors.
+func (n VersionNeed) symbols() string {
+	if len(n.Symbols) == 0 {
+		return ""
+	}
+	const max = 3
+	if len(n.Symbols) > max {
+		return fmt.Sprintf(" (%s and %d more)", strings.Join(n.Symbols[:max], ", "), len(n.Symbols)-max)
+	}
+	return " (" + strings.Join(n.Symbols, ", ") + ")"
+}
+
+// String returns the name of the version and its symbols, or "none".
+func (n VersionNeed) String() string {
+	if n.Name == "" {
+		return "none"
+	}
+	return n.Name + n.symbols()
+}
+
+// versionNeeds returns the version names of .gnu.version_r of every
+// library. debug/elf only reads them for symbols.
+func versionNeeds(f *elf.File) ([]string, error) {
+	vn := f.SectionByType(elf.SHT_GNU_VERNEED)
+	if vn == nil {
+		return nil, nil
+	}
+	if int(vn.Link) >= len(f.Sections) {
+		return nil, fmt.Errorf("string table %d out of range", vn.Link)
+	}
+	d, err := vn.Data()
+	if err != nil {
+		return nil, err
+	}
+	str, err := f.Sections[vn.Link].Data()
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []string
+	for i := 0; ; {
+		// Elf_Verneed: vn_version, vn_cnt, vn_file, vn_aux, vn_next
+		if i+16 > len(d) {
+			return nil, fmt.Errorf("verneed at %d out of range", i)
+		}
+		cnt := int(f.ByteOrder.Uint16(d[i+2:]))
+		aux := int(f.ByteOrder.Uint32(d[i+8:]))
+		next := int(f.ByteOrder.Uint32(d[i+12:]))
+		for j, c := i+aux, 0; c < cnt; c++ {
+			// Elf_Vernaux: vna_hash, vna_flags, vna_other, vna_name, vna_next
+			if j+16 > len(d) {
+				return nil, fmt.Errorf("vernaux at %d out of range", j)
+			}
+			name := int(f.ByteOrder.Uint32(d[j+8:]))
+			if name >= len(str) {
+				return nil, fmt.Errorf("vernaux name %d out of range", name)
+			}
+			end := strings.IndexByte(string(str[name:]), 0)
+			if end == -1 {
+				return nil, fmt.Errorf("vernaux name %d is not terminated", name)
+			}
+			ret = append(ret, string(str[name:name+end]))
+			j += int(f.ByteOrder.Uint32(d[j+12:]))
+		}
+		if next == 0 {
+			return ret, nil
+		}
+		i += next
+	}
+}
+
+// parseVersion parses a dotted version, e.g. 2.2.5.
+func parseVersion(version string) ([]int, bool) {
+	var ret []int
+	for _, part := range strings.Split(version, ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, false
+		}
+		ret = append(ret, n)
+	}
+	return ret, true
+}
+
+// compareVersions compares dotted versions, where 2.2 < 2.2.5 < 2.10.
+// Both must be parseVersion-able.
+func compareVersions(a, b string) int {
+	av, _ := parseVersion(a)
+	bv, _ := parseVersion(b)
+	for i := 0; i < len(av) || i < len(bv); i++ {
+		var x, y int
+		if i < len(av) {
+			x = av[i]
+		}
+		if i < len(bv) {
+			y = bv[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,157 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+package artifactcheck
+
+import (
+	"debug/elf"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/hermetic_cc_toolchain/test/artifactcheck/testbin"
+)
+
+// glibcELF is a glibc executable that imports symbols of the versions.
+func glibcELF(imports ...testbin.Import) []byte {
+	return testbin.ELF{
+		Machine: elf.EM_X86_64,
+		Type:    elf.ET_EXEC,
+		Interp:  _glibcInterp,
+		Needed:  []string{"libc.so.6"},
+		Imports: imports,
+	}.Bytes()
+}
+
+func TestReadGlibcNeeds(t *testing.T) {
+	path := testbin.WriteFile(t, "main", glibcELF(
+		testbin.Import{Name: "printf", Library: "libc.so.6", Version: "GLIBC_2.2.5"},
+		testbin.Import{Name: "fcntl64", Library: "libc.so.6", Version: "GLIBC_2.28"},
+		testbin.Import{Name: "__libc_start_main", Library: "libc.so.6", Version: "GLIBC_2.34"},
+		testbin.Import{Name: "pthread_create", Library: "libc.so.6", Version: "GLIBC_2.34"},
+		testbin.Import{Name: "__nss_database_lookup", Library: "libc.so.6", Version: "GLIBC_PRIVATE"},
+		testbin.Import{Name: "sqrt", Library: "libm.so.6", Version: "GLIBC_2.10"},
+		testbin.Import{Name: "_ZNSt6thread15_M_start_threadE", Library: "libstdc++.so.6", Version: "GLIBCXX_3.4.22"},
+		testbin.Import{Name: "_ZSt28__throw_bad_array_new_lengthv", Library: "libstdc++.so.6", Version: "GLIBCXX_3.4.29"},
+		testbin.Import{Name: "__cxa_begin_catch", Library: "libstdc++.so.6", Version: "CXXABI_1.3"},
+		testbin.Import{Name: "__gmon_start__", Weak: true},
+	))
+	got, err := ReadGlibcNeeds(path)
+	require.NoError(t, err)
+	assert.Equal(t, GlibcNeeds{
+		Glibc: VersionNeed{
+			Version: "2.34",
+			Name:    "GLIBC_2.34",
+			Symbols: []string{"__libc_start_main", "pthread_create"},
+		},
+		Glibcxx: VersionNeed{
+			Version: "3.4.29",
+			Name:    "GLIBCXX_3.4.29",
+			Symbols: []string{"_ZSt28__throw_bad_array_new_lengthv"},
+		},
+	}, got)
+	assert.Equal(t, "GLIBC_2.34 (__libc_start_main, pthread_create)", got.Glibc.String())
+
+	// GLIBC_2.10 is after GLIBC_2.9, not before GLIBC_2.2.
+	path = testbin.WriteFile(t, "main", glibcELF(
+		testbin.Import{Name: "sqrt", Library: "libm.so.6", Version: "GLIBC_2.10"},
+		testbin.Import{Name: "memcpy", Library: "libc.so.6", Version: "GLIBC_2.2.5"},
+		testbin.Import{Name: "accept4", Library: "libc.so.6", Version: "GLIBC_2.9"},
+	))
+	got, err = ReadGlibcNeeds(path)
+	require.NoError(t, err)
+	assert.Equal(t, "GLIBC_2.10", got.Glibc.Name)
+	assert.Equal(t, "none", got.Glibcxx.String())
+
+	// Without symbols or versions, e.g. a static musl binary.
+	path = testbin.WriteFile(t, "main", testbin.ELF{Machine: elf.EM_X86_64, Type: elf.ET_EXEC}.Bytes())
+	got, err = ReadGlibcNeeds(path)
+	require.NoError(t, err)
+	assert.Equal(t, GlibcNeeds{}, got)
+
+	path = testbin.WriteFile(t, "main", testbin.Wasm())
+	_, err = ReadGlibcNeeds(path)
+	assert.ErrorContains(t, err, "bad magic number")
+}
+
+func TestCheckGlibc(t *testing.T) {
+	path := testbin.WriteFile(t, "main", glibcELF(
+		testbin.Import{Name: "printf", Library: "libc.so.6", Version: "GLIBC_2.2.5"},
+		testbin.Import{Name: "fcntl64", Library: "libc.so.6", Version: "GLIBC_2.28"},
+	))
+	relr := testbin.WriteFile(t, "relr", glibcELF(
+		testbin.Import{Name: "printf", Library: "libc.so.6", Version: "GLIBC_2.2.5"},
+		testbin.Import{Name: "_", Library: "libc.so.6", Version: "GLIBC_ABI_DT_RELR"},
+	))
+	static := testbin.WriteFile(t, "static", testbin.ELF{Machine: elf.EM_X86_64, Type: elf.ET_EXEC}.Bytes())
+
+	tests := []struct {
+		name    string
+		path    string
+		target  string
+		wantErr string
+	}{
+		{name: "same", path: path, target: "x86_64-linux-gnu.2.28"},
+		{name: "newer", path: path, target: "x86_64-linux-gnu.2.41"},
+		{
+			name:    "older",
+			path:    path,
+			target:  "x86_64-linux-gnu.2.27",
+			wantErr: path + " needs GLIBC_2.28 (fcntl64), newer than glibc 2.27 of x86_64-linux-gnu.2.27",
+		},
+		{
+			name:    "musl",
+			path:    path,
+			target:  "x86_64-linux-musl",
+			wantErr: path + " needs GLIBC_2.28 (fcntl64), but x86_64-linux-musl has no glibc",
+		},
+		{name: "static musl", path: static, target: "x86_64-linux-musl"},
+		{name: "relr", path: relr, target: "x86_64-linux-gnu.2.36"},
+		{
+			name:    "relr before 2.36",
+			path:    relr,
+			target:  "x86_64-linux-gnu.2.35",
+			wantErr: relr + " needs GLIBC_ABI_DT_RELR (_), newer than glibc 2.35 of x86_64-linux-gnu.2.35",
+		},
+		{
+			name:    "no glibc version",
+			path:    path,
+			target:  "x86_64-linux-gnu",
+			wantErr: "x86_64-linux-gnu has no glibc version, e.g. x86_64-linux-gnu.2.28",
+		},
+		{
+			name:    "not linux",
+			path:    path,
+			target:  "x86_64-windows-gnu",
+			wantErr: "x86_64-windows-gnu is not a linux target",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target, err := ParseTarget(tt.target)
+			require.NoError(t, err)
+			_, err = CheckGlibc(tt.path, target)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	for _, tt := range []struct {
+		a, b string
+		want int
+	}{
+		{"2.28", "2.28", 0},
+		{"2.2", "2.2.0", 0},
+		{"2.2.5", "2.2", 1},
+		{"2.9", "2.10", -1},
+		{"3.4.29", "3.4.3", 1},
+	} {
+		assert.Equal(t, tt.want, compareVersions(tt.a, tt.b), "%s vs %s", tt.a, tt.b)
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+package artifactcheck
+
+import (
+	"bytes"
+	"debug/macho"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Load commands that debug/macho does not parse.
+const (
+	_lcIDDylib          macho.LoadCmd = 0xd
+	_lcLoadDylinker     macho.LoadCmd = 0xe
+	_lcLazyLoadDylib    macho.LoadCmd = 0x20
+	_lcVersionMinMacOSX macho.LoadCmd = 0x24
+	_lcBuildVersion     macho.LoadCmd = 0x32
+	_lcLoadWeakDylib    macho.LoadCmd = 0x80000018
+	_lcReexportDylib    macho.LoadCmd = 0x8000001f
+	_lcLoadUpwardDylib  macho.LoadCmd = 0x80000023
+)
+
+var _machoArchs = map[macho.Cpu]string{
+	macho.CpuAmd64: "x86_64",
+	macho.CpuArm64: "aarch64",
+}
+
+// _machoPlatforms are the platforms of LC_BUILD_VERSION.
+var _machoPlatforms = map[uint32]string{
+	1: "macos",
+	2: "ios",
+	3: "tvos",
+	4: "watchos",
+}
+
+func isMachO(magic [4]byte) bool {
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		switch order.Uint32(magic[:]) {
+		case macho.Magic32, macho.Magic64, macho.MagicFat:
+			return true
+		}
+	}
+	return false
+}
+
+func inspectMachO(r io.ReaderAt) (Artifact, error) {
+	f, err := macho.NewFile(r)
+	if err != nil {
+		if _, fatErr := macho.NewFatFile(r); fatErr == nil {
+			return Artifact{}, fmt.Errorf("universal Mach-O files are not supported")
+		}
+		return Artifact{}, err
+	}
+	defer f.Close()
+
+	a := Artifact{Format: FormatMachO}
+	var ok bool
+	if a.Arch, ok = _machoArchs[f.Cpu]; !ok {
+		a.Arch = f.Cpu.String()
+	}
+	switch f.Type {
+	case macho.TypeExec:
+		a.Kind = KindExecutable
+		a.PIE = f.Flags&macho.FlagPIE != 0
+	case macho.TypeDylib:
+		a.Kind = KindSharedLibrary
+	default:
+		return Artifact{}, fmt.Errorf("unexpected Mach-O type %s", f.Type)
+	}
+
+	for _, load := range f.Loads {
+		raw := load.Raw()
+		if len(raw) < 12 {
+			continue
+		}
+		switch macho.LoadCmd(f.ByteOrder.Uint32(raw)) {
+		case _lcLoadDylinker:
+			// struct dylinker_command { cmd, cmdsize, name.offset }
+			off := f.ByteOrder.Uint32(raw[8:])
+			if int(off) >= len(raw) {
+				return Artifact{}, fmt.Errorf("LC_LOAD_DYLINKER: name offset %d out of range", off)
+			}
+			name := raw[off:]
+			if i := bytes.IndexByte(name, 0); i != -1 {
+				name = name[:i]
+			}
+			a.Interp = string(name)
+		case _lcBuildVersion:
+			// struct build_version_command { cmd, cmdsize, platform, ... }
+			platform := f.ByteOrder.Uint32(raw[8:])
+			if a.OS, ok = _machoPlatforms[platform]; !ok {
+				a.OS = fmt.Sprintf("platform %d", platform)
+			}
+		case _lcVersionMinMacOSX:
+			a.OS = "macos"
+		}
+	}
+	return a, nil
+}
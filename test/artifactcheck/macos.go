@@ -0,0 +1,223 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+package artifactcheck
+
+import (
+	"bytes"
+	"debug/macho"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	// _maxPathLen is MAXPATHLEN of macOS. -headerpad_max_install_names
+	// leaves room for the dylib paths to grow to it, see man ld.
+	_maxPathLen = 1024
+	// _dylibCommandSize is sizeof(struct dylib_command): cmd, cmdsize,
+	// name.offset, timestamp, current_version and compatibility_version.
+	_dylibCommandSize = 24
+	// _machoSubtypeMask masks the capability bits out of cpusubtype.
+	_machoSubtypeMask = 0x00ffffff
+)
+
+// _machoSubCpus are the cpusubtypes that run on every CPU of an arch:
+// CPU_SUBTYPE_X86_64_ALL and CPU_SUBTYPE_ARM64_ALL, not e.g. arm64e.
+var _machoSubCpus = map[macho.Cpu]uint32{
+	macho.CpuAmd64: 3,
+	macho.CpuArm64: 0,
+}
+
+// _machoCpus are the Mach-O CPUs of the zig arches.
+var _machoCpus = map[string]macho.Cpu{
+	"x86_64":  macho.CpuAmd64,
+	"aarch64": macho.CpuArm64,
+}
+
+// _machoZerofills are the section types without data in the file.
+var _machoZerofills = map[uint32]bool{
+	0x1:  true, // S_ZEROFILL
+	0xc:  true, // S_GB_ZEROFILL
+	0x12: true, // S_THREAD_LOCAL_ZEROFILL
+}
+
+// MachO is what dyld, and tools that patch binaries like
+// install_name_tool, read from a Mach-O file.
+type MachO struct {
+	Cpu macho.Cpu
+	// SubCpu is the cpusubtype without the capability bits.
+	SubCpu uint32
+	// Platform is the platform of LC_BUILD_VERSION, or macos for
+	// LC_VERSION_MIN_MACOSX.
+	Platform string
+	// MinOS is the oldest release of Platform that the file runs on, e.g.
+	// "13.0", or empty if the file has neither load command.
+	MinOS string
+	// InstallName is the LC_ID_DYLIB of a dylib.
+	InstallName string
+	// Dylibs are the dylibs that the file loads, e.g. LC_LOAD_DYLIB.
+	Dylibs []string
+	// HeaderPad is the free space between the load commands and the
+	// first section, for load commands to grow into.
+	HeaderPad uint64
+	// Growth is how much the dylib load commands (LC_ID_DYLIB,
+	// LC_LOAD_DYLIB, ...) must grow together for all of their paths to be
+	// MAXPATHLEN long, e.g. when install_name_tool rewrites them at once.
+	Growth uint64
+}
+
+// ReadMachO reads the Mach-O file at path.
+func ReadMachO(path string) (MachO, error) {
+	f, err := macho.Open(path)
+	if err != nil {
+		return MachO{}, err
+	}
+	defer f.Close()
+
+	m := MachO{Cpu: f.Cpu, SubCpu: f.SubCpu & _machoSubtypeMask}
+	for _, load := range f.Loads {
+		raw := load.Raw()
+		if len(raw) < 16 {
+			continue
+		}
+		cmd := macho.LoadCmd(f.ByteOrder.Uint32(raw))
+		switch cmd {
+		case _lcBuildVersion:
+			// struct build_version_command { cmd, cmdsize, platform, minos, ... }
+			platform := f.ByteOrder.Uint32(raw[8:])
+			var ok bool
+			if m.Platform, ok = _machoPlatforms[platform]; !ok {
+				m.Platform = fmt.Sprintf("platform %d", platform)
+			}
+			m.MinOS = machoVersion(f.ByteOrder.Uint32(raw[12:]))
+		case _lcVersionMinMacOSX:
+			// struct version_min_command { cmd, cmdsize, version, sdk }
+			m.Platform = "macos"
+			m.MinOS = machoVersion(f.ByteOrder.Uint32(raw[8:]))
+		case _lcIDDylib, macho.LoadCmdDylib, _lcLoadWeakDylib, _lcReexportDylib, _lcLazyLoadDylib, _lcLoadUpwardDylib:
+			// struct dylib_command { cmd, cmdsize, name.offset, ... }
+			off := f.ByteOrder.Uint32(raw[8:])
+			if int(off) >= len(raw) {
+				return MachO{}, fmt.Errorf("%s: %s: name offset %d out of range", path, cmd, off)
+			}
+			name := raw[off:]
+			if i := bytes.IndexByte(name, 0); i != -1 {
+				name = name[:i]
+			}
+			if cmd == _lcIDDylib {
+				m.InstallName = string(name)
+			} else {
+				m.Dylibs = append(m.Dylibs, string(name))
+			}
+			full := uint64(_dylibCommandSize + _maxPathLen + 1)
+			full = (full + 7) &^ 7
+			if size := uint64(len(raw)); full > size {
+				m.Growth += full - size
+			}
+		}
+	}
+
+	// The load commands follow the header: 28 bytes, and 4 reserved
+	// ones for 64-bit files.
+	end := uint64(28 + f.Cmdsz)
+	if f.Magic == macho.Magic64 {
+		end += 4
+	}
+	first := uint64(0)
+	for _, s := range f.Sections {
+		if s.Size == 0 || s.Offset == 0 || _machoZerofills[s.Flags&0xff] {
+			continue
+		}
+		if first == 0 || uint64(s.Offset) < first {
+			first = uint64(s.Offset)
+		}
+	}
+	if first == 0 {
+		// No sections: the load commands may grow to the end of the file.
+		info, err := os.Stat(path)
+		if err != nil {
+			return MachO{}, err
+		}
+		first = uint64(info.Size())
+	}
+	if first < end {
+		return MachO{}, fmt.Errorf("%s: first section at %d overlaps the load commands ending at %d", path, first, end)
+	}
+	m.HeaderPad = first - end
+	return m, nil
+}
+
+// machoVersion formats a version of the form xxxx.yy.zz, e.g. 13.0.
+func machoVersion(v uint32) string {
+	if v&0xff != 0 {
+		return fmt.Sprintf("%d.%d.%d", v>>16, v>>8&0xff, v&0xff)
+	}
+	return fmt.Sprintf("%d.%d", v>>16, v>>8&0xff)
+}
+
+// MachOContract is what CheckMachO checks besides the target.
+type MachOContract struct {
+	// MinOS is the newest macOS that the file may need, e.g. "13.0": the
+	// file must run on it and on every later release.
+	MinOS string
+	// InstallName is the file name of the LC_ID_DYLIB of a dylib, e.g.
+	// libadd.dylib. The directory of the install name is where the dylib
+	// is installed, which depends on how it is linked and can be
+	// rewritten, so it is not checked.
+	InstallName string
+}
+
+// CheckMachO checks what only macOS would check when loading the Mach-O
+// file at path: its cpusubtype, the macOS it needs, the install name of a
+// dylib, and that the header padding of -headerpad_max_install_names is
+// enough for install_name_tool to rewrite the paths of its dylibs.
+func CheckMachO(path string, target Target, c MachOContract) (MachO, error) {
+	if target.OS != "macos" {
+		return MachO{}, fmt.Errorf("%s is not a macos target", target)
+	}
+	a, err := Inspect(path)
+	if err != nil {
+		return MachO{}, err
+	}
+	if a.Format != FormatMachO {
+		return MachO{}, fmt.Errorf("%s is not a Mach-O file, but %s", path, a.Format)
+	}
+	m, err := ReadMachO(path)
+	if err != nil {
+		return MachO{}, err
+	}
+
+	var errs []error
+	if cpu := _machoCpus[target.Arch]; m.Cpu != cpu {
+		errs = append(errs, fmt.Errorf("cpu is %s, want %s", m.Cpu, cpu))
+	} else if want := _machoSubCpus[cpu]; m.SubCpu != want {
+		errs = append(errs, fmt.Errorf("cpu subtype is %#x, want %#x", m.SubCpu, want))
+	}
+	switch {
+	case m.MinOS == "":
+		errs = append(errs, errors.New("has neither LC_BUILD_VERSION nor LC_VERSION_MIN_MACOSX"))
+	case m.Platform != "macos":
+		errs = append(errs, fmt.Errorf("platform is %s, want macos", m.Platform))
+	case c.MinOS != "" && compareVersions(m.MinOS, c.MinOS) > 0:
+		errs = append(errs, fmt.Errorf("needs macOS %s, newer than %s", m.MinOS, c.MinOS))
+	}
+	if a.Kind == KindSharedLibrary {
+		switch {
+		case m.InstallName == "":
+			errs = append(errs, errors.New("has no LC_ID_DYLIB"))
+		case c.InstallName != "" && m.InstallName[strings.LastIndex(m.InstallName, "/")+1:] != c.InstallName:
+			errs = append(errs, fmt.Errorf("install name is %q, want one named %q", m.InstallName, c.InstallName))
+		}
+	}
+	if m.HeaderPad < m.Growth {
+		errs = append(errs, fmt.Errorf(
+			"header padding is %d bytes, %d short of dylib paths of %d bytes each, see -headerpad_max_install_names",
+			m.HeaderPad, m.Growth-m.HeaderPad, _maxPathLen))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return m, fmt.Errorf("%s: %w", path, err)
+	}
+	return m, nil
+}
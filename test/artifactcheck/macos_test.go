@@ -0,0 +1,217 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+package artifactcheck
+
+import (
+	"debug/macho"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/hermetic_cc_toolchain/test/artifactcheck/testbin"
+)
+
+const _libSystem = "/usr/lib/libSystem.B.dylib"
+
+func TestReadMachO(t *testing.T) {
+	path := testbin.WriteFile(t, "libadd.dylib", testbin.MachO{
+		Cpu:         macho.CpuArm64,
+		SubCpu:      0x80000000, // CPU_SUBTYPE_LIB64
+		Type:        macho.TypeDylib,
+		Platform:    1,
+		MinOS:       13<<16 | 1<<8 | 2,
+		InstallName: "@rpath/libadd.dylib",
+		Dylibs:      []string{_libSystem},
+		HeaderPad:   2048,
+	}.Bytes())
+	got, err := ReadMachO(path)
+	require.NoError(t, err)
+	assert.Equal(t, MachO{
+		Cpu:         macho.CpuArm64,
+		Platform:    "macos",
+		MinOS:       "13.1.2",
+		InstallName: "@rpath/libadd.dylib",
+		Dylibs:      []string{_libSystem},
+		HeaderPad:   2048,
+		// A dylib_command of 24 bytes and MAXPATHLEN, aligned, minus the
+		// ones of @rpath/libadd.dylib and libSystem.
+		Growth: 1056 - 48 + 1056 - 56,
+	}, got)
+
+	path = testbin.WriteFile(t, "main", testbin.MachO{Cpu: macho.CpuAmd64, SubCpu: 3, Type: macho.TypeExec, VersionMin: true}.Bytes())
+	got, err = ReadMachO(path)
+	require.NoError(t, err)
+	assert.Equal(t, MachO{Cpu: macho.CpuAmd64, SubCpu: 3, Platform: "macos", MinOS: "10.0"}, got)
+
+	path = testbin.WriteFile(t, "main", testbin.ELF{}.Bytes())
+	_, err = ReadMachO(path)
+	assert.ErrorContains(t, err, "invalid magic number")
+}
+
+func TestMachoVersion(t *testing.T) {
+	assert.Equal(t, "11.0", machoVersion(11<<16))
+	assert.Equal(t, "10.15", machoVersion(10<<16|15<<8))
+	assert.Equal(t, "13.0.1", machoVersion(13<<16|1))
+}
+
+func TestCheckMachO(t *testing.T) {
+	exe := testbin.MachO{
+		Cpu:       macho.CpuArm64,
+		Type:      macho.TypeExec,
+		Flags:     macho.FlagPIE,
+		Dylinker:  "/usr/lib/dyld",
+		Platform:  1,
+		Dylibs:    []string{_libSystem},
+		HeaderPad: 1048,
+	}
+	dylib := testbin.MachO{
+		Cpu:         macho.CpuAmd64,
+		SubCpu:      3,
+		Type:        macho.TypeDylib,
+		Platform:    1,
+		InstallName: "bazel-out/darwin_x86_64-fastbuild/bin/test/c/libadd.dylib",
+		Dylibs:      []string{_libSystem},
+		HeaderPad:   2048,
+	}
+	with := func(m testbin.MachO, f func(m *testbin.MachO)) testbin.MachO {
+		f(&m)
+		return m
+	}
+	contract := MachOContract{MinOS: "13.0", InstallName: "libadd.dylib"}
+
+	tests := []struct {
+		name     string
+		macho    testbin.MachO
+		target   string
+		contract MachOContract
+		wantErr  []string
+	}{
+		{name: "executable", macho: exe, target: "aarch64-macos-none", contract: contract},
+		{name: "dylib", macho: dylib, target: "x86_64-macos-none", contract: contract},
+		{
+			name:     "rpath install name",
+			macho:    with(dylib, func(m *testbin.MachO) { m.InstallName = "@rpath/libadd.dylib" }),
+			target:   "x86_64-macos-none",
+			contract: contract,
+		},
+		{
+			name:     "version min",
+			macho:    with(exe, func(m *testbin.MachO) { m.Platform, m.VersionMin, m.MinOS = 0, true, 10<<16|15<<8 }),
+			target:   "aarch64-macos-none",
+			contract: contract,
+		},
+		{
+			name:     "no contract",
+			macho:    with(dylib, func(m *testbin.MachO) { m.MinOS, m.InstallName = 15<<16, "libother.dylib" }),
+			target:   "x86_64-macos-none",
+			contract: MachOContract{},
+		},
+		{
+			name:     "cpu",
+			macho:    exe,
+			target:   "x86_64-macos-none",
+			contract: contract,
+			wantErr:  []string{"cpu is CpuArm64, want CpuAmd64"},
+		},
+		{
+			name:     "arm64e",
+			macho:    with(exe, func(m *testbin.MachO) { m.SubCpu = 2 }),
+			target:   "aarch64-macos-none",
+			contract: contract,
+			wantErr:  []string{"cpu subtype is 0x2, want 0x0"},
+		},
+		{
+			name:     "x86_64h",
+			macho:    with(dylib, func(m *testbin.MachO) { m.SubCpu = 8 }),
+			target:   "x86_64-macos-none",
+			contract: contract,
+			wantErr:  []string{"cpu subtype is 0x8, want 0x3"},
+		},
+		{
+			name:     "no version",
+			macho:    with(exe, func(m *testbin.MachO) { m.Platform = 0 }),
+			target:   "aarch64-macos-none",
+			contract: contract,
+			wantErr:  []string{"has neither LC_BUILD_VERSION nor LC_VERSION_MIN_MACOSX"},
+		},
+		{
+			name:     "ios",
+			macho:    with(exe, func(m *testbin.MachO) { m.Platform = 2 }),
+			target:   "aarch64-macos-none",
+			contract: contract,
+			wantErr:  []string{"platform is ios, want macos"},
+		},
+		{
+			name:     "min os",
+			macho:    with(exe, func(m *testbin.MachO) { m.MinOS = 14 << 16 }),
+			target:   "aarch64-macos-none",
+			contract: contract,
+			wantErr:  []string{"needs macOS 14.0, newer than 13.0"},
+		},
+		{
+			name:     "no install name",
+			macho:    with(dylib, func(m *testbin.MachO) { m.InstallName = "" }),
+			target:   "x86_64-macos-none",
+			contract: contract,
+			wantErr:  []string{"has no LC_ID_DYLIB"},
+		},
+		{
+			name:     "install name",
+			macho:    with(dylib, func(m *testbin.MachO) { m.InstallName = "@rpath/libadd.so" }),
+			target:   "x86_64-macos-none",
+			contract: contract,
+			wantErr:  []string{`install name is "@rpath/libadd.so", want one named "libadd.dylib"`},
+		},
+		{
+			name:     "header padding",
+			macho:    with(exe, func(m *testbin.MachO) { m.HeaderPad = 16 }),
+			target:   "aarch64-macos-none",
+			contract: contract,
+			wantErr: []string{
+				"header padding is 16 bytes, 984 short of dylib paths of 1024 bytes each, see -headerpad_max_install_names",
+			},
+		},
+		{
+			// Enough for either dylib path, but not for both.
+			name: "header padding of two dylibs",
+			macho: with(exe, func(m *testbin.MachO) {
+				m.Dylibs = []string{_libSystem, "/usr/lib/libc++.1.dylib"}
+			}),
+			target:   "aarch64-macos-none",
+			contract: contract,
+			wantErr: []string{
+				"header padding is 1048 bytes, 960 short of dylib paths of 1024 bytes each, see -headerpad_max_install_names",
+			},
+		},
+		{
+			name:     "not macos",
+			macho:    exe,
+			target:   "aarch64-linux-musl",
+			contract: contract,
+			wantErr:  []string{"aarch64-linux-musl is not a macos target"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := testbin.WriteFile(t, "artifact", tt.macho.Bytes())
+			target, err := ParseTarget(tt.target)
+			require.NoError(t, err)
+			_, err = CheckMachO(path, target, tt.contract)
+			if len(tt.wantErr) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			for _, want := range tt.wantErr {
+				assert.ErrorContains(t, err, want)
+			}
+		})
+	}
+
+	path := testbin.WriteFile(t, "main", testbin.Wasm("wasi_snapshot_preview1"))
+	target, err := ParseTarget("aarch64-macos-none")
+	require.NoError(t, err)
+	_, err = CheckMachO(path, target, contract)
+	assert.EqualError(t, err, path+" is not a Mach-O file, but WebAssembly")
+}
@@ -0,0 +1,50 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+package artifactcheck
+
+import (
+	"debug/pe"
+	"fmt"
+	"io"
+)
+
+var _peArchs = map[uint16]string{
+	pe.IMAGE_FILE_MACHINE_AMD64: "x86_64",
+	pe.IMAGE_FILE_MACHINE_ARM64: "aarch64",
+}
+
+func inspectPE(r io.ReaderAt) (Artifact, error) {
+	f, err := pe.NewFile(r)
+	if err != nil {
+		return Artifact{}, err
+	}
+	defer f.Close()
+
+	a := Artifact{Format: FormatPE, OS: "windows"}
+	var ok bool
+	if a.Arch, ok = _peArchs[f.Machine]; !ok {
+		a.Arch = fmt.Sprintf("machine %#x", f.Machine)
+	}
+
+	var dllCharacteristics uint16
+	switch h := f.OptionalHeader.(type) {
+	case *pe.OptionalHeader64:
+		dllCharacteristics = h.DllCharacteristics
+	case *pe.OptionalHeader32:
+		dllCharacteristics = h.DllCharacteristics
+	default:
+		return Artifact{}, fmt.Errorf("no PE optional header")
+	}
+	a.PIE = dllCharacteristics&pe.IMAGE_DLLCHARACTERISTICS_DYNAMIC_BASE != 0
+
+	switch {
+	case f.Characteristics&pe.IMAGE_FILE_DLL != 0:
+		a.Kind = KindSharedLibrary
+	case f.Characteristics&pe.IMAGE_FILE_EXECUTABLE_IMAGE != 0:
+		a.Kind = KindExecutable
+	default:
+		return Artifact{}, fmt.Errorf("PE file is neither an executable nor a DLL")
+	}
+	return a, nil
+}
@@ -0,0 +1,46 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+// The test of shared_library_test in defs.bzl: checks that the LIBRARY has
+// the SONAME and the comma-separated EXPORTS, and that the space-separated
+// CONSUMERS need it by its soname.
+package artifactcheck_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/runfiles"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/hermetic_cc_toolchain/test/artifactcheck"
+)
+
+func TestSharedLibrary(t *testing.T) {
+	if os.Getenv("LIBRARY") == "" {
+		t.Skip("LIBRARY is not set; run it with shared_library_test of defs.bzl")
+	}
+
+	contract := artifactcheck.Contract{
+		Soname:  os.Getenv("SONAME"),
+		Exports: strings.Split(os.Getenv("EXPORTS"), ","),
+	}
+	t.Run("library", func(t *testing.T) {
+		library, err := runfiles.Rlocation(os.Getenv("LIBRARY"))
+		require.NoError(t, err, "locate library")
+		d, err := artifactcheck.CheckLibrary(library, contract)
+		assert.NoError(t, err)
+		t.Logf("soname %s, runpath %q, exports %q", d.Soname, d.Runpath, d.Exports)
+	})
+
+	for _, consumer := range strings.Fields(os.Getenv("CONSUMERS")) {
+		t.Run(consumer, func(t *testing.T) {
+			binary, err := runfiles.Rlocation(consumer)
+			require.NoError(t, err, "locate consumer")
+			d, err := artifactcheck.CheckConsumer(binary, contract.Soname)
+			assert.NoError(t, err)
+			t.Logf("needs %q, runpath %q", d.Needed, d.Runpath)
+		})
+	}
+}
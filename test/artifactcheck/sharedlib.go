@@ -0,0 +1,186 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+package artifactcheck
+
+import (
+	"debug/elf"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// _crtSymbols are defined by the C runtime, not by the sources of a
+// library: musl's crti.o exports _init and _fini, glibc's hides them.
+var _crtSymbols = map[string]bool{
+	"_init": true,
+	"_fini": true,
+}
+
+// Dynamic is the dynamic section and the exported symbols of an ELF file.
+type Dynamic struct {
+	Soname  string   // DT_SONAME, or empty if the file has none
+	Needed  []string // DT_NEEDED, in link order
+	Runpath []string // the entries of DT_RUNPATH and DT_RPATH
+	Exports []string // defined global and weak dynamic symbols, sorted
+}
+
+// ReadDynamic reads the dynamic section and the exported symbols of the ELF
+// file at path.
+func ReadDynamic(path string) (Dynamic, error) {
+	f, err := elf.Open(path)
+	if err != nil {
+		return Dynamic{}, err
+	}
+	defer f.Close()
+
+	var d Dynamic
+	sonames, err := f.DynString(elf.DT_SONAME)
+	if err != nil {
+		return Dynamic{}, fmt.Errorf("%s: read DT_SONAME: %w", path, err)
+	}
+	if len(sonames) > 0 {
+		d.Soname = sonames[0]
+	}
+	if d.Needed, err = f.DynString(elf.DT_NEEDED); err != nil {
+		return Dynamic{}, fmt.Errorf("%s: read DT_NEEDED: %w", path, err)
+	}
+	for _, tag := range []elf.DynTag{elf.DT_RUNPATH, elf.DT_RPATH} {
+		paths, err := f.DynString(tag)
+		if err != nil {
+			return Dynamic{}, fmt.Errorf("%s: read %s: %w", path, tag, err)
+		}
+		for _, p := range paths {
+			d.Runpath = append(d.Runpath, strings.Split(p, ":")...)
+		}
+	}
+
+	syms, err := f.DynamicSymbols()
+	if err != nil && !errors.Is(err, elf.ErrNoSymbols) {
+		return Dynamic{}, fmt.Errorf("%s: read dynamic symbols: %w", path, err)
+	}
+	for _, sym := range syms {
+		bind, typ := elf.ST_BIND(sym.Info), elf.ST_TYPE(sym.Info)
+		switch {
+		case sym.Section == elf.SHN_UNDEF:
+		case bind != elf.STB_GLOBAL && bind != elf.STB_WEAK:
+		case typ != elf.STT_FUNC && typ != elf.STT_OBJECT && typ != elf.STT_TLS && typ != elf.STT_NOTYPE:
+		case elf.ST_VISIBILITY(sym.Other) != elf.STV_DEFAULT && elf.ST_VISIBILITY(sym.Other) != elf.STV_PROTECTED:
+		default:
+			d.Exports = append(d.Exports, sym.Name)
+		}
+	}
+	sort.Strings(d.Exports)
+	return d, nil
+}
+
+// Contract is what a shared library promises to the binaries that link it.
+type Contract struct {
+	// Soname is the DT_SONAME that the binaries record in DT_NEEDED,
+	// e.g. libadd.so.
+	Soname string
+	// Exports are the symbols that the library exports, besides the ones
+	// of the C runtime.
+	Exports []string
+}
+
+// CheckLibrary checks that the ELF file at path is a shared library that
+// keeps its contract, and that it finds its own libraries relative to
+// itself.
+func CheckLibrary(path string, c Contract) (Dynamic, error) {
+	a, err := Inspect(path)
+	if err != nil {
+		return Dynamic{}, err
+	}
+	if a.Format != FormatELF || a.Kind != KindSharedLibrary {
+		return Dynamic{}, fmt.Errorf("%s is not an ELF shared library, but an %s %s", path, a.Format, a.Kind)
+	}
+	d, err := ReadDynamic(path)
+	if err != nil {
+		return Dynamic{}, err
+	}
+
+	var errs []error
+	if d.Soname != c.Soname {
+		errs = append(errs, fmt.Errorf("soname is %q, want %q", d.Soname, c.Soname))
+	}
+	errs = append(errs, d.checkRunpath())
+	var exports []string
+	for _, sym := range d.Exports {
+		if !_crtSymbols[sym] {
+			exports = append(exports, sym)
+		}
+	}
+	want := slices.Clone(c.Exports)
+	sort.Strings(want)
+	if missing, extra := diffSorted(want, exports); len(missing)+len(extra) > 0 {
+		errs = append(errs, fmt.Errorf("exports differ: missing %q, unexpected %q", missing, extra))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return d, fmt.Errorf("%s breaks its contract: %w", path, err)
+	}
+	return d, nil
+}
+
+// CheckConsumer checks that the ELF file at path needs the shared
+// libraries by their sonames, not by the paths they were linked from, e.g.
+// bazel-out/k8-fastbuild/bin/libadd.so, and that it finds them relative to
+// itself.
+func CheckConsumer(path string, sonames ...string) (Dynamic, error) {
+	d, err := ReadDynamic(path)
+	if err != nil {
+		return Dynamic{}, err
+	}
+
+	var errs []error
+	for _, lib := range d.Needed {
+		if strings.Contains(lib, "/") {
+			errs = append(errs, fmt.Errorf("needs %q, a path instead of a soname", lib))
+		}
+	}
+	for _, soname := range sonames {
+		if !slices.Contains(d.Needed, soname) {
+			errs = append(errs, fmt.Errorf("does not need %s, needs %s", soname, strings.Join(d.Needed, ", ")))
+		}
+	}
+	errs = append(errs, d.checkRunpath())
+	if err := errors.Join(errs...); err != nil {
+		return d, fmt.Errorf("%s: %w", path, err)
+	}
+	return d, nil
+}
+
+// checkRunpath checks that every runpath entry is relative to $ORIGIN, the
+// directory of the file: absolute ones are the paths of the build machine,
+// and relative ones are relative to the working directory at run time.
+func (d Dynamic) checkRunpath() error {
+	var errs []error
+	for _, p := range d.Runpath {
+		if p != "$ORIGIN" && !strings.HasPrefix(p, "$ORIGIN/") && p != "${ORIGIN}" && !strings.HasPrefix(p, "${ORIGIN}/") {
+			errs = append(errs, fmt.Errorf("runpath %q is not relative to $ORIGIN", p))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// diffSorted returns the strings of the sorted want that are not in the
+// sorted got, and the ones of got that are not in want.
+func diffSorted(want, got []string) (missing, extra []string) {
+	i, j := 0, 0
+	for i < len(want) || j < len(got) {
+		switch {
+		case j == len(got) || i < len(want) && want[i] < got[j]:
+			missing = append(missing, want[i])
+			i++
+		case i == len(want) || got[j] < want[i]:
+			extra = append(extra, got[j])
+			j++
+		default:
+			i++
+			j++
+		}
+	}
+	return missing, extra
+}
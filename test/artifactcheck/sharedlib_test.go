@@ -0,0 +1,176 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+package artifactcheck
+
+import (
+	"debug/elf"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/hermetic_cc_toolchain/test/artifactcheck/testbin"
+)
+
+// library is a shared library with the soname, runpath and exports.
+func library(soname string, runpath string, exports ...string) testbin.ELF {
+	e := testbin.ELF{
+		Machine: elf.EM_X86_64,
+		Type:    elf.ET_DYN,
+		Needed:  []string{"libc.so.6"},
+		Imports: []testbin.Import{{Name: "printf", Library: "libc.so.6", Version: "GLIBC_2.2.5"}},
+		Exports: exports,
+	}
+	if soname != "" {
+		e.Dynamic = append(e.Dynamic, testbin.Dyn{Tag: elf.DT_SONAME, Str: soname})
+	}
+	if runpath != "" {
+		e.Dynamic = append(e.Dynamic, testbin.Dyn{Tag: elf.DT_RUNPATH, Str: runpath})
+	}
+	return e
+}
+
+func TestReadDynamic(t *testing.T) {
+	e := library("libadd.so", "$ORIGIN:$ORIGIN/../_solib_k8", "sub", "add", "_init")
+	e.Dynamic = append(e.Dynamic, testbin.Dyn{Tag: elf.DT_RPATH, Str: "/usr/lib"})
+	path := testbin.WriteFile(t, "libadd.so", e.Bytes())
+
+	got, err := ReadDynamic(path)
+	require.NoError(t, err)
+	assert.Equal(t, Dynamic{
+		Soname:  "libadd.so",
+		Needed:  []string{"libc.so.6"},
+		Runpath: []string{"$ORIGIN", "$ORIGIN/../_solib_k8", "/usr/lib"},
+		Exports: []string{"_init", "add", "sub"},
+	}, got)
+
+	path = testbin.WriteFile(t, "main", testbin.ELF{Machine: elf.EM_X86_64, Type: elf.ET_EXEC}.Bytes())
+	got, err = ReadDynamic(path)
+	require.NoError(t, err)
+	assert.Equal(t, Dynamic{}, got)
+}
+
+func TestCheckLibrary(t *testing.T) {
+	contract := Contract{Soname: "libadd.so", Exports: []string{"sub", "add"}}
+
+	tests := []struct {
+		name    string
+		elf     testbin.ELF
+		wantErr []string
+	}{
+		{name: "ok", elf: library("libadd.so", "", "add", "sub")},
+		{name: "crt symbols", elf: library("libadd.so", "", "_fini", "_init", "add", "sub")},
+		{name: "origin", elf: library("libadd.so", "$ORIGIN/../_solib_k8:${ORIGIN}", "add", "sub")},
+		{
+			name:    "no soname",
+			elf:     library("", "", "add", "sub"),
+			wantErr: []string{`soname is "", want "libadd.so"`},
+		},
+		{
+			name:    "versioned soname",
+			elf:     library("libadd.so.1", "", "add", "sub"),
+			wantErr: []string{`soname is "libadd.so.1", want "libadd.so"`},
+		},
+		{
+			name: "absolute runpath",
+			elf:  library("libadd.so", "$ORIGIN:/home/user/.cache/bazel/execroot/bazel-out/k8-fastbuild/bin:lib", "add", "sub"),
+			wantErr: []string{
+				`runpath "/home/user/.cache/bazel/execroot/bazel-out/k8-fastbuild/bin" is not relative to $ORIGIN`,
+				`runpath "lib" is not relative to $ORIGIN`,
+			},
+		},
+		{
+			name:    "exports",
+			elf:     library("libadd.so", "", "add", "helper"),
+			wantErr: []string{`exports differ: missing ["sub"], unexpected ["helper"]`},
+		},
+		{
+			name:    "not a library",
+			elf:     testbin.ELF{Machine: elf.EM_X86_64, Type: elf.ET_EXEC},
+			wantErr: []string{"is not an ELF shared library, but an ELF executable"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := testbin.WriteFile(t, "libadd.so", tt.elf.Bytes())
+			_, err := CheckLibrary(path, contract)
+			if len(tt.wantErr) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, path)
+			for _, want := range tt.wantErr {
+				assert.ErrorContains(t, err, want)
+			}
+		})
+	}
+}
+
+func TestCheckConsumer(t *testing.T) {
+	consumer := func(runpath string, needed ...string) testbin.ELF {
+		e := testbin.ELF{Machine: elf.EM_X86_64, Type: elf.ET_EXEC, Interp: _glibcInterp, Needed: needed}
+		if runpath != "" {
+			e.Dynamic = []testbin.Dyn{{Tag: elf.DT_RUNPATH, Str: runpath}}
+		}
+		return e
+	}
+
+	tests := []struct {
+		name    string
+		elf     testbin.ELF
+		sonames []string
+		wantErr []string
+	}{
+		{
+			name:    "ok",
+			elf:     consumer("$ORIGIN/../_solib_k8", "libadd.so", "libc.so.6"),
+			sonames: []string{"libadd.so"},
+		},
+		{
+			name:    "versioned",
+			elf:     consumer("", "libgreeter.so.1", "libc.so.6"),
+			sonames: []string{"libgreeter.so.1"},
+		},
+		{
+			name:    "path",
+			elf:     consumer("", "bazel-out/k8-fastbuild/bin/test/soname/libadd.so", "libc.so.6"),
+			sonames: []string{"libadd.so"},
+			wantErr: []string{
+				`needs "bazel-out/k8-fastbuild/bin/test/soname/libadd.so", a path instead of a soname`,
+				"does not need libadd.so, needs bazel-out/k8-fastbuild/bin/test/soname/libadd.so, libc.so.6",
+			},
+		},
+		{
+			name:    "absolute runpath",
+			elf:     consumer("/usr/local/lib", "libadd.so"),
+			sonames: []string{"libadd.so"},
+			wantErr: []string{`runpath "/usr/local/lib" is not relative to $ORIGIN`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := testbin.WriteFile(t, "main", tt.elf.Bytes())
+			_, err := CheckConsumer(path, tt.sonames...)
+			if len(tt.wantErr) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, path+": ")
+			for _, want := range tt.wantErr {
+				assert.ErrorContains(t, err, want)
+			}
+		})
+	}
+}
+
+func TestDiffSorted(t *testing.T) {
+	missing, extra := diffSorted([]string{"a", "c", "d"}, []string{"b", "c", "e"})
+	assert.Equal(t, []string{"a", "d"}, missing)
+	assert.Equal(t, []string{"b", "e"}, extra)
+
+	missing, extra = diffSorted([]string{"a"}, []string{"a"})
+	assert.Empty(t, missing)
+	assert.Empty(t, extra)
+}
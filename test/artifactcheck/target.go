@@ -0,0 +1,180 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+package artifactcheck
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// _glibcRegexp matches the glibc version of a linux-gnu target.
+var _glibcRegexp = regexp.MustCompile(`^[0-9]+\.[0-9]+$`)
+
+// _targetABIs are the ABIs of every OS that the toolchain targets, see
+// target_structs in toolchain/private/defs.bzl.
+var _targetABIs = map[string][]string{
+	"linux":        {"gnu", "musl"},
+	"macos":        {"none"},
+	"windows":      {"gnu"},
+	"wasi":         {"musl"},
+	"freestanding": {"musl"},
+}
+
+// Target is a zig target triple, e.g. x86_64-linux-gnu.2.28 or
+// aarch64-macos-none.
+type Target struct {
+	Arch string // x86_64, aarch64 or wasm32
+	OS   string // linux, macos, windows, wasi or freestanding
+	ABI  string // gnu, musl or none
+	// Glibc is the glibc version of a linux-gnu target, e.g. "2.28", or
+	// empty if the triple does not have one.
+	Glibc string
+}
+
+// ParseTarget parses a zig target triple of the toolchain.
+func ParseTarget(triple string) (Target, error) {
+	parts := strings.Split(triple, "-")
+	if len(parts) != 3 {
+		return Target{}, fmt.Errorf("target %q: expected {arch}-{os}-{abi}", triple)
+	}
+	t := Target{Arch: parts[0], OS: parts[1], ABI: parts[2]}
+	if abi, glibc, ok := strings.Cut(t.ABI, "."); ok {
+		t.ABI, t.Glibc = abi, glibc
+		if abi != "gnu" || !_glibcRegexp.MatchString(glibc) {
+			return Target{}, fmt.Errorf("target %q: unknown abi %q", triple, parts[2])
+		}
+	}
+
+	abis, ok := _targetABIs[t.OS]
+	if !ok {
+		return Target{}, fmt.Errorf("target %q: unknown os %q", triple, t.OS)
+	}
+	switch {
+	case t.OS == "wasi" || t.OS == "freestanding":
+		if t.Arch != "wasm32" {
+			return Target{}, fmt.Errorf("target %q: %s is only wasm32, not %s", triple, t.OS, t.Arch)
+		}
+	case t.Arch != "x86_64" && t.Arch != "aarch64":
+		return Target{}, fmt.Errorf("target %q: unknown arch %q for %s", triple, t.Arch, t.OS)
+	}
+	for _, abi := range abis {
+		if t.ABI == abi {
+			return t, nil
+		}
+	}
+	return Target{}, fmt.Errorf("target %q: unknown abi %q for %s, expected %s", triple, t.ABI, t.OS, strings.Join(abis, " or "))
+}
+
+// _platformOSes are the zig OSes of the OSes in platform names.
+var _platformOSes = map[string]string{
+	"linux":   "linux",
+	"macos":   "macos",
+	"darwin":  "macos",
+	"windows": "windows",
+	"wasip1":  "wasi",
+	"none":    "freestanding",
+}
+
+// _platformArchs are the zig arches of the CPUs in platform names.
+var _platformArchs = map[string]string{
+	"amd64":   "x86_64",
+	"x86_64":  "x86_64",
+	"arm64":   "aarch64",
+	"aarch64": "aarch64",
+	"wasm":    "wasm32",
+	"wasm32":  "wasm32",
+}
+
+// ParsePlatform returns the target of a platform of @zig_sdk, e.g.
+// linux_amd64_gnu.2.28 or @zig_sdk//libc_aware/platform:linux_arm64_musl,
+// see toolchain/platform/defs.bzl. Linux platforms must name their libc:
+// the ones that do not build with the libc of the first registered
+// toolchain.
+func ParsePlatform(platform string) (Target, error) {
+	name := platform[strings.LastIndex(platform, ":")+1:]
+	osName, rest, ok := strings.Cut(name, "_")
+	if !ok {
+		return Target{}, fmt.Errorf("platform %q: expected {os}_{cpu}[_{libc}]", platform)
+	}
+	os, ok := _platformOSes[osName]
+	if !ok {
+		return Target{}, fmt.Errorf("platform %q: unknown os %q", platform, osName)
+	}
+	// The cpu may itself have an underscore, e.g. linux_x86_64_musl.
+	var cpu, libc string
+	for c := range _platformArchs {
+		if rest == c || strings.HasPrefix(rest, c+"_") {
+			cpu, libc = c, strings.TrimPrefix(rest[len(c):], "_")
+		}
+	}
+	if cpu == "" {
+		cpu, _, _ = strings.Cut(rest, "_")
+		return Target{}, fmt.Errorf("platform %q: unknown cpu %q", platform, cpu)
+	}
+	arch := _platformArchs[cpu]
+	var abi string
+	switch {
+	case libc != "" && os != "linux":
+		return Target{}, fmt.Errorf("platform %q: only linux platforms have a libc", platform)
+	case libc != "" && libc != "musl" && !strings.HasPrefix(libc, "gnu."):
+		return Target{}, fmt.Errorf("platform %q: unknown libc %q, expected musl or gnu.{glibc}", platform, libc)
+	case libc != "":
+		abi = libc
+	case os == "linux":
+		return Target{}, fmt.Errorf("platform %q does not name a libc, e.g. %s_gnu.2.28 or %s_musl", platform, name, name)
+	default:
+		abi = _targetABIs[os][0]
+	}
+	t, err := ParseTarget(arch + "-" + os + "-" + abi)
+	if err != nil {
+		return Target{}, fmt.Errorf("platform %q: %w", platform, err)
+	}
+	return t, nil
+}
+
+// String returns the zig target triple.
+func (t Target) String() string {
+	abi := t.ABI
+	if t.Glibc != "" {
+		abi += "." + t.Glibc
+	}
+	return t.Arch + "-" + t.OS + "-" + abi
+}
+
+// Format is the object file format of the target.
+func (t Target) Format() Format {
+	switch t.OS {
+	case "linux":
+		return FormatELF
+	case "macos":
+		return FormatMachO
+	case "windows":
+		return FormatPE
+	default:
+		return FormatWasm
+	}
+}
+
+// PIE is whether zig always links executables of the target position
+// independent: on macOS, and with /DYNAMICBASE on Windows. Whether Linux
+// executables are PIE is up to the build, e.g. -pie, so it is not checked.
+func (t Target) PIE() bool {
+	return t.OS == "macos" || t.OS == "windows"
+}
+
+// Interp is the dynamic linker of executables of the target, or empty if
+// they do not have one.
+func (t Target) Interp() string {
+	switch {
+	case t.OS == "macos":
+		return "/usr/lib/dyld"
+	case t.OS == "linux" && t.ABI == "gnu" && t.Arch == "x86_64":
+		return "/lib64/ld-linux-x86-64.so.2"
+	case t.OS == "linux" && t.ABI == "gnu":
+		return "/lib/ld-linux-" + t.Arch + ".so.1"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+package artifactcheck
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTarget(t *testing.T) {
+	tests := []struct {
+		triple  string
+		want    Target
+		wantErr string
+	}{
+		{
+			triple: "x86_64-linux-gnu.2.28",
+			want:   Target{Arch: "x86_64", OS: "linux", ABI: "gnu", Glibc: "2.28"},
+		},
+		{
+			triple: "aarch64-linux-musl",
+			want:   Target{Arch: "aarch64", OS: "linux", ABI: "musl"},
+		},
+		{
+			triple: "aarch64-macos-none",
+			want:   Target{Arch: "aarch64", OS: "macos", ABI: "none"},
+		},
+		{
+			triple: "x86_64-windows-gnu",
+			want:   Target{Arch: "x86_64", OS: "windows", ABI: "gnu"},
+		},
+		{
+			triple: "wasm32-wasi-musl",
+			want:   Target{Arch: "wasm32", OS: "wasi", ABI: "musl"},
+		},
+		{
+			triple: "wasm32-freestanding-musl",
+			want:   Target{Arch: "wasm32", OS: "freestanding", ABI: "musl"},
+		},
+		{triple: "x86_64-linux", wantErr: `target "x86_64-linux": expected {arch}-{os}-{abi}`},
+		{triple: "x86_64-linux-musl.1.2", wantErr: `unknown abi "musl.1.2"`},
+		{triple: "x86_64-linux-gnu.2", wantErr: `unknown abi "gnu.2"`},
+		{triple: "x86_64-freebsd-none", wantErr: `unknown os "freebsd"`},
+		{triple: "riscv64-linux-musl", wantErr: `unknown arch "riscv64" for linux`},
+		{triple: "x86_64-wasi-musl", wantErr: "wasi is only wasm32, not x86_64"},
+		{triple: "x86_64-macos-gnu", wantErr: `unknown abi "gnu" for macos, expected none`},
+		{triple: "x86_64-linux-none", wantErr: `unknown abi "none" for linux, expected gnu or musl`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.triple, func(t *testing.T) {
+			got, err := ParseTarget(tt.triple)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.triple, got.String())
+		})
+	}
+}
+
+func TestParsePlatform(t *testing.T) {
+	tests := []struct {
+		platform string
+		want     string
+		wantErr  string
+	}{
+		{platform: "linux_amd64_gnu.2.28", want: "x86_64-linux-gnu.2.28"},
+		{platform: "@zig_sdk//libc_aware/platform:linux_arm64_musl", want: "aarch64-linux-musl"},
+		{platform: "//libc_aware/platform:linux_aarch64_gnu.2.17", want: "aarch64-linux-gnu.2.17"},
+		{platform: "darwin_arm64", want: "aarch64-macos-none"},
+		{platform: "macos_x86_64", want: "x86_64-macos-none"},
+		{platform: "@zig_sdk//platform:windows_amd64", want: "x86_64-windows-gnu"},
+		{platform: "wasip1_wasm", want: "wasm32-wasi-musl"},
+		{platform: "none_wasm", want: "wasm32-freestanding-musl"},
+		{platform: "linux", wantErr: `platform "linux": expected {os}_{cpu}[_{libc}]`},
+		{platform: "freebsd_amd64", wantErr: `unknown os "freebsd"`},
+		{platform: "linux_riscv64_musl", wantErr: `unknown cpu "riscv64"`},
+		{platform: "linux_x86_64_musl", want: "x86_64-linux-musl"},
+		{platform: "linux_amd64_gnu", wantErr: `unknown libc "gnu", expected musl or gnu.{glibc}`},
+		{platform: "linux_amd64_gnu.2", wantErr: `unknown abi "gnu.2"`},
+		{platform: "windows_amd64_gnu", wantErr: "only linux platforms have a libc"},
+		{
+			platform: "//platform:linux_amd64",
+			wantErr:  `platform "//platform:linux_amd64" does not name a libc, e.g. linux_amd64_gnu.2.28 or linux_amd64_musl`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.platform, func(t *testing.T) {
+			got, err := ParsePlatform(tt.platform)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got.String())
+		})
+	}
+}
+
+func TestTargetExecutables(t *testing.T) {
+	tests := []struct {
+		triple string
+		format Format
+		pie    bool
+		interp string
+	}{
+		{"x86_64-linux-gnu.2.17", FormatELF, false, "/lib64/ld-linux-x86-64.so.2"},
+		{"aarch64-linux-gnu.2.28", FormatELF, false, "/lib/ld-linux-aarch64.so.1"},
+		{"x86_64-linux-musl", FormatELF, false, ""},
+		{"aarch64-macos-none", FormatMachO, true, "/usr/lib/dyld"},
+		{"aarch64-windows-gnu", FormatPE, true, ""},
+		{"wasm32-wasi-musl", FormatWasm, false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.triple, func(t *testing.T) {
+			target, err := ParseTarget(tt.triple)
+			require.NoError(t, err)
+			assert.Equal(t, tt.format, target.Format())
+			assert.Equal(t, tt.pie, target.PIE())
+			assert.Equal(t, tt.interp, target.Interp())
+		})
+	}
+}
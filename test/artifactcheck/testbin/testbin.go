@@ -0,0 +1,484 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+// Package testbin writes the smallest binaries that the debug packages
+// read, with only the parts that artifactcheck looks at, for tests that
+// cannot build real ones for every target.
+package testbin
+
+import (
+	"bytes"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Load commands that debug/macho does not parse.
+const (
+	LoadIDDylib      macho.LoadCmd = 0xd
+	LoadDylinker     macho.LoadCmd = 0xe
+	LoadVersionMinOS macho.LoadCmd = 0x24
+	LoadBuildVersion macho.LoadCmd = 0x32
+)
+
+// WriteFile writes data to a new file in a temporary directory of t and
+// returns its path.
+func WriteFile(t testing.TB, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// Dyn is an entry of .dynamic. If Str is set, Val is its offset in
+// .dynstr.
+type Dyn struct {
+	Tag elf.DynTag
+	Val uint64
+	Str string
+}
+
+// Import is an undefined dynamic symbol. If Version is set, it is a
+// version of Library in .gnu.version_r.
+type Import struct {
+	Name    string
+	Library string
+	Version string
+	Weak    bool
+}
+
+// ELF is a little-endian ELF64 file.
+type ELF struct {
+	Machine elf.Machine
+	OSABI   elf.OSABI
+	Type    elf.Type
+	Interp  string
+	// Needed are the DT_NEEDED entries, before Dynamic.
+	Needed  []string
+	Dynamic []Dyn
+	Imports []Import
+	// Exports are defined dynamic functions, after Imports.
+	Exports []string
+}
+
+type elfSection struct {
+	name    string
+	typ     elf.SectionType
+	link    uint32
+	info    uint32
+	entsize uint64
+	data    []byte
+	prog    elf.ProgType // PT_NULL if none
+	off     uint64
+}
+
+// Bytes returns the file.
+func (e ELF) Bytes() []byte {
+	le := binary.LittleEndian
+
+	dynstr := []byte{0}
+	str := func(s string) uint32 {
+		if i := bytes.Index(dynstr, []byte("\x00"+s+"\x00")); i != -1 {
+			return uint32(i + 1)
+		}
+		off := uint32(len(dynstr))
+		dynstr = append(dynstr, s+"\x00"...)
+		return off
+	}
+
+	dyns := make([]Dyn, 0, len(e.Needed)+len(e.Dynamic))
+	for _, lib := range e.Needed {
+		dyns = append(dyns, Dyn{Tag: elf.DT_NEEDED, Str: lib})
+	}
+	dyns = append(dyns, e.Dynamic...)
+	var dynamic bytes.Buffer
+	for _, d := range dyns {
+		val := d.Val
+		if d.Str != "" {
+			val = uint64(str(d.Str))
+		}
+		binary.Write(&dynamic, le, elf.Dyn64{Tag: int64(d.Tag), Val: val})
+	}
+
+	// The versions of every library, in the order they are first
+	// imported, and their version indexes from 2.
+	type need struct {
+		library  string
+		versions []string
+	}
+	var needs []*need
+	index := make(map[[2]string]uint16)
+	var dynsym, versym bytes.Buffer
+	binary.Write(&dynsym, le, elf.Sym64{})
+	binary.Write(&versym, le, uint16(0))
+	for _, imp := range e.Imports {
+		bind := elf.STB_GLOBAL
+		if imp.Weak {
+			bind = elf.STB_WEAK
+		}
+		binary.Write(&dynsym, le, elf.Sym64{
+			Name: str(imp.Name),
+			Info: elf.ST_INFO(bind, elf.STT_FUNC),
+		})
+		if imp.Version == "" {
+			binary.Write(&versym, le, uint16(1))
+			continue
+		}
+		key := [2]string{imp.Library, imp.Version}
+		if _, ok := index[key]; !ok {
+			index[key] = uint16(len(index) + 2)
+			var n *need
+			for _, prev := range needs {
+				if prev.library == imp.Library {
+					n = prev
+				}
+			}
+			if n == nil {
+				n = &need{library: imp.Library}
+				needs = append(needs, n)
+			}
+			n.versions = append(n.versions, imp.Version)
+		}
+		binary.Write(&versym, le, index[key])
+	}
+	for _, name := range e.Exports {
+		binary.Write(&dynsym, le, elf.Sym64{
+			Name:  str(name),
+			Info:  elf.ST_INFO(elf.STB_GLOBAL, elf.STT_FUNC),
+			Shndx: uint16(elf.SHN_ABS),
+		})
+		binary.Write(&versym, le, uint16(1))
+	}
+	var verneed bytes.Buffer
+	for i, n := range needs {
+		next := uint32(16 + 16*len(n.versions))
+		if i == len(needs)-1 {
+			next = 0
+		}
+		// Elf64_Verneed: vn_version, vn_cnt, vn_file, vn_aux, vn_next
+		binary.Write(&verneed, le, uint16(1))
+		binary.Write(&verneed, le, uint16(len(n.versions)))
+		binary.Write(&verneed, le, str(n.library))
+		binary.Write(&verneed, le, uint32(16))
+		binary.Write(&verneed, le, next)
+		for j, version := range n.versions {
+			next := uint32(16)
+			if j == len(n.versions)-1 {
+				next = 0
+			}
+			// Elf64_Vernaux: vna_hash, vna_flags, vna_other, vna_name, vna_next
+			binary.Write(&verneed, le, elfHash(version))
+			binary.Write(&verneed, le, uint16(0))
+			binary.Write(&verneed, le, index[[2]string{n.library, version}])
+			binary.Write(&verneed, le, str(version))
+			binary.Write(&verneed, le, next)
+		}
+	}
+
+	sections := []elfSection{{}}
+	if e.Interp != "" {
+		sections = append(sections, elfSection{name: ".interp", typ: elf.SHT_PROGBITS, data: []byte(e.Interp + "\x00"), prog: elf.PT_INTERP})
+	}
+	syms := len(e.Imports) + len(e.Exports)
+	if len(dyns) > 0 || syms > 0 {
+		binary.Write(&dynamic, le, elf.Dyn64{Tag: int64(elf.DT_NULL)})
+		// dynstr is complete: everything is added to it above.
+		dynstrIndex := uint32(len(sections))
+		sections = append(sections, elfSection{name: ".dynstr", typ: elf.SHT_STRTAB, data: dynstr})
+		if syms > 0 {
+			dynsymIndex := uint32(len(sections))
+			sections = append(sections, elfSection{name: ".dynsym", typ: elf.SHT_DYNSYM, link: dynstrIndex, info: 1, entsize: 24, data: dynsym.Bytes()})
+			sections = append(sections, elfSection{name: ".gnu.version", typ: elf.SHT_GNU_VERSYM, link: dynsymIndex, entsize: 2, data: versym.Bytes()})
+			if len(needs) > 0 {
+				sections = append(sections, elfSection{name: ".gnu.version_r", typ: elf.SHT_GNU_VERNEED, link: dynstrIndex, info: uint32(len(needs)), data: verneed.Bytes()})
+			}
+		}
+		sections = append(sections, elfSection{name: ".dynamic", typ: elf.SHT_DYNAMIC, link: dynstrIndex, entsize: 16, data: dynamic.Bytes(), prog: elf.PT_DYNAMIC})
+	}
+	return writeELF(e, sections)
+}
+
+func writeELF(e ELF, sections []elfSection) []byte {
+	le := binary.LittleEndian
+
+	sections = append(sections, elfSection{name: ".shstrtab", typ: elf.SHT_STRTAB})
+	shstrtab := []byte{0}
+	names := make([]uint32, len(sections))
+	for i := 1; i < len(sections); i++ {
+		names[i] = uint32(len(shstrtab))
+		shstrtab = append(shstrtab, sections[i].name+"\x00"...)
+	}
+	sections[len(sections)-1].data = shstrtab
+
+	var nprogs int
+	for _, s := range sections {
+		if s.prog != elf.PT_NULL {
+			nprogs++
+		}
+	}
+	align := func(off uint64) uint64 { return (off + 7) &^ 7 }
+	off := uint64(64 + 56*nprogs)
+	for i := 1; i < len(sections); i++ {
+		off = align(off)
+		sections[i].off = off
+		off += uint64(len(sections[i].data))
+	}
+	shoff := align(off)
+
+	var buf bytes.Buffer
+	hdr := elf.Header64{
+		Type:      uint16(e.Type),
+		Machine:   uint16(e.Machine),
+		Version:   uint32(elf.EV_CURRENT),
+		Shoff:     shoff,
+		Ehsize:    64,
+		Phentsize: 56,
+		Phnum:     uint16(nprogs),
+		Shentsize: 64,
+		Shnum:     uint16(len(sections)),
+		Shstrndx:  uint16(len(sections) - 1),
+	}
+	copy(hdr.Ident[:], elf.ELFMAG)
+	hdr.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	hdr.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	hdr.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+	hdr.Ident[elf.EI_OSABI] = byte(e.OSABI)
+	if nprogs > 0 {
+		hdr.Phoff = 64
+	}
+	binary.Write(&buf, le, hdr)
+	for _, s := range sections {
+		if s.prog == elf.PT_NULL {
+			continue
+		}
+		size := uint64(len(s.data))
+		binary.Write(&buf, le, elf.Prog64{
+			Type:   uint32(s.prog),
+			Flags:  uint32(elf.PF_R),
+			Off:    s.off,
+			Vaddr:  s.off,
+			Paddr:  s.off,
+			Filesz: size,
+			Memsz:  size,
+			Align:  8,
+		})
+	}
+	for _, s := range sections[1:] {
+		buf.Write(make([]byte, int(s.off)-buf.Len()))
+		buf.Write(s.data)
+	}
+	buf.Write(make([]byte, int(shoff)-buf.Len()))
+	for i, s := range sections {
+		if i == 0 {
+			binary.Write(&buf, le, elf.Section64{})
+			continue
+		}
+		binary.Write(&buf, le, elf.Section64{
+			Name:      names[i],
+			Type:      uint32(s.typ),
+			Off:       s.off,
+			Size:      uint64(len(s.data)),
+			Link:      s.link,
+			Info:      s.info,
+			Addralign: 8,
+			Entsize:   s.entsize,
+		})
+	}
+	return buf.Bytes()
+}
+
+// elfHash is the SysV hash of vna_hash.
+func elfHash(name string) uint32 {
+	var h uint32
+	for _, c := range []byte(name) {
+		h = h<<4 + uint32(c)
+		g := h & 0xf0000000
+		if g != 0 {
+			h ^= g >> 24
+		}
+		h &^= g
+	}
+	return h
+}
+
+// MachO is a little-endian 64-bit Mach-O file.
+type MachO struct {
+	Cpu    macho.Cpu
+	SubCpu uint32
+	Type   macho.Type
+	Flags  uint32
+	// Dylinker is the name of LC_LOAD_DYLINKER, if set.
+	Dylinker string
+	// Platform is the platform of LC_BUILD_VERSION, if set.
+	Platform uint32
+	// MinOS is the minos of LC_BUILD_VERSION, or the version of
+	// LC_VERSION_MIN_MACOSX, as xxxx.yy.zz. Zero is 11.0 and 10.0.
+	MinOS uint32
+	// VersionMin adds LC_VERSION_MIN_MACOSX.
+	VersionMin bool
+	// InstallName is the name of LC_ID_DYLIB, if set.
+	InstallName string
+	// Dylibs are the names of LC_LOAD_DYLIB.
+	Dylibs []string
+	// HeaderPad, if set, adds a __TEXT segment with a __text section
+	// this many bytes after the load commands.
+	HeaderPad uint32
+}
+
+// Bytes returns the file.
+func (m MachO) Bytes() []byte {
+	le := binary.LittleEndian
+	var loads [][]byte
+	load := func(cmd macho.LoadCmd, body []byte) {
+		body = append(body, make([]byte, (8-(8+len(body))%8)%8)...)
+		l := le.AppendUint32(nil, uint32(cmd))
+		l = le.AppendUint32(l, uint32(8+len(body)))
+		loads = append(loads, append(l, body...))
+	}
+	if m.Dylinker != "" {
+		// name.offset, name
+		load(LoadDylinker, append(le.AppendUint32(nil, 12), m.Dylinker+"\x00"...))
+	}
+	if m.Platform != 0 {
+		minOS := m.MinOS
+		if minOS == 0 {
+			minOS = 11 << 16
+		}
+		// platform, minos, sdk, ntools
+		body := le.AppendUint32(nil, m.Platform)
+		body = le.AppendUint32(body, minOS)
+		body = le.AppendUint32(body, 14<<16)
+		load(LoadBuildVersion, le.AppendUint32(body, 0))
+	}
+	if m.VersionMin {
+		version := m.MinOS
+		if version == 0 {
+			version = 10 << 16
+		}
+		// version, sdk
+		load(LoadVersionMinOS, le.AppendUint32(le.AppendUint32(nil, version), 14<<16))
+	}
+	dylib := func(cmd macho.LoadCmd, name string) {
+		// name.offset, timestamp, current_version, compatibility_version, name
+		body := le.AppendUint32(nil, 24)
+		body = le.AppendUint32(body, 2)
+		body = le.AppendUint32(body, 1<<16)
+		body = le.AppendUint32(body, 1<<16)
+		load(cmd, append(body, name+"\x00"...))
+	}
+	if m.InstallName != "" {
+		dylib(LoadIDDylib, m.InstallName)
+	}
+	for _, name := range m.Dylibs {
+		dylib(macho.LoadCmdDylib, name)
+	}
+
+	var cmdsz int
+	for _, l := range loads {
+		cmdsz += len(l)
+	}
+	var text []byte
+	if m.HeaderPad != 0 {
+		const segmentSize = 72 + 80 // segment_command_64 and a section_64
+		cmdsz += segmentSize
+		off := 32 + uint32(cmdsz) + m.HeaderPad
+		var seg bytes.Buffer
+		binary.Write(&seg, le, macho.Segment64{
+			Cmd:    macho.LoadCmdSegment64,
+			Len:    segmentSize,
+			Name:   [16]byte{'_', '_', 'T', 'E', 'X', 'T'},
+			Memsz:  uint64(off) + 4,
+			Filesz: uint64(off) + 4,
+			Nsect:  1,
+		})
+		binary.Write(&seg, le, macho.Section64{
+			Name:   [16]byte{'_', '_', 't', 'e', 'x', 't'},
+			Seg:    [16]byte{'_', '_', 'T', 'E', 'X', 'T'},
+			Addr:   uint64(off),
+			Size:   4,
+			Offset: off,
+		})
+		loads = append(loads, seg.Bytes())
+		text = append(make([]byte, m.HeaderPad), 0xc0, 0x03, 0x5f, 0xd6) // ret
+	}
+	var buf bytes.Buffer
+	binary.Write(&buf, le, macho.FileHeader{
+		Magic:  macho.Magic64,
+		Cpu:    m.Cpu,
+		SubCpu: m.SubCpu,
+		Type:   m.Type,
+		Ncmd:   uint32(len(loads)),
+		Cmdsz:  uint32(cmdsz),
+		Flags:  m.Flags,
+	})
+	buf.Write(make([]byte, 4)) // reserved
+	for _, l := range loads {
+		buf.Write(l)
+	}
+	buf.Write(text)
+	return buf.Bytes()
+}
+
+// PE is a PE32+ file without sections.
+type PE struct {
+	Machine            uint16
+	Characteristics    uint16
+	DllCharacteristics uint16
+}
+
+// Bytes returns the file.
+func (p PE) Bytes() []byte {
+	le := binary.LittleEndian
+	dos := make([]byte, 0x40)
+	copy(dos, "MZ")
+	le.PutUint32(dos[0x3c:], uint32(len(dos)))
+
+	var buf bytes.Buffer
+	buf.Write(dos)
+	buf.WriteString("PE\x00\x00")
+	binary.Write(&buf, le, pe.FileHeader{
+		Machine:              p.Machine,
+		SizeOfOptionalHeader: uint16(binary.Size(pe.OptionalHeader64{})),
+		Characteristics:      p.Characteristics,
+	})
+	binary.Write(&buf, le, pe.OptionalHeader64{
+		Magic:               0x20b,
+		DllCharacteristics:  p.DllCharacteristics,
+		NumberOfRvaAndSizes: 16,
+	})
+	return buf.Bytes()
+}
+
+// Wasm returns a WebAssembly module that imports a function and a memory
+// from every module in imports.
+func Wasm(imports ...string) []byte {
+	section := func(id byte, body []byte) []byte {
+		return append(binary.AppendUvarint([]byte{id}, uint64(len(body))), body...)
+	}
+	name := func(b []byte, s string) []byte {
+		return append(binary.AppendUvarint(b, uint64(len(s))), s...)
+	}
+
+	ret := []byte("\x00asm\x01\x00\x00\x00")
+	ret = append(ret, section(0, name(nil, "producers"))...)
+	// One type: () -> ()
+	ret = append(ret, section(1, []byte{1, 0x60, 0, 0})...)
+	body := binary.AppendUvarint(nil, uint64(2*len(imports)))
+	for _, module := range imports {
+		body = name(body, module)
+		body = name(body, "f")
+		body = append(body, 0x00, 0) // func, typeidx 0
+		body = name(body, module)
+		body = name(body, "memory")
+		body = append(body, 0x02, 1, 1, 2) // memory, limits {1, 2}
+	}
+	// The import section.
+	ret = append(ret, section(2, body)...)
+	return ret
+}
@@ -0,0 +1,137 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+package artifactcheck
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	// _wasmImportSection is the id of the import section.
+	_wasmImportSection = 2
+	// _wasiModule is the module that WASI imports are from.
+	_wasiModule = "wasi_snapshot_preview1"
+)
+
+// inspectWasm reads a WebAssembly module. Its OS is wasi if it imports
+// anything from WASI, and freestanding otherwise. Modules are always
+// executables.
+func inspectWasm(r io.ReaderAt) (Artifact, error) {
+	br := bufio.NewReader(io.NewSectionReader(r, 4, 1<<62))
+	var version uint32
+	if err := binary.Read(br, binary.LittleEndian, &version); err != nil {
+		return Artifact{}, fmt.Errorf("read wasm version: %w", err)
+	}
+	if version != 1 {
+		return Artifact{}, fmt.Errorf("unknown wasm version %d", version)
+	}
+
+	a := Artifact{Format: FormatWasm, Kind: KindExecutable, Arch: "wasm32", OS: "freestanding"}
+	for {
+		id, err := br.ReadByte()
+		if err == io.EOF {
+			return a, nil
+		}
+		if err != nil {
+			return Artifact{}, err
+		}
+		size, err := binary.ReadUvarint(br)
+		if err != nil {
+			return Artifact{}, fmt.Errorf("read wasm section %d: %w", id, err)
+		}
+		section := io.LimitReader(br, int64(size))
+		if id == _wasmImportSection {
+			modules, err := wasmImportModules(bufio.NewReader(section))
+			if err != nil {
+				return Artifact{}, fmt.Errorf("read wasm imports: %w", err)
+			}
+			if modules[_wasiModule] {
+				a.OS = "wasi"
+			}
+		}
+		if _, err := io.Copy(io.Discard, section); err != nil {
+			return Artifact{}, err
+		}
+	}
+}
+
+// wasmImportModules returns the modules of the imports in an import
+// section.
+func wasmImportModules(r *bufio.Reader) (map[string]bool, error) {
+	count, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	ret := make(map[string]bool)
+	for i := uint64(0); i < count; i++ {
+		module, err := wasmName(r)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := wasmName(r); err != nil {
+			return nil, err
+		}
+		ret[module] = true
+
+		kind, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		switch kind {
+		case 0x00: // func: typeidx
+			_, err = binary.ReadUvarint(r)
+		case 0x01: // table: reftype limits
+			if _, err = r.ReadByte(); err == nil {
+				err = wasmLimits(r)
+			}
+		case 0x02: // memory: limits
+			err = wasmLimits(r)
+		case 0x03: // global: valtype mut
+			_, err = r.Discard(2)
+		case 0x04: // tag: attribute typeidx
+			if _, err = r.ReadByte(); err == nil {
+				_, err = binary.ReadUvarint(r)
+			}
+		default:
+			err = fmt.Errorf("unknown import kind %#x", kind)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+func wasmName(r *bufio.Reader) (string, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return "", err
+	}
+	if n > 1<<16 {
+		return "", errors.New("name too long")
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+func wasmLimits(r *bufio.Reader) error {
+	flags, err := r.ReadByte()
+	if err != nil {
+		return err
+	}
+	if _, err := binary.ReadUvarint(r); err != nil {
+		return err
+	}
+	if flags&1 != 0 {
+		_, err = binary.ReadUvarint(r)
+	}
+	return err
+}
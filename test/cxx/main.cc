@@ -0,0 +1,21 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+// This file uses the parts of the C++ standard library that a binary would
+// otherwise need a shared libstdc++ or libc++ for: iostreams, threads and
+// exceptions. Zig links libc++ statically, so the binary must not need any.
+
+#include <iostream>
+#include <stdexcept>
+#include <thread>
+
+int main() {
+    std::thread t([] { std::cout << "Hello from a thread" << std::endl; });
+    t.join();
+    try {
+        throw std::runtime_error("caught");
+    } catch (const std::exception& e) {
+        std::cout << e.what() << std::endl;
+    }
+    return 0;
+}
@@ -0,0 +1,15 @@
+// Copyright 2025 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+// Links libadd.so, so that DT_NEEDED must record its soname rather than the
+// path that Bazel linked it from.
+
+#include <stdio.h>
+
+// Forward declaration to avoid needing a header file.
+extern int add(int a, int b);
+
+int main(void) {
+    printf("%d\n", add(1, 2));
+    return 0;
+}
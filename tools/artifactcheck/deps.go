@@ -0,0 +1,41 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+package main
+
+import (
+	"flag"
+	"io"
+	"strings"
+
+	"github.com/uber/hermetic_cc_toolchain/test/artifactcheck"
+)
+
+// runDeps is `artifactcheck deps`. It prints the interpreter and the
+// libraries that every file needs, and fails if a musl executable is not
+// static or a file needs libraries that are not part of its libc.
+func runDeps(args []string, stdout, stderr io.Writer) error {
+	var allow string
+	return fileCommand{
+		name: "deps",
+		usage: `usage: bazel run //tools/artifactcheck -- deps (-target <triple> | -platform <platform>) [-allow <libs>] <files>
+
+Prints the interpreter and the DT_NEEDED libraries of every ELF file.
+Fails if a musl executable is not static, or if a file needs a library
+that is not part of its libc (e.g. libstdc++.so.6) and not in -allow.
+
+`,
+		flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&allow, "allow", "", "comma-separated libraries that the files may also need, e.g. libgreeter.so.1")
+		},
+		check: func(path string, t artifactcheck.Target) (string, error) {
+			var allowed []string
+			if allow != "" {
+				allowed = strings.Split(allow, ",")
+			}
+			deps, err := artifactcheck.CheckDeps(path, t, allowed...)
+			return deps.String(), err
+		},
+		failure: "%d of %d files are not linked as expected for %s",
+	}.run(args, stdout, stderr)
+}
@@ -0,0 +1,86 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+package main
+
+import (
+	"bytes"
+	"debug/elf"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/hermetic_cc_toolchain/test/artifactcheck/testbin"
+)
+
+func TestRunDeps(t *testing.T) {
+	const interp = "/lib64/ld-linux-x86-64.so.2"
+	glibc := testbin.WriteFile(t, "glibc", testbin.ELF{
+		Machine: elf.EM_X86_64,
+		Type:    elf.ET_EXEC,
+		Interp:  interp,
+		Needed:  []string{"libgreeter.so.1", "libc.so.6"},
+	}.Bytes())
+	libstdcxx := testbin.WriteFile(t, "libstdcxx", testbin.ELF{
+		Machine: elf.EM_X86_64,
+		Type:    elf.ET_EXEC,
+		Interp:  interp,
+		Needed:  []string{"libstdc++.so.6", "libc.so.6"},
+	}.Bytes())
+	static := testbin.WriteFile(t, "static", testbin.ELF{Machine: elf.EM_X86_64, Type: elf.ET_EXEC}.Bytes())
+
+	tests := []struct {
+		name       string
+		args       []string
+		wantStdout string
+		wantErr    string
+	}{
+		{
+			name:       "musl",
+			args:       []string{"deps", "-platform", "linux_amd64_musl", static},
+			wantStdout: "ok\t" + static + ": static\n",
+		},
+		{
+			name:       "allow",
+			args:       []string{"deps", "-target", "x86_64-linux-gnu.2.28", "-allow", "libfoo.so,libgreeter.so.1", glibc},
+			wantStdout: "ok\t" + glibc + ": interpreter " + interp + ", needs libgreeter.so.1, libc.so.6\n",
+		},
+		{
+			name: "libstdc++",
+			args: []string{"deps", "-target", "x86_64-linux-gnu.2.28", static, libstdcxx},
+			wantStdout: "ok\t" + static + ": static\n" +
+				"FAIL\t" + libstdcxx + ": interpreter " + interp + ", needs libstdc++.so.6, libc.so.6\n",
+			wantErr: "1 of 2 files are not linked as expected for x86_64-linux-gnu.2.28:\n" +
+				libstdcxx + " needs libstdc++.so.6, which is not part of glibc",
+		},
+		{
+			name:    "not static",
+			args:    []string{"deps", "-target", "x86_64-linux-musl", glibc},
+			wantErr: glibc + " is not static: interpreter " + interp + ", needs libgreeter.so.1, libc.so.6",
+		},
+		{
+			name:    "no target",
+			args:    []string{"deps", static},
+			wantErr: "deps: -target or -platform is required",
+		},
+		{
+			name:    "no files",
+			args:    []string{"deps", "-target", "x86_64-linux-musl"},
+			wantErr: "deps: no files to check",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			err := run(tt.args, &stdout, &stderr)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			if tt.wantStdout != "" {
+				assert.Equal(t, tt.wantStdout, stdout.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/uber/hermetic_cc_toolchain/test/artifactcheck"
+)
+
+// runGlibc is `artifactcheck glibc`. It prints the highest GLIBC_ and
+// GLIBCXX_ versions that every file needs, and fails if any needs a glibc
+// newer than the one of the target.
+func runGlibc(args []string, stdout, stderr io.Writer) error {
+	return fileCommand{
+		name: "glibc",
+		usage: `usage: bazel run //tools/artifactcheck -- glibc (-target <triple> | -platform <platform>) <files>
+
+Prints the highest GLIBC_ and GLIBCXX_ symbol versions that every ELF file
+needs. Fails if a file needs a glibc newer than the one of the target, or
+any glibc at all for musl targets.
+
+`,
+		check: func(path string, t artifactcheck.Target) (string, error) {
+			needs, err := artifactcheck.CheckGlibc(path, t)
+			return fmt.Sprintf("glibc %s, libstdc++ %s", needs.Glibc, needs.Glibcxx), err
+		},
+		failure: "%d of %d files do not run on %s",
+	}.run(args, stdout, stderr)
+}
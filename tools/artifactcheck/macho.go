@@ -0,0 +1,42 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/uber/hermetic_cc_toolchain/test/artifactcheck"
+)
+
+// runMachO is `artifactcheck macho`. It prints the macOS that every file
+// needs, its install name and its header padding, and fails if a file
+// would not load on the macOS of -min-os, or install_name_tool could not
+// rewrite its dylib paths.
+func runMachO(args []string, stdout, stderr io.Writer) error {
+	var contract artifactcheck.MachOContract
+	return fileCommand{
+		name: "macho",
+		usage: `usage: bazel run //tools/artifactcheck -- macho (-target <triple> | -platform <platform>) [-min-os <version>] [-install-name <name>] <files>
+
+Prints the macOS that every Mach-O file needs, its install name and its
+header padding. Fails if a file is not for every CPU of the target arch,
+needs a macOS newer than -min-os, is a dylib without an install name (or
+another one than -install-name), or has too little header padding for
+install_name_tool to rewrite its dylib paths.
+
+`,
+		flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&contract.MinOS, "min-os", "", "the newest macOS that the files may need, e.g. 13.0")
+			fs.StringVar(&contract.InstallName, "install-name", "", "the file name of the install name of dylibs, e.g. libadd.dylib")
+		},
+		check: func(path string, t artifactcheck.Target) (string, error) {
+			m, err := artifactcheck.CheckMachO(path, t, contract)
+			return fmt.Sprintf("macOS %s, install name %q, header padding %d bytes, %d needed",
+				m.MinOS, m.InstallName, m.HeaderPad, m.Growth), err
+		},
+		failure: "%d of %d files fail the Mach-O checks for %s",
+	}.run(args, stdout, stderr)
+}
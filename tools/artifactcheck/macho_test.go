@@ -0,0 +1,78 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+package main
+
+import (
+	"bytes"
+	"debug/macho"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/hermetic_cc_toolchain/test/artifactcheck/testbin"
+)
+
+func TestRunMachO(t *testing.T) {
+	dylib := testbin.MachO{
+		Cpu:         macho.CpuArm64,
+		Type:        macho.TypeDylib,
+		Platform:    1,
+		MinOS:       13 << 16,
+		InstallName: "@rpath/libadd.dylib",
+		Dylibs:      []string{"/usr/lib/libSystem.B.dylib"},
+		HeaderPad:   2048,
+	}
+	lib := testbin.WriteFile(t, "libadd.dylib", dylib.Bytes())
+	dylib.HeaderPad = 64
+	unpadded := testbin.WriteFile(t, "libunpadded.dylib", dylib.Bytes())
+
+	tests := []struct {
+		name       string
+		args       []string
+		wantStdout string
+		wantErr    string
+	}{
+		{
+			name:       "ok",
+			args:       []string{"macho", "-platform", "darwin_arm64", "-min-os", "13.0", "-install-name", "libadd.dylib", lib},
+			wantStdout: "ok\t" + lib + `: macOS 13.0, install name "@rpath/libadd.dylib", header padding 2048 bytes, 2008 needed` + "\n",
+		},
+		{
+			name:    "min os",
+			args:    []string{"macho", "-target", "aarch64-macos-none", "-min-os", "12.0", lib},
+			wantErr: lib + ": needs macOS 13.0, newer than 12.0",
+		},
+		{
+			name: "header padding",
+			args: []string{"macho", "-target", "aarch64-macos-none", lib, unpadded},
+			wantStdout: "ok\t" + lib + `: macOS 13.0, install name "@rpath/libadd.dylib", header padding 2048 bytes, 2008 needed` + "\n" +
+				"FAIL\t" + unpadded + `: macOS 13.0, install name "@rpath/libadd.dylib", header padding 64 bytes, 2008 needed` + "\n",
+			wantErr: "1 of 2 files fail the Mach-O checks for aarch64-macos-none:\n",
+		},
+		{
+			name:    "arch",
+			args:    []string{"macho", "-platform", "macos_x86_64", lib},
+			wantErr: "cpu is CpuArm64, want CpuAmd64",
+		},
+		{
+			name:    "no files",
+			args:    []string{"macho", "-target", "aarch64-macos-none"},
+			wantErr: "macho: no files to check",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			err := run(tt.args, &stdout, &stderr)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			if tt.wantStdout != "" {
+				assert.Equal(t, tt.wantStdout, stdout.String())
+			}
+		})
+	}
+}
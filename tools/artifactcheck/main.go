@@ -0,0 +1,154 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+// artifactcheck checks binaries built with hermetic_cc_toolchain against
+// their zig target, without running them. It is the command line of
+// //test/artifactcheck, for checking artifacts outside of its tests.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/uber/hermetic_cc_toolchain/test/artifactcheck"
+)
+
+const _usage = `usage: bazel run //tools/artifactcheck -- <command> [flags] <files>
+
+Commands:
+  deps   check that linux binaries need only the libraries of their libc
+  glibc  check that linux binaries need no glibc newer than their target's
+  macho  check the cpu, macOS version, install name and header padding of
+         macOS binaries
+
+Run a command with -h for its flags.
+`
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdout, stderr io.Writer) error {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, _usage)
+		return errors.New("missing command")
+	}
+	switch args[0] {
+	case "deps":
+		return runDeps(args[1:], stdout, stderr)
+	case "glibc":
+		return runGlibc(args[1:], stdout, stderr)
+	case "macho":
+		return runMachO(args[1:], stdout, stderr)
+	case "-h", "-help", "--help", "help":
+		fmt.Fprint(stdout, _usage)
+		return nil
+	default:
+		fmt.Fprint(stderr, _usage)
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+}
+
+// resolve returns path relative to the directory of `bazel run`, which
+// runs the tool in its runfiles.
+func resolve(path string) string {
+	if wd := os.Getenv("BUILD_WORKING_DIRECTORY"); wd != "" && !filepath.IsAbs(path) {
+		return filepath.Join(wd, path)
+	}
+	return path
+}
+
+// fileCommand is a command that checks each of its files against the
+// target of its -target or -platform flag.
+type fileCommand struct {
+	name  string
+	usage string
+
+	// flags registers the flags of the command other than -target and
+	// -platform.
+	flags func(fs *flag.FlagSet)
+
+	// check checks the file at path, and returns what to print about it,
+	// e.g. the versions it needs.
+	check func(path string, t artifactcheck.Target) (string, error)
+
+	// failure is the format of the error of the failed files. Its
+	// operands are the number of failed files, the number of files and
+	// the target.
+	failure string
+}
+
+// run parses args and checks each file, printing one line per file. It
+// fails if any file does.
+func (c fileCommand) run(args []string, stdout, stderr io.Writer) error {
+	var tf targetFlags
+
+	fs := flag.NewFlagSet(c.name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	tf.register(fs)
+	if c.flags != nil {
+		c.flags(fs)
+	}
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), c.usage)
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("%s: no files to check", c.name)
+	}
+	t, err := tf.parse(c.name)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, path := range fs.Args() {
+		report, err := c.check(resolve(path), t)
+		status := "ok"
+		if err != nil {
+			errs = append(errs, err)
+			status = "FAIL"
+		}
+		fmt.Fprintf(stdout, "%s\t%s: %s\n", status, path, report)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf(c.failure+":\n%w", len(errs), fs.NArg(), t, errors.Join(errs...))
+	}
+	return nil
+}
+
+// targetFlags are the -target and -platform flags of the commands.
+type targetFlags struct {
+	target   string
+	platform string
+}
+
+func (f *targetFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.target, "target", "", "zig target triple of the files, e.g. x86_64-linux-gnu.2.28")
+	fs.StringVar(&f.platform, "platform", "", "platform of the files instead of -target, e.g. @zig_sdk//libc_aware/platform:linux_amd64_gnu.2.28")
+}
+
+// parse returns the target of exactly one of -target and -platform.
+func (f *targetFlags) parse(cmd string) (artifactcheck.Target, error) {
+	switch {
+	case f.target != "" && f.platform != "":
+		return artifactcheck.Target{}, fmt.Errorf("%s: -target and -platform are mutually exclusive", cmd)
+	case f.target != "":
+		return artifactcheck.ParseTarget(f.target)
+	case f.platform != "":
+		return artifactcheck.ParsePlatform(f.platform)
+	default:
+		return artifactcheck.Target{}, fmt.Errorf("%s: -target or -platform is required", cmd)
+	}
+}
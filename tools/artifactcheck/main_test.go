@@ -0,0 +1,113 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+package main
+
+import (
+	"bytes"
+	"debug/elf"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/hermetic_cc_toolchain/test/artifactcheck/testbin"
+)
+
+func TestRun(t *testing.T) {
+	glibc := testbin.WriteFile(t, "glibc", testbin.ELF{
+		Machine: elf.EM_X86_64,
+		Type:    elf.ET_EXEC,
+		Interp:  "/lib64/ld-linux-x86-64.so.2",
+		Needed:  []string{"libc.so.6"},
+		Imports: []testbin.Import{
+			{Name: "printf", Library: "libc.so.6", Version: "GLIBC_2.2.5"},
+			{Name: "fcntl64", Library: "libc.so.6", Version: "GLIBC_2.28"},
+			{Name: "_ZNSt6thread15_M_start_threadE", Library: "libstdc++.so.6", Version: "GLIBCXX_3.4.22"},
+		},
+	}.Bytes())
+	musl := testbin.WriteFile(t, "musl", testbin.ELF{Machine: elf.EM_X86_64, Type: elf.ET_EXEC}.Bytes())
+
+	tests := []struct {
+		name       string
+		args       []string
+		wantStdout string
+		wantErr    string
+	}{
+		{
+			name:       "glibc",
+			args:       []string{"glibc", "-target", "x86_64-linux-gnu.2.28", glibc},
+			wantStdout: "ok\t" + glibc + ": glibc GLIBC_2.28 (fcntl64), libstdc++ GLIBCXX_3.4.22 (_ZNSt6thread15_M_start_threadE)\n",
+		},
+		{
+			name:       "platform",
+			args:       []string{"glibc", "-platform", "@zig_sdk//libc_aware/platform:linux_amd64_musl", musl},
+			wantStdout: "ok\t" + musl + ": glibc none, libstdc++ none\n",
+		},
+		{
+			name: "too new",
+			args: []string{"glibc", "-platform", "linux_amd64_gnu.2.17", musl, glibc},
+			wantStdout: "ok\t" + musl + ": glibc none, libstdc++ none\n" +
+				"FAIL\t" + glibc + ": glibc GLIBC_2.28 (fcntl64), libstdc++ GLIBCXX_3.4.22 (_ZNSt6thread15_M_start_threadE)\n",
+			wantErr: "1 of 2 files do not run on x86_64-linux-gnu.2.17:\n" +
+				glibc + " needs GLIBC_2.28 (fcntl64), newer than glibc 2.17 of x86_64-linux-gnu.2.17",
+		},
+		{
+			name:    "missing",
+			args:    []string{"glibc", "-target", "x86_64-linux-musl", glibc + ".missing"},
+			wantErr: "no such file or directory",
+		},
+		{
+			name:    "ambiguous platform",
+			args:    []string{"glibc", "-platform", "//platform:linux_amd64", glibc},
+			wantErr: "does not name a libc",
+		},
+		{
+			name:    "no target",
+			args:    []string{"glibc", glibc},
+			wantErr: "glibc: -target or -platform is required",
+		},
+		{
+			name:    "target and platform",
+			args:    []string{"glibc", "-target", "x86_64-linux-musl", "-platform", "linux_amd64_musl", glibc},
+			wantErr: "mutually exclusive",
+		},
+		{
+			name:    "no files",
+			args:    []string{"glibc", "-target", "x86_64-linux-musl"},
+			wantErr: "glibc: no files to check",
+		},
+		{
+			name:    "no command",
+			wantErr: "missing command",
+		},
+		{
+			name:    "unknown command",
+			args:    []string{"ldd"},
+			wantErr: `unknown command "ldd"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			err := run(tt.args, &stdout, &stderr)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			if tt.wantStdout != "" {
+				assert.Equal(t, tt.wantStdout, stdout.String())
+			}
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	t.Setenv("BUILD_WORKING_DIRECTORY", "/work")
+	assert.Equal(t, filepath.Join("/work", "bazel-bin", "main"), resolve("bazel-bin/main"))
+	assert.Equal(t, "/tmp/main", resolve("/tmp/main"))
+
+	t.Setenv("BUILD_WORKING_DIRECTORY", "")
+	assert.Equal(t, "bazel-bin/main", resolve("bazel-bin/main"))
+}
@@ -0,0 +1,277 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+// Package bzlconfig reads (and updates) typed top-level constants of .bzl
+// files, like:
+//
+//	VERSION = "0.15.2"
+//	HOST_PLATFORM_SHA256 = {"linux-x86_64": "...", ...}
+//	_GLIBCS = ["2.17", "2.18", ...]
+//
+// Errors point to the offending expression as path:line:col.
+package bzlconfig
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	bzl "github.com/bazelbuild/buildtools/build"
+)
+
+// ErrNotFound is returned (wrapped) when a constant is not defined.
+var ErrNotFound = errors.New("not found")
+
+// Error is an error about an expression in a .bzl file.
+type Error struct {
+	Path string
+	Line int
+	Col  int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %s", e.Path, e.Line, e.Col, e.Msg)
+}
+
+// File is a parsed .bzl file.
+type File struct {
+	path   string
+	parsed *bzl.File
+	assign map[string]*bzl.AssignExpr
+}
+
+// Read reads and parses the .bzl file at fpath.
+func Read(fpath string) (*File, error) {
+	data, err := os.ReadFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(fpath, data)
+}
+
+// Parse parses the contents of a .bzl file. fpath is only used in errors.
+func Parse(fpath string, data []byte) (*File, error) {
+	parsed, err := bzl.Parse(fpath, data)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &File{
+		path:   fpath,
+		parsed: parsed,
+		assign: make(map[string]*bzl.AssignExpr),
+	}
+	for _, stmt := range parsed.Stmt {
+		def, ok := stmt.(*bzl.AssignExpr)
+		if !ok || def.Op != "=" {
+			continue
+		}
+		key, ok := def.LHS.(*bzl.Ident)
+		if !ok {
+			continue
+		}
+		if prev, ok := f.assign[key.Name]; ok {
+			start, _ := prev.Span()
+			return nil, f.errorf(def, "%s is already defined at line %d", key.Name, start.Line)
+		}
+		f.assign[key.Name] = def
+	}
+
+	return f, nil
+}
+
+// Path returns the path of the file, as given to Read or Parse.
+func (f *File) Path() string {
+	return f.path
+}
+
+// Has returns whether name is defined.
+func (f *File) Has(name string) bool {
+	_, ok := f.assign[name]
+	return ok
+}
+
+// String returns the value of `name = "..."`.
+func (f *File) String(name string) (string, error) {
+	str, err := f.stringExpr(name)
+	if err != nil {
+		return "", err
+	}
+	return str.Value, nil
+}
+
+// StringList returns the value of `name = ["...", ...]`.
+func (f *File) StringList(name string) ([]string, error) {
+	list, err := f.rhs(name)
+	if err != nil {
+		return nil, err
+	}
+	l, ok := list.(*bzl.ListExpr)
+	if !ok {
+		return nil, f.errorf(list, "%s: got %s, want a list of strings", name, kind(list))
+	}
+
+	ret := make([]string, 0, len(l.List))
+	for _, elem := range l.List {
+		str, ok := elem.(*bzl.StringExpr)
+		if !ok {
+			return nil, f.errorf(elem, "%s: got %s in a list of strings", name, kind(elem))
+		}
+		ret = append(ret, str.Value)
+	}
+	return ret, nil
+}
+
+// StringDict returns the value of `name = {"...": "...", ...}`.
+func (f *File) StringDict(name string) (map[string]string, error) {
+	dict, err := f.dictExpr(name)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make(map[string]string, len(dict.List))
+	for _, kv := range dict.List {
+		k, ok := kv.Key.(*bzl.StringExpr)
+		if !ok {
+			return nil, f.errorf(kv.Key, "%s: got %s as a key, want a string", name, kind(kv.Key))
+		}
+		v, ok := kv.Value.(*bzl.StringExpr)
+		if !ok {
+			return nil, f.errorf(kv.Value, "%s[%q]: got %s, want a string", name, k.Value, kind(kv.Value))
+		}
+		if _, ok := ret[k.Value]; ok {
+			return nil, f.errorf(kv.Key, "%s: duplicate key %q", name, k.Value)
+		}
+		ret[k.Value] = v.Value
+	}
+	return ret, nil
+}
+
+// SetString changes the value of `name = "..."`.
+func (f *File) SetString(name, value string) error {
+	str, err := f.stringExpr(name)
+	if err != nil {
+		return err
+	}
+	setString(str, value)
+	return nil
+}
+
+// SetStringDictValues changes the values of `name = {"...": "...", ...}`.
+// values must have exactly the keys that are already in the dict.
+func (f *File) SetStringDictValues(name string, values map[string]string) error {
+	old, err := f.StringDict(name)
+	if err != nil {
+		return err
+	}
+
+	var missing, extra []string
+	for k := range old {
+		if _, ok := values[k]; !ok {
+			missing = append(missing, k)
+		}
+	}
+	for k := range values {
+		if _, ok := old[k]; !ok {
+			extra = append(extra, k)
+		}
+	}
+	sort.Strings(missing)
+	sort.Strings(extra)
+	if len(missing) > 0 {
+		return fmt.Errorf("%s: %s: no new value for %q", f.path, name, missing)
+	}
+	if len(extra) > 0 {
+		return fmt.Errorf("%s: %s: %q are not in the dict", f.path, name, extra)
+	}
+
+	// StringDict checked that the keys and values are strings.
+	dict, _ := f.dictExpr(name)
+	for _, kv := range dict.List {
+		k := kv.Key.(*bzl.StringExpr)
+		setString(kv.Value.(*bzl.StringExpr), values[k.Value])
+	}
+	return nil
+}
+
+// Format returns the file, with any changes, formatted like buildifier
+// would. Comments are kept.
+func (f *File) Format() []byte {
+	return bzl.Format(f.parsed)
+}
+
+func (f *File) rhs(name string) (bzl.Expr, error) {
+	def, ok := f.assign[name]
+	if !ok {
+		return nil, fmt.Errorf("%s: %s %w", f.path, name, ErrNotFound)
+	}
+	return def.RHS, nil
+}
+
+func (f *File) stringExpr(name string) (*bzl.StringExpr, error) {
+	rhs, err := f.rhs(name)
+	if err != nil {
+		return nil, err
+	}
+	str, ok := rhs.(*bzl.StringExpr)
+	if !ok {
+		return nil, f.errorf(rhs, "%s: got %s, want a string", name, kind(rhs))
+	}
+	return str, nil
+}
+
+func (f *File) dictExpr(name string) (*bzl.DictExpr, error) {
+	rhs, err := f.rhs(name)
+	if err != nil {
+		return nil, err
+	}
+	dict, ok := rhs.(*bzl.DictExpr)
+	if !ok {
+		return nil, f.errorf(rhs, "%s: got %s, want a dict of strings", name, kind(rhs))
+	}
+	return dict, nil
+}
+
+func (f *File) errorf(expr bzl.Expr, format string, args ...any) error {
+	start, _ := expr.Span()
+	return &Error{
+		Path: f.path,
+		Line: start.Line,
+		Col:  start.LineRune,
+		Msg:  fmt.Sprintf(format, args...),
+	}
+}
+
+func setString(str *bzl.StringExpr, value string) {
+	str.Value = value
+	// Token is the original quoting of Value, which no longer applies.
+	str.Token = ""
+}
+
+// kind describes expr for error messages.
+func kind(expr bzl.Expr) string {
+	switch expr.(type) {
+	case *bzl.StringExpr:
+		return "a string"
+	case *bzl.LiteralExpr:
+		return "a literal"
+	case *bzl.Ident:
+		return "an identifier"
+	case *bzl.ListExpr:
+		return "a list"
+	case *bzl.TupleExpr:
+		return "a tuple"
+	case *bzl.DictExpr:
+		return "a dict"
+	case *bzl.CallExpr:
+		return "a function call"
+	case *bzl.BinaryExpr:
+		return "a binary expression"
+	case *bzl.Comprehension:
+		return "a comprehension"
+	default:
+		return fmt.Sprintf("%T", expr)
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+package bzlconfig
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const _defs = `load(":other.bzl", "other")
+
+# The version.
+VERSION = "0.15.2"
+
+HOST_PLATFORM_SHA256 = {
+    "linux-x86_64": "aa",
+    # comments are kept
+    "macos-aarch64": "bb",
+}
+
+_GLIBCS = [
+    "2.17",
+    "2.18",
+]
+
+LIBCS = ["musl"] + ["gnu.{}".format(glibc) for glibc in _GLIBCS]
+
+_NOT_STRINGS = {
+    "a": 1,
+}
+
+def fn(x):
+    y = x
+    return y
+`
+
+func TestRead(t *testing.T) {
+	f, err := Parse("defs.bzl", []byte(_defs))
+	require.NoError(t, err)
+
+	version, err := f.String("VERSION")
+	require.NoError(t, err)
+	assert.Equal(t, "0.15.2", version)
+
+	sha256s, err := f.StringDict("HOST_PLATFORM_SHA256")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"linux-x86_64": "aa", "macos-aarch64": "bb"}, sha256s)
+
+	glibcs, err := f.StringList("_GLIBCS")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2.17", "2.18"}, glibcs)
+
+	assert.True(t, f.Has("LIBCS"))
+	assert.False(t, f.Has("y"), "only top-level constants are read")
+}
+
+func TestReadErrors(t *testing.T) {
+	f, err := Parse("defs.bzl", []byte(_defs))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		read    func() error
+		wantErr string
+	}{
+		{
+			name:    "not found",
+			read:    func() error { _, err := f.String("MISSING"); return err },
+			wantErr: "defs.bzl: MISSING not found",
+		},
+		{
+			name:    "string is a dict",
+			read:    func() error { _, err := f.String("HOST_PLATFORM_SHA256"); return err },
+			wantErr: "defs.bzl:6:24: HOST_PLATFORM_SHA256: got a dict, want a string",
+		},
+		{
+			name:    "list is a binary expression",
+			read:    func() error { _, err := f.StringList("LIBCS"); return err },
+			wantErr: "defs.bzl:17:9: LIBCS: got a binary expression, want a list of strings",
+		},
+		{
+			name:    "dict value is not a string",
+			read:    func() error { _, err := f.StringDict("_NOT_STRINGS"); return err },
+			wantErr: `defs.bzl:20:10: _NOT_STRINGS["a"]: got a literal, want a string`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.EqualError(t, tt.read(), tt.wantErr)
+		})
+	}
+
+	_, err = f.String("MISSING")
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	_, err = f.String("VERSION")
+	assert.False(t, errors.Is(err, ErrNotFound))
+}
+
+func TestParseErrors(t *testing.T) {
+	_, err := Parse("defs.bzl", []byte("A = \"a\"\n\nA = \"b\"\n"))
+	assert.EqualError(t, err, "defs.bzl:3:1: A is already defined at line 1")
+
+	var bzlErr *Error
+	require.ErrorAs(t, err, &bzlErr)
+	assert.Equal(t, 3, bzlErr.Line)
+}
+
+func TestSet(t *testing.T) {
+	f, err := Parse("defs.bzl", []byte(_defs))
+	require.NoError(t, err)
+
+	require.NoError(t, f.SetString("VERSION", "0.16.0"))
+	require.NoError(t, f.SetStringDictValues("HOST_PLATFORM_SHA256", map[string]string{
+		"linux-x86_64":  "cc",
+		"macos-aarch64": "dd",
+	}))
+
+	want := strings.NewReplacer(
+		`VERSION = "0.15.2"`, `VERSION = "0.16.0"`,
+		`"linux-x86_64": "aa"`, `"linux-x86_64": "cc"`,
+		`"macos-aarch64": "bb"`, `"macos-aarch64": "dd"`,
+	).Replace(_defs)
+	assert.Equal(t, want, string(f.Format()))
+
+	err = f.SetStringDictValues("HOST_PLATFORM_SHA256", map[string]string{"linux-x86_64": "ee"})
+	assert.EqualError(t, err, `defs.bzl: HOST_PLATFORM_SHA256: no new value for ["macos-aarch64"]`)
+
+	err = f.SetStringDictValues("HOST_PLATFORM_SHA256", map[string]string{
+		"linux-x86_64":  "ee",
+		"macos-aarch64": "ff",
+		"linux-riscv64": "00",
+	})
+	assert.EqualError(t, err, `defs.bzl: HOST_PLATFORM_SHA256: ["linux-riscv64"] are not in the dict`)
+
+	assert.ErrorContains(t, f.SetString("_GLIBCS", "2.17"), "_GLIBCS: got a list, want a string")
+}
@@ -0,0 +1,173 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+// Package zigsdk reads the Zig SDK definition of hermetic_cc_toolchain from
+// toolchain/private/zig_sdk.bzl and toolchain/defs.bzl.
+package zigsdk
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/uber/hermetic_cc_toolchain/tools/internal/bzlconfig"
+)
+
+const (
+	// ZigSDKPath defines the Zig SDK version and its sha256s, relative to
+	// the repository root.
+	ZigSDKPath = "toolchain/private/zig_sdk.bzl"
+	// DefsPath defines the archive extension of every host platform,
+	// relative to the repository root.
+	DefsPath = "toolchain/defs.bzl"
+
+	// HostSHA256Var is the sha256 of every host platform in ZigSDKPath.
+	HostSHA256Var = "HOST_PLATFORM_SHA256"
+	// HostExtVar is the archive extension of every host platform in
+	// DefsPath.
+	HostExtVar = "_HOST_PLATFORM_EXT"
+
+	// BazelMirror mirrors ZigDownloads.
+	BazelMirror = "https://mirror.bazel.build/ziglang.org/"
+	// ZigDownloads is where ziglang.org publishes the SDK.
+	ZigDownloads = "https://ziglang.org/"
+)
+
+// Upstream is where the Zig SDK is downloaded from.
+type Upstream struct {
+	Version     string // e.g. 0.11.0-dev.2619+bd3e248c7
+	URLTemplate string // https://mirror.bazel.build/ziglang.org/builds/zig-{zig_platform}-{version}.{_ext}
+}
+
+// IsDev is true for nightly Zig versions, e.g. 0.11.0-dev.2619+bd3e248c7.
+func (u Upstream) IsDev() bool {
+	return strings.Contains(u.Version, "dev")
+}
+
+// URLFormats returns the URL formats toolchain/defs.bzl downloads the Zig
+// SDK from, in order of preference.
+func (u Upstream) URLFormats() []string {
+	if !u.IsDev() {
+		return []string{u.URLTemplate}
+	}
+	return []string{
+		u.URLTemplate,
+		strings.Replace(u.URLTemplate, BazelMirror, ZigDownloads, 1),
+	}
+}
+
+// URL expands the URL format like toolchain/defs.bzl does. hostPlatform is
+// {os}-{arch}, e.g. linux-x86_64.
+func URL(format, version, hostPlatform, ext string) string {
+	hostOS, hostArch, _ := strings.Cut(hostPlatform, "-")
+	return strings.NewReplacer(
+		"{version}", version,
+		"{host_platform}", hostPlatform,
+		"{zig_platform}", hostArch+"-"+hostOS,
+		"{_ext}", ext,
+	).Replace(format)
+}
+
+// ParseUpstream parses "VERSION" from toolchain/private/zig_sdk.bzl
+func ParseUpstream(defsPath string) (Upstream, error) {
+	f, err := bzlconfig.Read(defsPath)
+	if err != nil {
+		return Upstream{}, err
+	}
+	return upstream(f)
+}
+
+// ParseUpstreamData is ParseUpstream for contents that are already read,
+// e.g. from a tag.
+func ParseUpstreamData(defsPath string, data []byte) (Upstream, error) {
+	f, err := bzlconfig.Parse(defsPath, data)
+	if err != nil {
+		return Upstream{}, err
+	}
+	return upstream(f)
+}
+
+func upstream(f *bzlconfig.File) (Upstream, error) {
+	var ret Upstream
+
+	version, err := f.String("VERSION")
+	if err != nil {
+		return ret, err
+	}
+	ret.Version = version
+
+	formatVar, mirror := "URL_FORMAT_RELEASE", false
+	if ret.IsDev() {
+		formatVar, mirror = "URL_FORMAT_NIGHTLY", true
+	}
+	format, err := f.String(formatVar)
+	if errors.Is(err, bzlconfig.ErrNotFound) {
+		return ret, fmt.Errorf("url format for %q not found: %w", ret.Version, err)
+	}
+	if err != nil {
+		return ret, err
+	}
+	if mirror {
+		format = strings.Replace(format, ZigDownloads, BazelMirror, 1)
+	}
+	ret.URLTemplate = format
+
+	return ret, nil
+}
+
+// HostPlatforms are the Zig SDK archives for every host platform. The keys
+// are {os}-{arch}, like host_platform in toolchain/defs.bzl.
+type HostPlatforms struct {
+	SHA256 map[string]string // from HOST_PLATFORM_SHA256 in zig_sdk.bzl
+	Ext    map[string]string // from _HOST_PLATFORM_EXT in defs.bzl
+}
+
+// Names returns the sorted host platforms.
+func (p HostPlatforms) Names() []string {
+	ret := make([]string, 0, len(p.SHA256))
+	for name := range p.SHA256 {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// ParseHostPlatforms parses the per-host-platform dicts and checks that
+// every host platform has both a sha256 and an archive extension.
+func ParseHostPlatforms(zigSDKPath, defsPath string) (HostPlatforms, error) {
+	var ret HostPlatforms
+
+	zigSDK, err := bzlconfig.Read(zigSDKPath)
+	if err != nil {
+		return ret, err
+	}
+	defs, err := bzlconfig.Read(defsPath)
+	if err != nil {
+		return ret, err
+	}
+
+	sha256s, err := zigSDK.StringDict(HostSHA256Var)
+	if err != nil {
+		return ret, err
+	}
+	exts, err := defs.StringDict(HostExtVar)
+	if err != nil {
+		return ret, err
+	}
+
+	for platform := range sha256s {
+		if _, ok := exts[platform]; !ok {
+			return ret, fmt.Errorf("%s has no %s in %s", platform, HostExtVar, defsPath)
+		}
+	}
+	for platform := range exts {
+		if _, ok := sha256s[platform]; !ok {
+			return ret, fmt.Errorf("%s has no %s in %s", platform, HostSHA256Var, zigSDKPath)
+		}
+	}
+
+	ret.SHA256 = sha256s
+	ret.Ext = exts
+	return ret, nil
+}
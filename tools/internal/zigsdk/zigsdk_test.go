@@ -0,0 +1,120 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+package zigsdk
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseZigVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		want     Upstream
+		wantErr  string
+	}{
+		{
+			name:     "released url",
+			contents: `VERSION = "0.11.0"; URL_FORMAT_RELEASE = "https://ziglang.org/download/{version}/zig-{host_platform}-{version}.{_ext}"`,
+			want: Upstream{
+				Version:     "0.11.0",
+				URLTemplate: "https://ziglang.org/download/{version}/zig-{host_platform}-{version}.{_ext}",
+			},
+		},
+		{
+			name:     "nightly url",
+			contents: `VERSION = "0.11.0-dev.2619+bd3e248c7"; URL_FORMAT_NIGHTLY = "https://ziglang.org/builds/zig-{host_platform}-{version}.{_ext}"`,
+			want: Upstream{
+				Version:     "0.11.0-dev.2619+bd3e248c7",
+				URLTemplate: "https://mirror.bazel.build/ziglang.org/builds/zig-{host_platform}-{version}.{_ext}",
+			},
+		},
+		{
+			name:     "not an assignment",
+			contents: `def VERSION(x): return x`,
+			wantErr:  "VERSION not found",
+		},
+		{
+			name:     "missing version assignment",
+			contents: "x1 = 1",
+			wantErr:  "VERSION not found",
+		},
+		{
+			name:     "non-string version",
+			contents: "x1 = 1\nVERSION = 1",
+			wantErr:  "toolchain.defs:2:11: VERSION: got a literal, want a string",
+		},
+		{
+			name:     "missing url assignment",
+			contents: `VERSION = "0.11.0"; URL_FORMAT_NIGHTLY = "https://ziglang.org/builds/zig-{host_platform}-{version}.{_ext}"`,
+			wantErr:  `url format for "0.11.0" not found`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			fname := path.Join(dir, "toolchain.defs")
+			require.NoError(t, os.WriteFile(fname, []byte(tt.contents), 0644))
+
+			got, err := ParseUpstream(fname)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestURLFormats(t *testing.T) {
+	const nightly = "https://mirror.bazel.build/ziglang.org/builds/zig-{zig_platform}-{version}.{_ext}"
+	got := Upstream{Version: "0.11.0-dev.2619+bd3e248c7", URLTemplate: nightly}.URLFormats()
+	assert.Equal(t, []string{
+		nightly,
+		"https://ziglang.org/builds/zig-{zig_platform}-{version}.{_ext}",
+	}, got)
+
+	assert.Equal(t,
+		"https://ziglang.org/builds/zig-aarch64-macos-0.11.0-dev.2619+bd3e248c7.tar.xz",
+		URL(got[1], "0.11.0-dev.2619+bd3e248c7", "macos-aarch64", "tar.xz"),
+	)
+	assert.Equal(t,
+		"https://ziglang.org/builds/zig-windows-x86_64-0.11.0.zip",
+		URL("https://ziglang.org/builds/zig-{host_platform}-{version}.{_ext}", "0.11.0", "windows-x86_64", "zip"),
+	)
+}
+
+func TestParseHostPlatforms(t *testing.T) {
+	dir := t.TempDir()
+	zigSDKPath := path.Join(dir, "zig_sdk.bzl")
+	defsPath := path.Join(dir, "defs.bzl")
+	require.NoError(t, os.WriteFile(zigSDKPath, []byte(`HOST_PLATFORM_SHA256 = {
+    "linux-x86_64": "aa",
+    "macos-aarch64": "bb",
+}`), 0644))
+
+	require.NoError(t, os.WriteFile(defsPath, []byte(`_HOST_PLATFORM_EXT = {"linux-x86_64": "tar.xz"}`), 0644))
+	_, err := ParseHostPlatforms(zigSDKPath, defsPath)
+	assert.ErrorContains(t, err, "macos-aarch64 has no _HOST_PLATFORM_EXT")
+
+	require.NoError(t, os.WriteFile(defsPath, []byte(`_HOST_PLATFORM_EXT = {"linux-x86_64": EXT}`), 0644))
+	_, err = ParseHostPlatforms(zigSDKPath, defsPath)
+	assert.ErrorContains(t, err, `defs.bzl:1:39: _HOST_PLATFORM_EXT["linux-x86_64"]: got an identifier, want a string`)
+
+	require.NoError(t, os.WriteFile(defsPath, []byte(`_HOST_PLATFORM_EXT = {
+    "linux-x86_64": "tar.xz",
+    "macos-aarch64": "tar.xz",
+}`), 0644))
+	got, err := ParseHostPlatforms(zigSDKPath, defsPath)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"linux-x86_64", "macos-aarch64"}, got.Names())
+	assert.Equal(t, "bb", got.SHA256["macos-aarch64"])
+}
@@ -0,0 +1,199 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+const (
+	// _archiveConfigPath says what goes into the release tarball, relative
+	// to repoRoot.
+	_archiveConfigPath = "tools/releaser/data/archive.json"
+
+	// _archiveConfigVersion is the version of the archive.json format.
+	_archiveConfigVersion = 1
+)
+
+// archiveConfig is the contents of archive.json. All paths are relative to
+// the repository root, as in the output of `git archive`.
+type archiveConfig struct {
+	Version int `json:"version"`
+	// Include are the `git archive` pathspecs, e.g. "toolchain/*".
+	Include []string `json:"include"`
+	// Rename maps paths to their names in the tarball.
+	Rename map[string]string `json:"rename"`
+	// Exclude are path.Match patterns of archive entries to drop, e.g.
+	// the parent directories of renamed files.
+	Exclude []string `json:"exclude"`
+	// Worktree are files that the releaser updates before the release
+	// commit, so they are taken from the working tree (or the releaser's
+	// pending changes) instead of ref.
+	Worktree []string `json:"worktree"`
+}
+
+// readArchiveConfig reads archive.json at ref. Tags from before
+// archive.json were archived like the first archive.json says, so the one
+// in the working tree is used for them.
+func readArchiveConfig(repoRoot, ref string) (archiveConfig, error) {
+	r, err := openRepo(repoRoot)
+	if err != nil {
+		return archiveConfig{}, err
+	}
+	data, err := r.readFile(ref, _archiveConfigPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		fpath := path.Join(repoRoot, _archiveConfigPath)
+		data, err := os.ReadFile(fpath)
+		if err != nil {
+			return archiveConfig{}, err
+		}
+		return parseArchiveConfig(fpath, data)
+	}
+	if err != nil {
+		return archiveConfig{}, err
+	}
+	return parseArchiveConfig(ref+":"+_archiveConfigPath, data)
+}
+
+func parseArchiveConfig(fpath string, data []byte) (archiveConfig, error) {
+	var c archiveConfig
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&c); err != nil {
+		return c, fmt.Errorf("parse %q: %w", fpath, err)
+	}
+
+	if c.Version != _archiveConfigVersion {
+		return c, fmt.Errorf("%q: unsupported version %d, expected %d", fpath, c.Version, _archiveConfigVersion)
+	}
+	if len(c.Include) == 0 {
+		return c, fmt.Errorf("%q: include is empty", fpath)
+	}
+	for _, pattern := range c.Exclude {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return c, fmt.Errorf("%q: exclude %q: %w", fpath, pattern, err)
+		}
+	}
+	froms := make([]string, 0, len(c.Rename))
+	for from := range c.Rename {
+		froms = append(froms, from)
+	}
+	sort.Strings(froms)
+	renamed := make(map[string]string, len(c.Rename))
+	for _, from := range froms {
+		to := c.Rename[from]
+		if to == "" || strings.HasPrefix(to, "/") {
+			return c, fmt.Errorf("%q: rename %q: %q is not a relative path", fpath, from, to)
+		}
+		if other, ok := renamed[to]; ok {
+			return c, fmt.Errorf("%q: both %q and %q are renamed to %q", fpath, other, from, to)
+		}
+		renamed[to] = from
+	}
+
+	return c, nil
+}
+
+func (c archiveConfig) excluded(name string) bool {
+	for _, pattern := range c.Exclude {
+		// Validated in parseArchiveConfig.
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (c archiveConfig) fromWorktree(name string) bool {
+	for _, f := range c.Worktree {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+// listArchive writes the table of contents of a release tarball.
+func listArchive(w io.Writer, tgz io.Reader) error {
+	entries, err := readTgzEntries(tgz)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if _, err := fmt.Fprintf(w, "%04o %8d %s\n", e.mode, e.size, e.name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// archiveEntry is a file or directory of the release archive. Directory
+// names end with a slash.
+type archiveEntry struct {
+	name string
+	mode int64
+	data []byte
+}
+
+func (e archiveEntry) isDir() bool {
+	return strings.HasSuffix(e.name, "/")
+}
+
+// readArchiveEntries reads what goes into the release archive of ref, in
+// the order of `git archive`, i.e. sorted by the path in the repository.
+// What goes in is in archive.json at ref. Its worktree files
+// (MODULE.bazel) are taken from overrides if present there, otherwise from
+// the working tree. overrides is keyed by the path in the repository.
+func readArchiveEntries(repoRoot, ref string, overrides map[string][]byte) ([]archiveEntry, error) {
+	// WORKSPACE in the resulting tarball needs to be much
+	// smaller than of hermetic_cc_toolchain. See #15.
+	// See that README why we are not adding the top-level README.md.
+	// archive.json renames them to be top-level.
+	archive, err := readArchiveConfig(repoRoot, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := openRepo(repoRoot)
+	if err != nil {
+		return nil, err
+	}
+	// Only names, modes and contents are kept, so the archive does not
+	// depend on the commit, like the `git archive` metadata would.
+	entries, err := r.archive(ref, archive.Include)
+	if err != nil {
+		return nil, fmt.Errorf("read archive: %w", err)
+	}
+
+	var ret []archiveEntry
+	for _, e := range entries {
+		name := e.name
+		if archive.excluded(name) {
+			continue
+		}
+		if n, ok := archive.Rename[name]; ok {
+			e.name = n
+		}
+
+		if override, ok := overrides[name]; ok {
+			e.data = override
+		} else if archive.fromWorktree(name) {
+			e.data, err = os.ReadFile(path.Join(repoRoot, name))
+			if err != nil {
+				return nil, fmt.Errorf("read %q: %w", name, err)
+			}
+		}
+		ret = append(ret, e)
+	}
+	return ret, nil
+}
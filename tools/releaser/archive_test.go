@@ -0,0 +1,132 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseArchiveConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		wantErr  string
+	}{
+		{
+			name:     "ok",
+			contents: `{"version": 1, "include": ["LICENSE", "toolchain/*"], "exclude": ["tools/*"], "rename": {"a/b": "b"}}`,
+		},
+		{
+			name:     "unknown field",
+			contents: `{"version": 1, "include": ["LICENSE"], "substitutes": {}}`,
+			wantErr:  `unknown field "substitutes"`,
+		},
+		{
+			name:     "version",
+			contents: `{"version": 2, "include": ["LICENSE"]}`,
+			wantErr:  "unsupported version 2, expected 1",
+		},
+		{
+			name:     "no includes",
+			contents: `{"version": 1}`,
+			wantErr:  "include is empty",
+		},
+		{
+			name:     "bad exclude",
+			contents: `{"version": 1, "include": ["LICENSE"], "exclude": ["tools/["]}`,
+			wantErr:  `exclude "tools/[": syntax error in pattern`,
+		},
+		{
+			name:     "rename clash",
+			contents: `{"version": 1, "include": ["LICENSE"], "rename": {"a/README": "README", "b/README": "README"}}`,
+			wantErr:  `both "a/README" and "b/README" are renamed to "README"`,
+		},
+		{
+			name:     "rename to absolute path",
+			contents: `{"version": 1, "include": ["LICENSE"], "rename": {"a/README": "/README"}}`,
+			wantErr:  `rename "a/README": "/README" is not a relative path`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseArchiveConfig("archive.json", []byte(tt.contents))
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestArchiveJSON(t *testing.T) {
+	data, err := os.ReadFile(path.Join("data", "archive.json"))
+	require.NoError(t, err)
+	c, err := parseArchiveConfig("archive.json", data)
+	require.NoError(t, err)
+
+	assert.True(t, c.excluded("tools/releaser/"))
+	assert.False(t, c.excluded("toolchain/defs.bzl"))
+	assert.True(t, c.fromWorktree("MODULE.bazel"))
+	assert.Equal(t, "WORKSPACE", c.Rename["tools/releaser/data/WORKSPACE"])
+}
+
+func TestReadArchiveConfig(t *testing.T) {
+	repoRoot := initReleaseRepo(t)
+	tagRepo(t, repoRoot, "v0.9.0", "HEAD~1")
+
+	commitFiles(t, repoRoot, "ship rules/", map[string]string{
+		_archiveConfigPath: `{"version": 1, "include": ["LICENSE", "rules/*"]}`,
+	})
+
+	got, err := readArchiveConfig(repoRoot, "HEAD")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"LICENSE", "rules/*"}, got.Include)
+
+	got, err = readArchiveConfig(repoRoot, "v1.0.0-rc1")
+	require.NoError(t, err)
+	assert.Contains(t, got.Include, "toolchain/*")
+
+	// v0.9.0 predates archive.json, so the working tree is used.
+	got, err = readArchiveConfig(repoRoot, "v0.9.0")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"LICENSE", "rules/*"}, got.Include)
+}
+
+func TestListArchive(t *testing.T) {
+	repoRoot := initReleaseRepo(t)
+	commitFiles(t, repoRoot, "add a script", map[string]string{
+		"toolchain/zig-wrapper.zig": "// zig\n",
+	})
+	require.NoError(t, os.Chmod(path.Join(repoRoot, "toolchain", "zig-wrapper.zig"), 0755))
+	commitFiles(t, repoRoot, "make it executable", nil)
+
+	var tgz bytes.Buffer
+	_, err := makeTgz(&tgz, repoRoot, "HEAD", map[string][]byte{"MODULE.bazel": []byte("module()\n")})
+	require.NoError(t, err)
+
+	var got bytes.Buffer
+	require.NoError(t, listArchive(&got, &tgz))
+	assert.Equal(t, `0664        3 LICENSE
+0664        9 MODULE.bazel
+0775        0 toolchain/
+0664        7 toolchain/defs.bzl
+0775        0 toolchain/private/
+0664       26 toolchain/private/defs.bzl
+0664       72 toolchain/private/zig_sdk.bzl
+0775        7 toolchain/zig-wrapper.zig
+0664       15 README
+0664       42 WORKSPACE
+`, got.String())
+
+	assert.Error(t, listArchive(io.Discard, bytes.NewReader([]byte("not a tarball"))))
+}
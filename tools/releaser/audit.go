@@ -0,0 +1,245 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	bzl "github.com/bazelbuild/buildtools/build"
+)
+
+// _repoLabelPrefix is how the files of the tarball refer to each other
+// when loaded from another repository.
+const _repoLabelPrefix = "@" + _bcrModuleName + "//"
+
+// auditTgz checks that every label in the BUILD and .bzl files of a release
+// tarball that points into hermetic_cc_toolchain can be resolved to a file
+// (or, for non-file targets, a package) of the tarball.
+//
+// Checked are:
+//   - load() labels;
+//   - Label("...") arguments;
+//   - any "@hermetic_cc_toolchain//..." string.
+//
+// Build file templates of other repositories (BUILD.sdk.bazel,
+// *.bazel.tmpl) only have their "@hermetic_cc_toolchain//" labels checked,
+// because "//" means the other repository there.
+func auditTgz(r io.Reader) error {
+	files, sources, err := readTgzSources(r)
+	if err != nil {
+		return err
+	}
+
+	a := labelAuditor{files: files}
+	names := make([]string, 0, len(sources))
+	for name := range sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := a.auditFile(name, sources[name]); err != nil {
+			return err
+		}
+	}
+
+	if len(a.missing) > 0 {
+		return fmt.Errorf(
+			"the release tarball refers to %d missing file(s) or package(s):\n---\n%s\n---\n",
+			len(a.missing),
+			strings.Join(a.missing, "\n"),
+		)
+	}
+	return nil
+}
+
+// readTgzSources returns the names of all files of a release tarball, and
+// the contents of its Starlark files (see starlarkKind).
+func readTgzSources(r io.Reader) (map[string]struct{}, map[string][]byte, error) {
+	gzr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer gzr.Close()
+
+	files := make(map[string]struct{})
+	sources := make(map[string][]byte)
+	tr := tar.NewReader(gzr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		files[hdr.Name] = struct{}{}
+		if starlarkKind(hdr.Name) == "" {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("read %q: %w", hdr.Name, err)
+		}
+		sources[hdr.Name] = data
+	}
+	return files, sources, nil
+}
+
+// starlarkKind returns "own" for Starlark files whose "//" labels are in
+// hermetic_cc_toolchain, "foreign" for build files of other repositories,
+// and "" for other files.
+func starlarkKind(name string) string {
+	base := path.Base(name)
+	switch {
+	case base == "BUILD", base == "BUILD.bazel", base == "MODULE.bazel", base == "WORKSPACE":
+		return "own"
+	case strings.HasSuffix(base, ".bzl"):
+		return "own"
+	case strings.HasSuffix(base, ".bazel"), strings.HasSuffix(base, ".bazel.tmpl"):
+		return "foreign"
+	}
+	return ""
+}
+
+type labelAuditor struct {
+	files   map[string]struct{}
+	missing []string
+}
+
+func (a *labelAuditor) auditFile(name string, data []byte) error {
+	parsed, err := bzl.Parse(name, data)
+	if err != nil {
+		return fmt.Errorf("parse %q from the release tarball: %w", name, err)
+	}
+	own := starlarkKind(name) == "own"
+
+	for _, load := range loads(parsed) {
+		a.check(name, load.Module, own, true)
+	}
+
+	bzl.Walk(parsed, func(expr bzl.Expr, stack []bzl.Expr) {
+		str, ok := expr.(*bzl.StringExpr)
+		if !ok {
+			return
+		}
+		switch {
+		case isLabelArg(stack):
+			a.check(name, str, own, false)
+		case strings.HasPrefix(str.Value, _repoLabelPrefix) && !isLoadModule(stack, str):
+			a.check(name, str, own, false)
+		}
+	})
+	return nil
+}
+
+// check resolves label in file name and records it if it is missing. Labels
+// of other repositories are ignored.
+func (a *labelAuditor) check(name string, label *bzl.StringExpr, own, isLoad bool) {
+	value := label.Value
+	switch {
+	case strings.HasPrefix(value, _repoLabelPrefix):
+		value = strings.TrimPrefix(value, "@"+_bcrModuleName)
+	case strings.HasPrefix(value, "@"), !own:
+		return
+	}
+
+	// Labels that are formatted at runtime, e.g. "//libc:{}".
+	if strings.ContainsAny(value, "{}") {
+		return
+	}
+
+	var pkg, target string
+	switch {
+	case strings.HasPrefix(value, "//"):
+		var ok bool
+		pkg, target, ok = strings.Cut(strings.TrimPrefix(value, "//"), ":")
+		if !ok {
+			target = path.Base(pkg)
+		}
+	case strings.HasPrefix(value, ":"):
+		pkg, target = a.packageOf(path.Dir(name)), strings.TrimPrefix(value, ":")
+	default:
+		// A relative target, e.g. "foo", in the current package.
+		pkg, target = a.packageOf(path.Dir(name)), value
+	}
+
+	line, _ := label.Span()
+	where := fmt.Sprintf("%s:%d: %q", name, line.Line, label.Value)
+
+	if target == "..." || target == "all" || target == "*" || strings.HasSuffix(pkg, "...") {
+		return
+	}
+	if _, ok := a.files[path.Join(pkg, target)]; ok {
+		return
+	}
+	if isLoad || path.Ext(target) != "" || target == "BUILD" {
+		a.missing = append(a.missing, fmt.Sprintf("%s: %s is not in the tarball", where, path.Join(pkg, target)))
+		return
+	}
+	// Rules can be declared by macros, so only their package is checked.
+	if !a.isPackage(pkg) {
+		a.missing = append(a.missing, fmt.Sprintf("%s: package %q is not in the tarball", where, "//"+pkg))
+	}
+}
+
+// packageOf returns the package that dir is in, i.e. the closest directory
+// with a BUILD file, or "" for the root package.
+func (a *labelAuditor) packageOf(dir string) string {
+	for dir != "." && dir != "/" && dir != "" {
+		if a.isPackage(dir) {
+			return dir
+		}
+		dir = path.Dir(dir)
+	}
+	return ""
+}
+
+func (a *labelAuditor) isPackage(dir string) bool {
+	for _, build := range []string{"BUILD", "BUILD.bazel"} {
+		if _, ok := a.files[path.Join(dir, build)]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func loads(f *bzl.File) []*bzl.LoadStmt {
+	var ret []*bzl.LoadStmt
+	for _, stmt := range f.Stmt {
+		if load, ok := stmt.(*bzl.LoadStmt); ok {
+			ret = append(ret, load)
+		}
+	}
+	return ret
+}
+
+// isLabelArg returns whether the innermost expression of stack is a call
+// to Label().
+func isLabelArg(stack []bzl.Expr) bool {
+	if len(stack) == 0 {
+		return false
+	}
+	call, ok := stack[len(stack)-1].(*bzl.CallExpr)
+	if !ok {
+		return false
+	}
+	fn, ok := call.X.(*bzl.Ident)
+	return ok && fn.Name == "Label"
+}
+
+// isLoadModule returns whether str is the module of a load statement, which
+// is checked separately.
+func isLoadModule(stack []bzl.Expr, str *bzl.StringExpr) bool {
+	if len(stack) == 0 {
+		return false
+	}
+	load, ok := stack[len(stack)-1].(*bzl.LoadStmt)
+	return ok && load.Module == str
+}
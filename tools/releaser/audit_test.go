@@ -0,0 +1,151 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testTgz returns a tarball with the given files.
+func testTgz(t *testing.T, files map[string]string) *bytes.Buffer {
+	t.Helper()
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	gzw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gzw)
+	for _, name := range names {
+		require.NoError(t, tw.WriteHeader(&tar.Header{
+			Name: name,
+			Mode: 0644,
+			Size: int64(len(files[name])),
+		}))
+		_, err := tw.Write([]byte(files[name]))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gzw.Close())
+	return &buf
+}
+
+func TestAuditTgz(t *testing.T) {
+	base := map[string]string{
+		"MODULE.bazel":       `module(name = "hermetic_cc_toolchain")`,
+		"toolchain/BUILD":    "",
+		"toolchain/defs.bzl": `load("//toolchain/private:defs.bzl", "x")`,
+		"toolchain/private/BUILD": `load(":defs.bzl", "y")
+exports_files(["defs.bzl"])`,
+		"toolchain/private/defs.bzl": `load("@bazel_tools//tools/build_defs/repo:http.bzl", "http_archive")
+load("@hermetic_cc_toolchain//toolchain:defs.bzl", "z")
+
+_WRAPPER = Label("//toolchain:zig-wrapper.zig")
+_PLATFORM = "@hermetic_cc_toolchain//toolchain/private:platform"
+_GENERATED = "//libc:{}"
+_VISIBILITY = "//visibility:public"
+`,
+		"toolchain/zig-wrapper.zig": "",
+		// "//" is the zig_sdk repository in a foreign build file.
+		"toolchain/BUILD.sdk.bazel": `load("@hermetic_cc_toolchain//toolchain:defs.bzl", "declare_files")
+alias(name = "empty", actual = "//:empty")`,
+	}
+
+	with := func(changes map[string]string) map[string]string {
+		ret := make(map[string]string, len(base))
+		for k, v := range base {
+			ret[k] = v
+		}
+		for k, v := range changes {
+			if v == "" {
+				delete(ret, k)
+			} else {
+				ret[k] = v
+			}
+		}
+		return ret
+	}
+
+	tests := []struct {
+		name    string
+		files   map[string]string
+		wantErr []string
+	}{
+		{
+			name:  "ok",
+			files: base,
+		},
+		{
+			name:  "missing load target",
+			files: with(map[string]string{"toolchain/private/defs.bzl": ""}),
+			wantErr: []string{
+				"2 missing file(s) or package(s)",
+				`toolchain/defs.bzl:1: "//toolchain/private:defs.bzl": toolchain/private/defs.bzl is not in the tarball`,
+				`toolchain/private/BUILD:1: ":defs.bzl": toolchain/private/defs.bzl is not in the tarball`,
+			},
+		},
+		{
+			name:  "missing load target of a foreign build file",
+			files: with(map[string]string{"toolchain/defs.bzl": ""}),
+			wantErr: []string{
+				`toolchain/BUILD.sdk.bazel:1: "@hermetic_cc_toolchain//toolchain:defs.bzl": toolchain/defs.bzl is not in the tarball`,
+				`toolchain/private/defs.bzl:2: "@hermetic_cc_toolchain//toolchain:defs.bzl": toolchain/defs.bzl is not in the tarball`,
+			},
+		},
+		{
+			name:    "missing Label",
+			files:   with(map[string]string{"toolchain/zig-wrapper.zig": ""}),
+			wantErr: []string{`toolchain/private/defs.bzl:4: "//toolchain:zig-wrapper.zig": toolchain/zig-wrapper.zig is not in the tarball`},
+		},
+		{
+			name: "missing package",
+			files: with(map[string]string{
+				"toolchain/private/BUILD":    "",
+				"toolchain/private/defs.bzl": `_PLATFORM = "@hermetic_cc_toolchain//toolchain/private:platform"`,
+			}),
+			wantErr: []string{`toolchain/private/defs.bzl:1: "@hermetic_cc_toolchain//toolchain/private:platform": package "//toolchain/private" is not in the tarball`},
+		},
+		{
+			name:    "unparsable",
+			files:   with(map[string]string{"toolchain/BUILD": "load("}),
+			wantErr: []string{`parse "toolchain/BUILD" from the release tarball`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := auditTgz(testTgz(t, tt.files))
+			if len(tt.wantErr) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			for _, want := range tt.wantErr {
+				assert.ErrorContains(t, err, want)
+			}
+		})
+	}
+}
+
+func TestAuditRelease(t *testing.T) {
+	if _, err := openRepo("../.."); err != nil {
+		t.Skip("not in a git checkout (e.g. in the bazel sandbox)")
+	}
+
+	files := newPendingFiles("../..")
+	require.NoError(t, updateModuleVersion(files, "v99.0.0"))
+
+	var tgz bytes.Buffer
+	_, err := makeTgz(&tgz, "../..", "HEAD", files.contents)
+	require.NoError(t, err)
+	assert.NoError(t, auditTgz(&tgz))
+}
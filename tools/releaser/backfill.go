@@ -0,0 +1,112 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+)
+
+// runBackfill is `releaser backfill`. It records every release tag of the
+// repository in releases.json with its sha256, zig version and commit,
+// which releases.json did not record before version 2.
+func runBackfill(args []string) error {
+	var repoRoot string
+
+	fs := flag.NewFlagSet("backfill", flag.ExitOnError)
+	fs.StringVar(&repoRoot, "repoRoot", os.Getenv("BUILD_WORKSPACE_DIRECTORY"), "root directory of hermetic_cc_toolchain repo")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), `usage: bazel run //tools/releaser -- backfill
+
+Records every release tag in releases.json with its sha256, zig version
+and commit. The tarballs of releases that are not recorded yet, or whose
+hash is reproducible, are rebuilt from their tag. Run it in a clone with
+all the release tags; nothing is committed.
+
+`)
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("backfill: unexpected arguments %q", fs.Args())
+	}
+
+	manifest, err := backfillReleases(repoRoot)
+	if err != nil {
+		return err
+	}
+	files := newPendingFiles(repoRoot)
+	if err := writeReleaseManifest(files, manifest); err != nil {
+		return err
+	}
+	if err := files.flush(); err != nil {
+		return err
+	}
+	log("recorded %d releases in %s", len(manifest.Releases), _releasesPath)
+	return nil
+}
+
+// backfillReleases returns releases.json with every release tag of
+// repoRoot, ordered by tag. A rebuilt tarball that differs from the
+// recorded one is an error, since the release is already published.
+func backfillReleases(repoRoot string) (*releaseManifest, error) {
+	manifest, err := readReleaseManifest(repoRoot)
+	if err != nil {
+		return nil, err
+	}
+	r, err := openRepo(repoRoot)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := r.tags()
+	if err != nil {
+		return nil, err
+	}
+
+	tagged := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		if !_tagRegexp.MatchString(tag) {
+			continue
+		}
+		tagged[tag] = true
+
+		e := releaseEntry{Tag: tag}
+		recorded, ok := manifest.lookup(tag)
+		if !ok {
+			e.Hash = hashReproducible
+		}
+		if !ok || recorded.Hash == hashReproducible {
+			rebuilt, err := rebuildRelease(repoRoot, tag)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", tag, err)
+			}
+			e.SHA256 = rebuilt.SHA256
+		}
+		if e.ZigVersion, err = zigVersionAt(r, tag); err != nil {
+			return nil, fmt.Errorf("%s: zig version: %w", tag, err)
+		}
+		if e.Commit, err = r.commitHash(tag); err != nil {
+			return nil, err
+		}
+		if err := manifest.record(e); err != nil {
+			return nil, fmt.Errorf("%w; if the releaser changed since, pin its hash", err)
+		}
+	}
+
+	for _, e := range manifest.Releases {
+		if !tagged[e.Tag] {
+			return nil, fmt.Errorf("%s is in %s, but not tagged in %q", e.Tag, _releasesPath, repoRoot)
+		}
+	}
+	slices.SortStableFunc(manifest.Releases, func(a, b releaseEntry) int {
+		return compareTags(a.Tag, b.Tag)
+	})
+	manifest.Version = _releasesVersion
+	return manifest, nil
+}
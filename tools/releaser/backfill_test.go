@@ -0,0 +1,73 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+package main
+
+import (
+	"io"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackfill(t *testing.T) {
+	repoRoot := initFixtureRepo(t)
+	require.NoError(t, release(fixtureConfig(repoRoot), fixtureDeps(t, fixtureMirror(t), io.Discard)))
+	pinned := strings.Repeat("ab", 32)
+	commitFiles(t, repoRoot, "pin v0.9.0", map[string]string{
+		_releasesPath: `{"version": 1, "releases": [{"tag": "v0.9.0", "sha256": "` + pinned + `", "hash": "pinned"}]}`,
+	})
+
+	require.NoError(t, runBackfill([]string{"-repoRoot", repoRoot}))
+
+	// The pinned release keeps its sha256, the other one is rebuilt.
+	r, err := openRepo(repoRoot)
+	require.NoError(t, err)
+	commit09, err := r.commitHash("v0.9.0")
+	require.NoError(t, err)
+	commit10, err := r.commitHash("v1.0.0")
+	require.NoError(t, err)
+	m, err := readReleaseManifest(repoRoot)
+	require.NoError(t, err)
+	assert.Equal(t, &releaseManifest{
+		Version: _releasesVersion,
+		Releases: []releaseEntry{
+			{Tag: "v0.9.0", SHA256: pinned, ZigVersion: "0.15.2", Commit: commit09, Hash: hashPinned},
+			{Tag: "v1.0.0", SHA256: _fixtureSHA256, ZigVersion: "0.15.2", Commit: commit10, Hash: hashReproducible},
+		},
+	}, m)
+}
+
+func TestBackfillErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		releases string
+		wantErr  string
+	}{
+		{
+			name:     "not reproducible",
+			releases: `{"version": 1, "releases": [{"tag": "v0.9.0", "sha256": "` + strings.Repeat("ab", 32) + `", "hash": "reproducible"}]}`,
+			wantErr:  "v0.9.0 is already released with sha256 " + strings.Repeat("ab", 32) + ", refusing to overwrite it with ",
+		},
+		{
+			name:     "not tagged",
+			releases: `{"version": 1, "releases": [{"tag": "v0.8.0", "sha256": "aa", "hash": "pinned"}]}`,
+			wantErr:  `v0.8.0 is in ` + _releasesPath + `, but not tagged in "`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repoRoot := initFixtureRepo(t)
+			fpath := path.Join(repoRoot, _releasesPath)
+			require.NoError(t, os.WriteFile(fpath, []byte(tt.releases), 0644))
+
+			_, err := backfillReleases(repoRoot)
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+const (
+	_bcrModuleName = "hermetic_cc_toolchain"
+	_bcrOwner      = "uber"
+)
+
+// writeBCR writes the Bazel Central Registry entry of a release to
+// registry, which is the root of a registry checkout:
+//
+//	modules/hermetic_cc_toolchain/metadata.json
+//	modules/hermetic_cc_toolchain/<version>/MODULE.bazel
+//	modules/hermetic_cc_toolchain/<version>/presubmit.yml
+//	modules/hermetic_cc_toolchain/<version>/source.json
+//
+// metadata.json and source.json are created from the templates in .bcr/.
+func writeBCR(repoRoot, registry, tag, shasum string, module []byte) error {
+	version := strings.TrimPrefix(tag, "v")
+	moduleDir := path.Join(registry, "modules", _bcrModuleName)
+	versionDir := path.Join(moduleDir, version)
+
+	integrity, err := sriSHA256(shasum)
+	if err != nil {
+		return err
+	}
+
+	source, err := bcrSource(repoRoot, tag, integrity)
+	if err != nil {
+		return err
+	}
+
+	// A version that is already in the registry must not change.
+	sourcePath := path.Join(versionDir, "source.json")
+	if existing, err := os.ReadFile(sourcePath); err == nil {
+		if !bytes.Equal(existing, source) {
+			return fmt.Errorf("%q already exists with different contents:\n---\n%s\n---\n", sourcePath, existing)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	presubmit, err := os.ReadFile(path.Join(repoRoot, ".bcr", "presubmit.yml"))
+	if err != nil {
+		return err
+	}
+
+	metadata, err := bcrMetadata(repoRoot, path.Join(moduleDir, "metadata.json"), version)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(versionDir, 0755); err != nil {
+		return err
+	}
+
+	for fpath, data := range map[string][]byte{
+		path.Join(moduleDir, "metadata.json"):  metadata,
+		path.Join(versionDir, "MODULE.bazel"):  module,
+		path.Join(versionDir, "presubmit.yml"): presubmit,
+		sourcePath:                             source,
+	} {
+		if err := os.WriteFile(fpath, data, 0644); err != nil {
+			return fmt.Errorf("write %q: %w", fpath, err)
+		}
+	}
+
+	return nil
+}
+
+// bcrSource renders .bcr/source.template.json for the release.
+func bcrSource(repoRoot, tag, integrity string) ([]byte, error) {
+	tmplPath := path.Join(repoRoot, ".bcr", "source.template.json")
+	tmpl, err := os.ReadFile(tmplPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var source map[string]any
+	if err := json.Unmarshal(tmpl, &source); err != nil {
+		return nil, fmt.Errorf("parse %q: %w", tmplPath, err)
+	}
+
+	url, ok := source["url"].(string)
+	if !ok {
+		return nil, fmt.Errorf("%q: url is not a string", tmplPath)
+	}
+	source["url"] = strings.NewReplacer(
+		"{OWNER}", _bcrOwner,
+		"{REPO}", _bcrModuleName,
+		"{TAG}", tag,
+	).Replace(url)
+	source["integrity"] = integrity
+	// the release tarball does not have a top-level directory.
+	source["strip_prefix"] = ""
+
+	return marshalBCR(source)
+}
+
+// bcrMetadata returns metadata.json with version added to its versions. If
+// metadataPath does not exist yet, .bcr/metadata.template.json is used.
+func bcrMetadata(repoRoot, metadataPath, version string) ([]byte, error) {
+	data, err := os.ReadFile(metadataPath)
+	if os.IsNotExist(err) {
+		metadataPath = path.Join(repoRoot, ".bcr", "metadata.template.json")
+		data, err = os.ReadFile(metadataPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var metadata map[string]json.RawMessage
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, fmt.Errorf("parse %q: %w", metadataPath, err)
+	}
+
+	var versions []string
+	if raw, ok := metadata["versions"]; ok {
+		if err := json.Unmarshal(raw, &versions); err != nil {
+			return nil, fmt.Errorf("parse %q versions: %w", metadataPath, err)
+		}
+	}
+
+	for _, v := range versions {
+		if v == version {
+			return marshalBCR(metadata)
+		}
+	}
+
+	if versions == nil {
+		versions = []string{}
+	}
+	versions = append(versions, version)
+	raw, err := json.Marshal(versions)
+	if err != nil {
+		return nil, err
+	}
+	metadata["versions"] = raw
+
+	return marshalBCR(metadata)
+}
+
+// marshalBCR formats JSON the way the registry does.
+func marshalBCR(v any) ([]byte, error) {
+	data, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// sriSHA256 converts a hex-encoded sha256 to a subresource integrity string.
+func sriSHA256(shasum string) (string, error) {
+	digest, err := hex.DecodeString(shasum)
+	if err != nil {
+		return "", fmt.Errorf("decode sha256 %q: %w", shasum, err)
+	}
+	return "sha256-" + base64.StdEncoding.EncodeToString(digest), nil
+}
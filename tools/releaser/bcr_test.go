@@ -0,0 +1,85 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+package main
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const _testSHA256 = "79338d8c5c4499c7402aea1fe78dcd20267f300e9f8f5886be7017d57ccf0fbc"
+
+func writeBCRTemplates(t *testing.T, repoRoot string) {
+	t.Helper()
+	dir := path.Join(repoRoot, ".bcr")
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	for name, contents := range map[string]string{
+		"metadata.template.json": `{"homepage": "https://github.com/uber/hermetic_cc_toolchain", "versions": [], "yanked_versions": {}}`,
+		"source.template.json":   `{"integrity": "", "strip_prefix": "", "url": "https://github.com/{OWNER}/{REPO}/releases/download/{TAG}/{REPO}-{TAG}.tar.gz"}`,
+		"presubmit.yml":          "tasks: {}\n",
+	} {
+		require.NoError(t, os.WriteFile(path.Join(dir, name), []byte(contents), 0644))
+	}
+}
+
+func readFile(t *testing.T, fpath string) string {
+	t.Helper()
+	data, err := os.ReadFile(fpath)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestWriteBCR(t *testing.T) {
+	repoRoot := t.TempDir()
+	registry := t.TempDir()
+	writeBCRTemplates(t, repoRoot)
+
+	module := []byte("module(name = \"hermetic_cc_toolchain\", version = \"4.3.0\")\n")
+	require.NoError(t, writeBCR(repoRoot, registry, "v4.3.0", _testSHA256, module))
+
+	moduleDir := path.Join(registry, "modules", "hermetic_cc_toolchain")
+	assert.Equal(t, `{
+    "homepage": "https://github.com/uber/hermetic_cc_toolchain",
+    "versions": [
+        "4.3.0"
+    ],
+    "yanked_versions": {}
+}
+`, readFile(t, path.Join(moduleDir, "metadata.json")))
+	assert.Equal(t, `{
+    "integrity": "sha256-eTONjFxEmcdAKuof543NICZ/MA6fj1iGvnAX1XzPD7w=",
+    "strip_prefix": "",
+    "url": "https://github.com/uber/hermetic_cc_toolchain/releases/download/v4.3.0/hermetic_cc_toolchain-v4.3.0.tar.gz"
+}
+`, readFile(t, path.Join(moduleDir, "4.3.0", "source.json")))
+	assert.Equal(t, string(module), readFile(t, path.Join(moduleDir, "4.3.0", "MODULE.bazel")))
+	assert.Equal(t, "tasks: {}\n", readFile(t, path.Join(moduleDir, "4.3.0", "presubmit.yml")))
+
+	// the next release is appended to the existing metadata.json
+	require.NoError(t, writeBCR(repoRoot, registry, "v4.4.0", _testSHA256, module))
+	// writing the same release again is a no-op
+	require.NoError(t, writeBCR(repoRoot, registry, "v4.4.0", _testSHA256, module))
+	assert.Equal(t, `{
+    "homepage": "https://github.com/uber/hermetic_cc_toolchain",
+    "versions": [
+        "4.3.0",
+        "4.4.0"
+    ],
+    "yanked_versions": {}
+}
+`, readFile(t, path.Join(moduleDir, "metadata.json")))
+}
+
+func TestWriteBCRRefusesToChangeRelease(t *testing.T) {
+	repoRoot := t.TempDir()
+	registry := t.TempDir()
+	writeBCRTemplates(t, repoRoot)
+
+	require.NoError(t, writeBCR(repoRoot, registry, "v4.3.0", _testSHA256, nil))
+	err := writeBCR(repoRoot, registry, "v4.3.0", "00"+_testSHA256[2:], nil)
+	assert.ErrorContains(t, err, "already exists with different contents")
+}
@@ -0,0 +1,169 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const (
+	// _branchesConfigPath says which branches may cut which tags, relative
+	// to repoRoot.
+	_branchesConfigPath = "tools/releaser/data/branches.json"
+
+	// _branchesConfigVersion is the version of the branches.json format.
+	_branchesConfigVersion = 1
+)
+
+// Tags a branch may cut.
+const (
+	// _branchTagsAny is any tag.
+	_branchTagsAny = "any"
+	// _branchTagsMinor are the minor and patch releases of {major}.
+	_branchTagsMinor = "minor"
+	// _branchTagsPatch are the patch releases of {major}.{minor}.
+	_branchTagsPatch = "patch"
+)
+
+// branchesConfig is the contents of branches.json.
+type branchesConfig struct {
+	Version int `json:"version"`
+	// Branches are the branches releases are cut from. The first one that
+	// matches the current branch applies.
+	Branches []branchPolicy `json:"branches"`
+}
+
+// branchPolicy are the tags a branch may cut.
+type branchPolicy struct {
+	// Name is the branch name, where {major} and {minor} are the version
+	// of the tags, e.g. "release-{major}.{minor}".
+	Name string `json:"name"`
+	// Tags is "any", "minor" or "patch".
+	Tags string `json:"tags"`
+
+	re *regexp.Regexp
+}
+
+// readBranchesConfig reads branches.json in the working tree, which is the
+// one of the branch being released.
+func readBranchesConfig(repoRoot string) (branchesConfig, error) {
+	fpath := path.Join(repoRoot, _branchesConfigPath)
+	data, err := os.ReadFile(fpath)
+	if err != nil {
+		return branchesConfig{}, err
+	}
+	return parseBranchesConfig(fpath, data)
+}
+
+func parseBranchesConfig(fpath string, data []byte) (branchesConfig, error) {
+	var c branchesConfig
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&c); err != nil {
+		return c, fmt.Errorf("parse %q: %w", fpath, err)
+	}
+
+	if c.Version != _branchesConfigVersion {
+		return c, fmt.Errorf("%q: unsupported version %d, expected %d", fpath, c.Version, _branchesConfigVersion)
+	}
+	if len(c.Branches) == 0 {
+		return c, fmt.Errorf("%q: branches is empty", fpath)
+	}
+
+	for i := range c.Branches {
+		b := &c.Branches[i]
+		var want []string
+		switch b.Tags {
+		case _branchTagsAny:
+		case _branchTagsMinor:
+			want = []string{"{major}"}
+		case _branchTagsPatch:
+			want = []string{"{major}", "{minor}"}
+		default:
+			return c, fmt.Errorf("%q: branch %q: unknown tags %q, expected any, minor or patch", fpath, b.Name, b.Tags)
+		}
+		for _, p := range []string{"{major}", "{minor}"} {
+			wantN := 0
+			if slices.Contains(want, p) {
+				wantN = 1
+			}
+			if n := strings.Count(b.Name, p); n != wantN {
+				return c, fmt.Errorf("%q: branch %q: %s tags need %d %s in the name, got %d", fpath, b.Name, b.Tags, wantN, p, n)
+			}
+		}
+
+		expr := regexp.QuoteMeta(b.Name)
+		expr = strings.Replace(expr, regexp.QuoteMeta("{major}"), "(?P<major>[0-9]+)", 1)
+		expr = strings.Replace(expr, regexp.QuoteMeta("{minor}"), "(?P<minor>[0-9]+)", 1)
+		re, err := regexp.Compile("^" + expr + "$")
+		if err != nil {
+			return c, fmt.Errorf("%q: branch %q: %w", fpath, b.Name, err)
+		}
+		b.re = re
+	}
+
+	return c, nil
+}
+
+// tagLine returns the prefix of the tags that branch may cut, e.g. "v1.2."
+// for release-1.2. ok is false if no branch policy matches branch.
+func (c branchesConfig) tagLine(branch string) (line string, ok bool) {
+	for _, b := range c.Branches {
+		m := b.re.FindStringSubmatch(branch)
+		if m == nil {
+			continue
+		}
+		line = "v"
+		if i := b.re.SubexpIndex("major"); i != -1 {
+			line += m[i] + "."
+		}
+		if i := b.re.SubexpIndex("minor"); i != -1 {
+			line += m[i] + "."
+		}
+		return line, true
+	}
+	return "", false
+}
+
+func (c branchesConfig) names() string {
+	names := make([]string, len(c.Branches))
+	for i, b := range c.Branches {
+		names[i] = b.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// checkBranch checks that branch may cut tag, and that tag is after all
+// other tags of the branch's line. tags are all tags of the repository.
+// Existing tags are re-checked (e.g. for a pinned hash) regardless of the
+// tags after them.
+func checkBranch(c branchesConfig, branch, tag string, tags []string) error {
+	line, ok := c.tagLine(branch)
+	if !ok {
+		return fmt.Errorf("releases are cut from %s, not %q", c.names(), branch)
+	}
+	if !strings.HasPrefix(tag, line) {
+		return fmt.Errorf("%s only cuts %s* tags, not %s", branch, line, tag)
+	}
+
+	if slices.Contains(tags, tag) {
+		return nil
+	}
+	for _, t := range tags {
+		if !_tagRegexp.MatchString(t) || !strings.HasPrefix(t, line) {
+			continue
+		}
+		if compareTags(t, tag) > 0 {
+			return fmt.Errorf("%s is before %s, the tags of %s do not go backwards", tag, t, branch)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+package main
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBranchesConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		wantErr  string
+	}{
+		{
+			name:     "ok",
+			contents: `{"version": 1, "branches": [{"name": "main", "tags": "any"}, {"name": "v{major}.{minor}.x", "tags": "patch"}]}`,
+		},
+		{
+			name:     "unknown field",
+			contents: `{"version": 1, "branches": [{"name": "main", "tags": "any", "protected": true}]}`,
+			wantErr:  `unknown field "protected"`,
+		},
+		{
+			name:     "version",
+			contents: `{"version": 2, "branches": [{"name": "main", "tags": "any"}]}`,
+			wantErr:  "unsupported version 2, expected 1",
+		},
+		{
+			name:     "no branches",
+			contents: `{"version": 1}`,
+			wantErr:  "branches is empty",
+		},
+		{
+			name:     "unknown tags",
+			contents: `{"version": 1, "branches": [{"name": "main", "tags": "major"}]}`,
+			wantErr:  `branch "main": unknown tags "major", expected any, minor or patch`,
+		},
+		{
+			name:     "patch without minor",
+			contents: `{"version": 1, "branches": [{"name": "release-{major}", "tags": "patch"}]}`,
+			wantErr:  `branch "release-{major}": patch tags need 1 {minor} in the name, got 0`,
+		},
+		{
+			name:     "any with major",
+			contents: `{"version": 1, "branches": [{"name": "release-{major}", "tags": "any"}]}`,
+			wantErr:  `branch "release-{major}": any tags need 0 {major} in the name, got 1`,
+		},
+		{
+			name:     "major twice",
+			contents: `{"version": 1, "branches": [{"name": "{major}-{major}", "tags": "minor"}]}`,
+			wantErr:  `minor tags need 1 {major} in the name, got 2`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseBranchesConfig("branches.json", []byte(tt.contents))
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestBranchesJSON(t *testing.T) {
+	data, err := os.ReadFile(path.Join("data", "branches.json"))
+	require.NoError(t, err)
+	c, err := parseBranchesConfig("branches.json", data)
+	require.NoError(t, err)
+
+	for branch, want := range map[string]string{
+		"main":          "v",
+		"release-2.1":   "v2.1.",
+		"release-2.x":   "v2.",
+		"release-10.12": "v10.12.",
+	} {
+		got, ok := c.tagLine(branch)
+		assert.True(t, ok, branch)
+		assert.Equal(t, want, got, branch)
+	}
+	for _, branch := range []string{"", "main2", "release-2", "release-2.1.x", "release-a.x"} {
+		_, ok := c.tagLine(branch)
+		assert.False(t, ok, branch)
+	}
+}
+
+func TestCheckBranch(t *testing.T) {
+	c, err := parseBranchesConfig("branches.json", []byte(`{"version": 1, "branches": [
+		{"name": "main", "tags": "any"},
+		{"name": "release-{major}.{minor}", "tags": "patch"},
+		{"name": "release-{major}.x", "tags": "minor"}
+	]}`))
+	require.NoError(t, err)
+	tags := []string{"v1.0.0", "v1.1.0", "v1.1.1", "v2.0.0-rc1", "not-a-release"}
+
+	tests := []struct {
+		branch  string
+		tag     string
+		wantErr string
+	}{
+		{branch: "main", tag: "v2.0.0"},
+		{branch: "main", tag: "v2.0.0-rc2"},
+		{branch: "main", tag: "v3.0.0"},
+		{branch: "release-1.1", tag: "v1.1.2"},
+		{branch: "release-1.1", tag: "v1.1.2-rc1"},
+		{branch: "release-1.0", tag: "v1.0.1"},
+		{branch: "release-1.x", tag: "v1.2.0"},
+		{branch: "release-1.x", tag: "v1.1.2"},
+		// Existing tags are re-checked, whatever comes after them.
+		{branch: "main", tag: "v1.0.0"},
+		{branch: "release-1.0", tag: "v1.0.0"},
+		{
+			branch:  "feature",
+			tag:     "v2.0.0",
+			wantErr: `releases are cut from main, release-{major}.{minor}, release-{major}.x, not "feature"`,
+		},
+		{
+			branch:  "",
+			tag:     "v2.0.0",
+			wantErr: `releases are cut from main, release-{major}.{minor}, release-{major}.x, not ""`,
+		},
+		{
+			branch:  "release-1.1",
+			tag:     "v1.2.0",
+			wantErr: "release-1.1 only cuts v1.1.* tags, not v1.2.0",
+		},
+		{
+			branch:  "release-1.x",
+			tag:     "v2.0.0",
+			wantErr: "release-1.x only cuts v1.* tags, not v2.0.0",
+		},
+		{
+			branch:  "main",
+			tag:     "v1.2.0",
+			wantErr: "v1.2.0 is before v2.0.0-rc1, the tags of main do not go backwards",
+		},
+		{
+			branch:  "release-1.1",
+			tag:     "v1.1.1-rc1",
+			wantErr: "v1.1.1-rc1 is before v1.1.1, the tags of release-1.1 do not go backwards",
+		},
+		{
+			branch:  "release-1.0",
+			tag:     "v1.0.0-rc1",
+			wantErr: "v1.0.0-rc1 is before v1.0.0, the tags of release-1.0 do not go backwards",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.branch+" "+tt.tag, func(t *testing.T) {
+			err := checkBranch(c, tt.branch, tt.tag, tags)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,325 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/uber/hermetic_cc_toolchain/tools/internal/bzlconfig"
+	"github.com/uber/hermetic_cc_toolchain/tools/internal/zigsdk"
+)
+
+const (
+	_changelogPath   = "CHANGELOG.md"
+	_changelogHeader = "# Changelog\n"
+
+	// _releaseCommitPrefix is followed by the tag.
+	_releaseCommitPrefix = "Releasing hermetic_cc_toolchain "
+)
+
+var (
+	// feat: ..., fix(toolchain): ..., refactor!: ...
+	_conventionalRegexp = regexp.MustCompile(`^([a-z]+)(\(([^)]+)\))?!?: (.+)$`)
+
+	// _changeGroups are the release notes sections, in order. A commit
+	// goes to the group of its conventional prefix if it has one of
+	// these, otherwise to the group of the first area it touches.
+	_changeGroups = []struct {
+		title string
+		// conventional commit type, if any
+		prefix string
+		// path prefixes of the area, if any
+		paths []string
+	}{
+		{title: "Features", prefix: "feat"},
+		{title: "Bug fixes", prefix: "fix"},
+		{title: "Performance", prefix: "perf"},
+		{title: "zig-wrapper", paths: []string{"toolchain/zig-wrapper.zig"}},
+		{title: "Toolchain", paths: []string{"toolchain/"}},
+		{title: "Rules", paths: []string{"rules/"}},
+		{title: "Documentation", prefix: "docs", paths: []string{"README.md", "docs/"}},
+		{title: "Tools", paths: []string{"tools/", "ci/", ".github/"}},
+		{title: "Tests", prefix: "test", paths: []string{"test/", "examples/"}},
+		{title: "Other"},
+	}
+)
+
+// changeCommit is a commit in the release notes.
+type changeCommit struct {
+	hash    string
+	subject string
+	files   []string
+}
+
+// changes are what happened between two releases.
+type changes struct {
+	tag     string
+	prevTag string // empty for the first release
+	// zig VERSION before and after; equal if it did not change.
+	prevZigVersion string
+	zigVersion     string
+	newGlibcs      []string
+	// groups are keyed by the title of _changeGroups.
+	groups map[string][]changeCommit
+}
+
+// compareTags orders release tags like `git -c versionsort.suffix=-rc tag
+// --sort=v:refname` does, which ci/release uses to find the latest tag:
+// v1.0.0-rc1 < v1.0.0-rc2 < v1.0.0 < v1.0.1. Both tags must match
+// _tagRegexp.
+func compareTags(a, b string) int {
+	pa, pb := tagParts(a), tagParts(b)
+	for i := range pa {
+		if pa[i] != pb[i] {
+			if pa[i] < pb[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// tagParts returns major, minor, patch and the rc number of a tag. A final
+// release sorts after all of its release candidates.
+func tagParts(tag string) [4]int {
+	var ret [4]int
+	m := _tagRegexp.FindStringSubmatch(tag)
+	if m == nil {
+		return ret
+	}
+	ret[0], _ = strconv.Atoi(m[1])
+	ret[1], _ = strconv.Atoi(m[2])
+	ret[2], _ = strconv.Atoi(m[4])
+	ret[3] = math.MaxInt
+	if m[6] != "" {
+		ret[3], _ = strconv.Atoi(m[6])
+	}
+	return ret
+}
+
+// previousTag returns the latest release tag before tag that ref has, or ""
+// if there is none. Tags of other branches are skipped, so the changes of a
+// patch release on a release branch are the commits of that branch.
+func previousTag(repoRoot, tag, ref string) (string, error) {
+	r, err := openRepo(repoRoot)
+	if err != nil {
+		return "", err
+	}
+	tags, err := r.tags()
+	if err != nil {
+		return "", err
+	}
+
+	var prev string
+	for _, t := range tags {
+		if !_tagRegexp.MatchString(t) || compareTags(t, tag) >= 0 {
+			continue
+		}
+		if prev != "" && compareTags(t, prev) <= 0 {
+			continue
+		}
+		ok, err := r.isAncestor(t, ref)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			prev = t
+		}
+	}
+	return prev, nil
+}
+
+// collectChanges collects the commits of ref since prevTag (all of them if
+// prevTag is empty) and what they changed in the Zig SDK and glibcs.
+func collectChanges(repoRoot, tag, prevTag, ref string) (changes, error) {
+	ret := changes{
+		tag:     tag,
+		prevTag: prevTag,
+		groups:  make(map[string][]changeCommit),
+	}
+
+	r, err := openRepo(repoRoot)
+	if err != nil {
+		return ret, err
+	}
+	commits, err := r.commits(prevTag, ref)
+	if err != nil {
+		return ret, err
+	}
+	for _, c := range commits {
+		if strings.HasPrefix(c.subject, _releaseCommitPrefix) {
+			continue
+		}
+		title, subject := groupCommit(c)
+		c.subject = subject
+		ret.groups[title] = append(ret.groups[title], c)
+	}
+
+	ret.zigVersion, err = zigVersionAt(r, ref)
+	if err != nil {
+		return ret, err
+	}
+	glibcs, err := glibcsAt(r, ref)
+	if err != nil {
+		return ret, err
+	}
+	if prevTag == "" {
+		ret.prevZigVersion = ret.zigVersion
+		return ret, nil
+	}
+
+	ret.prevZigVersion, err = zigVersionAt(r, prevTag)
+	if err != nil {
+		return ret, err
+	}
+	prevGlibcs, err := glibcsAt(r, prevTag)
+	if err != nil {
+		return ret, err
+	}
+	old := make(map[string]bool, len(prevGlibcs))
+	for _, g := range prevGlibcs {
+		old[g] = true
+	}
+	for _, g := range glibcs {
+		if !old[g] {
+			ret.newGlibcs = append(ret.newGlibcs, g)
+		}
+	}
+
+	return ret, nil
+}
+
+// groupCommit returns the _changeGroups title of c and its subject without
+// the conventional prefix of that group.
+func groupCommit(c changeCommit) (string, string) {
+	if m := _conventionalRegexp.FindStringSubmatch(c.subject); m != nil {
+		for _, g := range _changeGroups {
+			if g.prefix != m[1] {
+				continue
+			}
+			if m[3] != "" {
+				return g.title, m[3] + ": " + m[4]
+			}
+			return g.title, m[4]
+		}
+	}
+
+	for _, g := range _changeGroups {
+		for _, p := range g.paths {
+			for _, f := range c.files {
+				if strings.HasPrefix(f, p) {
+					return g.title, c.subject
+				}
+			}
+		}
+	}
+	return "Other", c.subject
+}
+
+func zigVersionAt(r *gitRepo, ref string) (string, error) {
+	data, err := r.readFile(ref, zigsdk.ZigSDKPath)
+	if err != nil {
+		return "", err
+	}
+	upstream, err := zigsdk.ParseUpstreamData(zigsdk.ZigSDKPath, data)
+	if err != nil {
+		return "", err
+	}
+	return upstream.Version, nil
+}
+
+func glibcsAt(r *gitRepo, ref string) ([]string, error) {
+	data, err := r.readFile(ref, _glibcsPath)
+	if err != nil {
+		return nil, err
+	}
+	f, err := bzlconfig.Parse(_glibcsPath, data)
+	if err != nil {
+		return nil, err
+	}
+	return f.StringList(_glibcsVar)
+}
+
+// markdown renders the changes as a CHANGELOG.md section.
+func (c changes) markdown() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "## %s\n\n", c.tag)
+	if c.prevTag != "" {
+		fmt.Fprintf(&sb, "Changes since %s.\n\n", c.prevTag)
+	}
+
+	var upgrade []string
+	if c.prevZigVersion != c.zigVersion {
+		upgrade = append(upgrade, fmt.Sprintf("- Zig SDK upgraded from %s to %s.", c.prevZigVersion, c.zigVersion))
+	}
+	if len(c.newGlibcs) > 0 {
+		upgrade = append(upgrade, fmt.Sprintf("- New glibc versions: %s.", strings.Join(c.newGlibcs, ", ")))
+	}
+	if len(upgrade) > 0 {
+		fmt.Fprintf(&sb, "### Upgrade notes\n\n%s\n\n", strings.Join(upgrade, "\n"))
+	}
+
+	empty := true
+	for _, g := range _changeGroups {
+		commits := c.groups[g.title]
+		if len(commits) == 0 {
+			continue
+		}
+		empty = false
+		fmt.Fprintf(&sb, "### %s\n\n", g.title)
+		for _, commit := range commits {
+			fmt.Fprintf(&sb, "- %s (%s)\n", commit.subject, commit.hash)
+		}
+		sb.WriteString("\n")
+	}
+	if empty {
+		sb.WriteString("No changes.\n\n")
+	}
+
+	return sb.String()
+}
+
+// releaseNotes renders the body of the release, with the changes and how to
+// use the release.
+func (c changes) releaseNotes(boilerplate, moduleBoilerplate string) string {
+	section := strings.TrimPrefix(c.markdown(), fmt.Sprintf("## %s\n\n", c.tag))
+	return fmt.Sprintf("%s## Using bzlmod\n\n```starlark\n%s```\n\n## Using WORKSPACE\n\n```starlark\n%s```\n",
+		section, moduleBoilerplate, boilerplate)
+}
+
+// updateChangelog adds the section of the release to the top of
+// CHANGELOG.md, unless it is already there.
+func updateChangelog(files *pendingFiles, c changes) error {
+	data, err := files.read(_changelogPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if len(data) == 0 {
+		data = []byte(_changelogHeader)
+	}
+	if !bytes.HasPrefix(data, []byte(_changelogHeader)) {
+		return fmt.Errorf("%s does not start with %q", _changelogPath, _changelogHeader)
+	}
+
+	heading := fmt.Sprintf("## %s\n", c.tag)
+	if bytes.HasPrefix(data, []byte(heading)) || bytes.Contains(data, []byte("\n"+heading)) {
+		return nil
+	}
+
+	rest := bytes.TrimLeft(data[len(_changelogHeader):], "\n")
+	var buf bytes.Buffer
+	buf.WriteString(_changelogHeader)
+	buf.WriteString("\n")
+	buf.WriteString(c.markdown())
+	buf.Write(rest)
+	files.write(_changelogPath, append(bytes.TrimRight(buf.Bytes(), "\n"), '\n'))
+	return nil
+}
@@ -0,0 +1,199 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+package main
+
+import (
+	"os"
+	"path"
+	"sort"
+	"testing"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/hermetic_cc_toolchain/tools/internal/zigsdk"
+)
+
+// initRepo creates a git repository with zig_sdk.bzl and _GLIBCS.
+func initRepo(t *testing.T) string {
+	t.Helper()
+	repoRoot := initGitRepo(t)
+	commitFiles(t, repoRoot, "initial", map[string]string{
+		zigsdk.ZigSDKPath: `VERSION = "0.15.1"
+URL_FORMAT_RELEASE = "https://example.com/{version}"
+`,
+		_glibcsPath: `_GLIBCS = ["2.17", "2.28"]`,
+	})
+	return repoRoot
+}
+
+func TestCompareTags(t *testing.T) {
+	tags := []string{"v1.0.1", "v1.0.0", "v10.0.0", "v1.0.0-rc10", "v1.0.0-rc2", "v2.0.0-rc1", "v1.10.0"}
+	sort.Slice(tags, func(i, j int) bool { return compareTags(tags[i], tags[j]) < 0 })
+	assert.Equal(t, []string{"v1.0.0-rc2", "v1.0.0-rc10", "v1.0.0", "v1.0.1", "v1.10.0", "v2.0.0-rc1", "v10.0.0"}, tags)
+	assert.Equal(t, 0, compareTags("v1.0.0", "v1.0.0"))
+}
+
+func TestPreviousTag(t *testing.T) {
+	repoRoot := initRepo(t)
+	for _, tag := range []string{"v1.0.0-rc1", "v1.0.0", "v1.1.0-rc1", "not-a-release"} {
+		tagRepo(t, repoRoot, tag, "HEAD")
+	}
+
+	for tag, want := range map[string]string{
+		"v1.0.0-rc1": "",
+		"v1.0.0":     "v1.0.0-rc1",
+		"v1.0.1":     "v1.0.0",
+		"v1.1.0-rc2": "v1.1.0-rc1",
+		"v1.1.0":     "v1.1.0-rc1",
+	} {
+		got, err := previousTag(repoRoot, tag, "HEAD")
+		require.NoError(t, err)
+		assert.Equal(t, want, got, tag)
+	}
+}
+
+func TestPreviousTagBranches(t *testing.T) {
+	// main:        v1.1.0 -- v1.2.0-rc1
+	//                \
+	// release-1.1:   v1.1.1 -- fix
+	repoRoot := initRepo(t)
+	tagRepo(t, repoRoot, "v1.1.0", "HEAD")
+	commitFiles(t, repoRoot, "feat: new", map[string]string{"new.bzl": ""})
+	tagRepo(t, repoRoot, "v1.2.0-rc1", "HEAD")
+	r, err := openRepo(repoRoot)
+	require.NoError(t, err)
+	v110, err := r.resolve("v1.1.0")
+	require.NoError(t, err)
+	checkoutRepo(t, repoRoot, &gogit.CheckoutOptions{
+		Branch: plumbing.NewBranchReferenceName("release-1.1"),
+		Create: true,
+		Hash:   v110.Hash,
+	})
+	commitFiles(t, repoRoot, "fix: backport", map[string]string{"fix.bzl": ""})
+	tagRepo(t, repoRoot, "v1.1.1", "HEAD")
+	commitFiles(t, repoRoot, "fix: another backport", map[string]string{"fix2.bzl": ""})
+
+	// v1.1.1 is not on main.
+	got, err := previousTag(repoRoot, "v1.2.0", "main")
+	require.NoError(t, err)
+	assert.Equal(t, "v1.2.0-rc1", got)
+	got, err = previousTag(repoRoot, "v1.2.0-rc2", "main")
+	require.NoError(t, err)
+	assert.Equal(t, "v1.2.0-rc1", got)
+
+	got, err = previousTag(repoRoot, "v1.1.2", "HEAD")
+	require.NoError(t, err)
+	assert.Equal(t, "v1.1.1", got)
+	changes, err := collectChanges(repoRoot, "v1.1.2", got, "HEAD")
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]changeCommit{"Bug fixes": changes.groups["Bug fixes"]}, changes.groups)
+	require.Len(t, changes.groups["Bug fixes"], 1)
+	assert.Equal(t, "another backport", changes.groups["Bug fixes"][0].subject)
+}
+
+func TestGroupCommit(t *testing.T) {
+	tests := []struct {
+		subject   string
+		files     []string
+		wantGroup string
+		want      string
+	}{
+		{"feat: add riscv64", []string{"toolchain/defs.bzl"}, "Features", "add riscv64"},
+		{"fix(rules): quote paths", []string{"rules/platform.bzl"}, "Bug fixes", "rules: quote paths"},
+		{"chore: bump deps", []string{"toolchain/zig-wrapper.zig", "toolchain/defs.bzl"}, "zig-wrapper", "chore: bump deps"},
+		{"Support glibc 2.41", []string{"toolchain/private/defs.bzl"}, "Toolchain", "Support glibc 2.41"},
+		{"platform: add windows", []string{"rules/platform.bzl"}, "Rules", "platform: add windows"},
+		{"test: cover soname", []string{"test/c/BUILD"}, "Tests", "cover soname"},
+		{"releaser: sign", []string{"tools/releaser/main.go"}, "Tools", "releaser: sign"},
+		{"Update .bazelversion", []string{".bazelversion"}, "Other", "Update .bazelversion"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.subject, func(t *testing.T) {
+			group, subject := groupCommit(changeCommit{subject: tt.subject, files: tt.files})
+			assert.Equal(t, tt.wantGroup, group)
+			assert.Equal(t, tt.want, subject)
+		})
+	}
+}
+
+func TestCollectChanges(t *testing.T) {
+	repoRoot := initRepo(t)
+	tagRepo(t, repoRoot, "v1.0.0", "HEAD")
+
+	commitFiles(t, repoRoot, "feat: upgrade zig", map[string]string{
+		zigsdk.ZigSDKPath: `VERSION = "0.15.2"
+URL_FORMAT_RELEASE = "https://example.com/{version}"
+`,
+	})
+	commitFiles(t, repoRoot, "Add glibc 2.41", map[string]string{
+		_glibcsPath: `_GLIBCS = ["2.17", "2.28", "2.41"]`,
+	})
+
+	got, err := collectChanges(repoRoot, "v1.1.0", "v1.0.0", "HEAD")
+	require.NoError(t, err)
+	assert.Equal(t, "0.15.1", got.prevZigVersion)
+	assert.Equal(t, "0.15.2", got.zigVersion)
+	assert.Equal(t, []string{"2.41"}, got.newGlibcs)
+	require.Len(t, got.groups["Features"], 1)
+	assert.Equal(t, "upgrade zig", got.groups["Features"][0].subject)
+	require.Len(t, got.groups["Toolchain"], 1)
+	assert.Equal(t, "Add glibc 2.41", got.groups["Toolchain"][0].subject)
+
+	md := got.markdown()
+	assert.Contains(t, md, "## v1.1.0\n\nChanges since v1.0.0.\n\n")
+	assert.Contains(t, md, "- Zig SDK upgraded from 0.15.1 to 0.15.2.\n- New glibc versions: 2.41.\n")
+	assert.Contains(t, md, "### Features\n\n- upgrade zig (")
+
+	notes := got.releaseNotes("http_archive(...)\n", "bazel_dep(...)\n")
+	assert.NotContains(t, notes, "## v1.1.0")
+	assert.Contains(t, notes, "## Using bzlmod\n\n```starlark\nbazel_dep(...)\n```\n")
+	assert.Contains(t, notes, "## Using WORKSPACE\n\n```starlark\nhttp_archive(...)\n```\n")
+}
+
+func TestCollectChangesFirstRelease(t *testing.T) {
+	repoRoot := initRepo(t)
+	got, err := collectChanges(repoRoot, "v1.0.0", "", "HEAD")
+	require.NoError(t, err)
+	assert.Equal(t, got.prevZigVersion, got.zigVersion)
+	assert.Empty(t, got.newGlibcs)
+	assert.Len(t, got.groups["Toolchain"], 1)
+}
+
+func TestUpdateChangelog(t *testing.T) {
+	repoRoot := t.TempDir()
+	files := newPendingFiles(repoRoot)
+
+	v1 := changes{tag: "v1.0.0", groups: map[string][]changeCommit{
+		"Features": {{hash: "aaaaaaa", subject: "first"}},
+	}}
+	require.NoError(t, updateChangelog(files, v1))
+	v2 := changes{tag: "v1.1.0", prevTag: "v1.0.0"}
+	require.NoError(t, updateChangelog(files, v2))
+	// already there
+	require.NoError(t, updateChangelog(files, v1))
+
+	got, err := files.read(_changelogPath)
+	require.NoError(t, err)
+	assert.Equal(t, `# Changelog
+
+## v1.1.0
+
+Changes since v1.0.0.
+
+No changes.
+
+## v1.0.0
+
+### Features
+
+- first (aaaaaaa)
+`, string(got))
+
+	require.NoError(t, os.WriteFile(path.Join(repoRoot, _changelogPath), []byte("Changes\n"), 0644))
+	err = updateChangelog(newPendingFiles(repoRoot), v1)
+	assert.ErrorContains(t, err, `CHANGELOG.md does not start with "# Changelog\n"`)
+}
@@ -0,0 +1,157 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// runCheck is `releaser check`. It checks that the boilerplate in the
+// working tree is the one of the latest release, and the toolchain
+// constants that checkToolchainConfig checks, without writing anything, so
+// it can run on any checkout, e.g. in presubmit of a fork.
+func runCheck(args []string) error {
+	var (
+		repoRoot string
+		tag      string
+	)
+
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	fs.StringVar(&repoRoot, "repoRoot", os.Getenv("BUILD_WORKSPACE_DIRECTORY"), "root directory of hermetic_cc_toolchain repo")
+	fs.StringVar(&tag, "tag", "", "release to check the boilerplate of; by default the latest tag")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), `usage: bazel run //tools/releaser -- check [-tag <tag>]
+
+Checks that the README, the examples and MODULE.bazel refer to the latest
+release, with the archives it has in releases.json, and that the toolchain
+constants are consistent. Nothing is written, committed or tagged.
+
+`)
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("check: unexpected arguments %q", fs.Args())
+	}
+
+	// The toolchain files are read from the workspace, like the release
+	// does.
+	if err := checkToolchainConfig(repoRoot); err != nil {
+		return err
+	}
+
+	if tag == "" {
+		var err error
+		tag, err = latestTag(repoRoot)
+		if err != nil {
+			return err
+		}
+		if tag == "" {
+			return fmt.Errorf("check: no release tags in %q", repoRoot)
+		}
+	} else if !_tagRegexp.MatchString(tag) {
+		return _errTag
+	}
+
+	files, err := checkBoilerplate(repoRoot, tag)
+	if err != nil {
+		return err
+	}
+	changed, err := files.changed()
+	if err != nil {
+		return err
+	}
+	if len(changed) == 0 {
+		log("the boilerplate is up to date with %s", tag)
+		return nil
+	}
+
+	diff, err := files.diff()
+	if err != nil {
+		return err
+	}
+	log("the boilerplate differs from %s:\n%s", tag, diff)
+	return fmt.Errorf(
+		"%d file(s) are out of date with %s: %s; run the releaser with -tag %s to update them",
+		len(changed),
+		tag,
+		strings.Join(changed, ", "),
+		tag,
+	)
+}
+
+// latestTag returns the latest release tag, or "" if there is none.
+func latestTag(repoRoot string) (string, error) {
+	r, err := openRepo(repoRoot)
+	if err != nil {
+		return "", err
+	}
+	tags, err := r.tags()
+	if err != nil {
+		return "", err
+	}
+
+	var latest string
+	for _, t := range tags {
+		if !_tagRegexp.MatchString(t) {
+			continue
+		}
+		if latest == "" || compareTags(t, latest) > 0 {
+			latest = t
+		}
+	}
+	return latest, nil
+}
+
+// checkBoilerplate returns the boilerplate files and MODULE.bazel as they
+// would be after releasing tag. The archives of tag are the ones recorded
+// in releases.json. If tag is not recorded there, e.g. it was not released
+// yet, only its tarball is rebuilt from tag.
+func checkBoilerplate(repoRoot, tag string) (*pendingFiles, error) {
+	manifest, err := readReleaseManifest(repoRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	release, ok := manifest.lookup(tag)
+	if !ok {
+		release, err = rebuildRelease(repoRoot, tag)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	files := newPendingFiles(repoRoot)
+	if err := updateBoilerplate(files, genBoilerplate(release)); err != nil {
+		return nil, fmt.Errorf("update boilerplate: %w", err)
+	}
+	if err := updateModuleBoilerplate(files, tag); err != nil {
+		return nil, fmt.Errorf("update bzlmod boilerplate: %w", err)
+	}
+	if err := updateModuleVersion(files, tag); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// rebuildRelease returns the release entry of tag, which is not in
+// releases.json, with its tarball rebuilt from tag.
+func rebuildRelease(repoRoot, tag string) (releaseEntry, error) {
+	module, err := moduleAt(repoRoot, tag, tag)
+	if err != nil {
+		return releaseEntry{}, err
+	}
+	shasum, err := makeTgz(io.Discard, repoRoot, tag, map[string][]byte{"MODULE.bazel": module})
+	if err != nil {
+		return releaseEntry{}, fmt.Errorf("rebuild release tarball: %w", err)
+	}
+	return releaseEntry{Tag: tag, SHA256: shasum}, nil
+}
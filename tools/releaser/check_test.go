@@ -0,0 +1,140 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+package main
+
+import (
+	"io"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLatestTag(t *testing.T) {
+	repoRoot := initRepo(t)
+	got, err := latestTag(repoRoot)
+	require.NoError(t, err)
+	assert.Empty(t, got)
+
+	for _, tag := range []string{"v1.0.0-rc2", "v1.0.0-rc10", "v0.9.0", "vnext"} {
+		tagRepo(t, repoRoot, tag, "HEAD")
+	}
+	got, err = latestTag(repoRoot)
+	require.NoError(t, err)
+	assert.Equal(t, "v1.0.0-rc10", got)
+}
+
+// initBoilerplateRepo creates a release repository with the boilerplate and
+// MODULE.bazel of v0.9.0 after the v1.0.0-rc1 tag.
+func initBoilerplateRepo(t *testing.T) string {
+	t.Helper()
+	repoRoot := initReleaseRepo(t)
+	files := map[string]string{
+		_releasesPath: `{"version": 1, "releases": []}`,
+	}
+	for _, f := range _boilerplateFiles {
+		files[f] = "# Setup\n\n" + genBoilerplate(releaseEntry{Tag: "v0.9.0", SHA256: _testSHA256}) + "\nMore docs.\n"
+	}
+	files[_moduleBoilerplateFiles[1]] = genModuleRegion("v0.9.0")
+	files["MODULE.bazel"] = `module(
+    name = "hermetic_cc_toolchain",
+    version = "0.9.0",
+)
+`
+	commitFiles(t, repoRoot, "add docs", files)
+	// README.md is both a WORKSPACE and a bzlmod boilerplate file.
+	readme := files["README.md"] + "\n" + genModuleRegion("v0.9.0")
+	require.NoError(t, os.WriteFile(path.Join(repoRoot, "README.md"), []byte(readme), 0644))
+	return repoRoot
+}
+
+func TestCheckBoilerplate(t *testing.T) {
+	repoRoot := initBoilerplateRepo(t)
+
+	files, err := checkBoilerplate(repoRoot, "v1.0.0-rc1")
+	require.NoError(t, err)
+	changed, err := files.changed()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		"MODULE.bazel",
+		"README.md",
+		"examples/bzlmod/MODULE.bazel",
+		"examples/rules_cc/WORKSPACE",
+	}, changed)
+
+	// v1.0.0-rc1 is not in releases.json, so its sha256 is rebuilt.
+	module, err := moduleAt(repoRoot, "v1.0.0-rc1", "v1.0.0-rc1")
+	require.NoError(t, err)
+	shasum, err := makeTgz(io.Discard, repoRoot, "v1.0.0-rc1", map[string][]byte{"MODULE.bazel": module})
+	require.NoError(t, err)
+	diff, err := files.diff()
+	require.NoError(t, err)
+	assert.Contains(t, diff, `+    sha256 = "`+shasum+`",`)
+	assert.Contains(t, diff, `-bazel_dep(name = "hermetic_cc_toolchain", version = "0.9.0")`)
+	assert.Contains(t, diff, `-    version = "0.9.0",
++    version = "1.0.0-rc1",`)
+
+	// Nothing was written.
+	got, err := os.ReadFile(path.Join(repoRoot, "examples/rules_cc/WORKSPACE"))
+	require.NoError(t, err)
+	assert.Contains(t, string(got), `HERMETIC_CC_TOOLCHAIN_VERSION = "v0.9.0"`)
+
+	// Once updated, the boilerplate is up to date, whatever else is
+	// changed in the working tree.
+	require.NoError(t, files.flush())
+	require.NoError(t, os.WriteFile(path.Join(repoRoot, "LICENSE"), []byte("GPL"), 0644))
+	files, err = checkBoilerplate(repoRoot, "v1.0.0-rc1")
+	require.NoError(t, err)
+	changed, err = files.changed()
+	require.NoError(t, err)
+	assert.Empty(t, changed)
+}
+
+func TestCheckBoilerplateRecorded(t *testing.T) {
+	repoRoot := initBoilerplateRepo(t)
+	shasum := strings.Repeat("ab", 32)
+	require.NoError(t, os.WriteFile(path.Join(repoRoot, _releasesPath), []byte(`{"version": 1, "releases": [
+		{"tag": "v1.0.0-rc1", "sha256": "`+shasum+`", "hash": "pinned"}
+	]}`), 0644))
+
+	files, err := checkBoilerplate(repoRoot, "v1.0.0-rc1")
+	require.NoError(t, err)
+	diff, err := files.diff()
+	require.NoError(t, err)
+	assert.Contains(t, diff, `+    sha256 = "`+shasum+`",`)
+	assert.NotContains(t, diff, "also available")
+
+	// The other formats of the release have their own lines.
+	zip, err := newManifestArchive("v1.0.0-rc1", "zip", _testSHA256)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path.Join(repoRoot, _releasesPath), []byte(`{"version": 1, "releases": [
+		{"tag": "v1.0.0-rc1", "sha256": "`+shasum+`", "hash": "pinned", "archives": [
+			{"format": "tar.gz", "url": "`+releaseURL("v1.0.0-rc1", _tgzFormat)+`", "sha256": "`+shasum+`", "integrity": "sha256-q6urq6urq6urq6urq6urq6urq6urq6urq6urq6urq6s="},
+			{"format": "zip", "url": "`+zip.URL+`", "sha256": "`+zip.SHA256+`", "integrity": "`+zip.Integrity+`"}
+		]}
+	]}`), 0644))
+	files, err = checkBoilerplate(repoRoot, "v1.0.0-rc1")
+	require.NoError(t, err)
+	diff, err = files.diff()
+	require.NoError(t, err)
+	assert.Contains(t, diff, `+#   .zip: sha256 = "`+_testSHA256+`", integrity = "`+zip.Integrity+`"`)
+}
+
+// TestCheckBoilerplateAfterRelease checks the boilerplate of a release
+// with the formats it was released with, whatever -formats it had.
+func TestCheckBoilerplateAfterRelease(t *testing.T) {
+	repoRoot := initFixtureRepo(t)
+	cfg := fixtureConfig(repoRoot)
+	cfg.formats = []string{_tgzFormat, "tar.zst", "zip"}
+	require.NoError(t, release(cfg, fixtureDeps(t, fixtureMirror(t), io.Discard)))
+
+	files, err := checkBoilerplate(repoRoot, "v1.0.0")
+	require.NoError(t, err)
+	changed, err := files.changed()
+	require.NoError(t, err)
+	assert.Empty(t, changed)
+}
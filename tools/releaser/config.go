@@ -0,0 +1,77 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+
+	"github.com/uber/hermetic_cc_toolchain/tools/internal/bzlconfig"
+	"github.com/uber/hermetic_cc_toolchain/tools/internal/zigsdk"
+)
+
+const (
+	// _glibcsPath defines _GLIBCS, the glibc versions of the linux
+	// toolchains.
+	_glibcsPath = "toolchain/private/defs.bzl"
+	_glibcsVar  = "_GLIBCS"
+)
+
+var (
+	_sha256Regexp = regexp.MustCompile(`^[0-9a-f]{64}$`)
+	_glibcRegexp  = regexp.MustCompile(`^2\.([0-9]+)$`)
+)
+
+// checkToolchainConfig checks the invariants of the toolchain's .bzl
+// constants that Starlark does not enforce:
+//
+//   - every host platform has a sha256 and an archive extension;
+//   - the sha256s look like sha256s;
+//   - _GLIBCS are glibc 2.x versions in increasing order.
+func checkToolchainConfig(repoRoot string) error {
+	platforms, err := zigsdk.ParseHostPlatforms(
+		path.Join(repoRoot, zigsdk.ZigSDKPath),
+		path.Join(repoRoot, zigsdk.DefsPath),
+	)
+	if err != nil {
+		return err
+	}
+	for _, platform := range platforms.Names() {
+		if shasum := platforms.SHA256[platform]; !_sha256Regexp.MatchString(shasum) {
+			return fmt.Errorf("%s: %s[%q] = %q is not a sha256", zigsdk.ZigSDKPath, zigsdk.HostSHA256Var, platform, shasum)
+		}
+	}
+
+	defs, err := bzlconfig.Read(path.Join(repoRoot, _glibcsPath))
+	if err != nil {
+		return err
+	}
+	glibcs, err := defs.StringList(_glibcsVar)
+	if err != nil {
+		return err
+	}
+	if len(glibcs) == 0 {
+		return fmt.Errorf("%s: %s is empty", _glibcsPath, _glibcsVar)
+	}
+
+	prev := -1
+	for _, glibc := range glibcs {
+		m := _glibcRegexp.FindStringSubmatch(glibc)
+		if m == nil {
+			return fmt.Errorf("%s: %s: %q is not a glibc 2.x version", _glibcsPath, _glibcsVar, glibc)
+		}
+		minor, err := strconv.Atoi(m[1])
+		if err != nil {
+			return fmt.Errorf("%s: %s: %q: %w", _glibcsPath, _glibcsVar, glibc, err)
+		}
+		if minor <= prev {
+			return fmt.Errorf("%s: %s: %q is not greater than 2.%d", _glibcsPath, _glibcsVar, glibc, prev)
+		}
+		prev = minor
+	}
+
+	return nil
+}
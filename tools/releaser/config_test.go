@@ -0,0 +1,80 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckToolchainConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		glibcs  string
+		wantErr string
+	}{
+		{
+			name:   "ok",
+			glibcs: `_GLIBCS = ["2.17", "2.18", "2.41"]`,
+		},
+		{
+			name:    "out of order",
+			glibcs:  `_GLIBCS = ["2.17", "2.28", "2.18"]`,
+			wantErr: `"2.18" is not greater than 2.28`,
+		},
+		{
+			name:    "duplicate",
+			glibcs:  `_GLIBCS = ["2.17", "2.17"]`,
+			wantErr: `"2.17" is not greater than 2.17`,
+		},
+		{
+			name:    "not a glibc version",
+			glibcs:  `_GLIBCS = ["2.17", "musl"]`,
+			wantErr: `"musl" is not a glibc 2.x version`,
+		},
+		{
+			name:    "empty",
+			glibcs:  `_GLIBCS = []`,
+			wantErr: "_GLIBCS is empty",
+		},
+		{
+			name:    "not a list of strings",
+			glibcs:  "_GLIBCS = [\n    \"2.17\",\n    2.18,\n]",
+			wantErr: "toolchain/private/defs.bzl:3:5: _GLIBCS: got a literal in a list of strings",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repoRoot := t.TempDir()
+			writeZigSDK(t, repoRoot, "https://example.com/{version}")
+			fpath := path.Join(repoRoot, _glibcsPath)
+			require.NoError(t, os.WriteFile(fpath, []byte(tt.glibcs), 0644))
+
+			err := checkToolchainConfig(repoRoot)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestCheckToolchainConfigRepo(t *testing.T) {
+	// The toolchain files are not in the runfiles of `bazel test`, which
+	// only has the releaser; `releaser check` reads them from the
+	// workspace in CI.
+	repoRoot := path.Join("..", "..")
+	if _, err := os.Stat(path.Join(repoRoot, _glibcsPath)); errors.Is(err, fs.ErrNotExist) {
+		t.Skipf("%s is not in the runfiles", _glibcsPath)
+	}
+	assert.NoError(t, checkToolchainConfig(repoRoot))
+}
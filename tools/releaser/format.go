@@ -0,0 +1,219 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// _tgzFormat is the format of the release tarball that the boilerplate,
+// the BCR entry and releases.json refer to. It is always built.
+const _tgzFormat = "tar.gz"
+
+var (
+	// _archiveModTime is the modification time of every archive entry.
+	_archiveModTime = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	// _archiveFormats are the formats of -formats, in the order they are
+	// reported.
+	_archiveFormats = []struct {
+		ext   string
+		write func(io.Writer, []archiveEntry) error
+	}{
+		{ext: _tgzFormat, write: writeTgz},
+		{ext: "tar.zst", write: writeTarZst},
+		{ext: "zip", write: writeZip},
+	}
+)
+
+// releaseArchive is the release archive in one format.
+type releaseArchive struct {
+	Format    string `json:"format"`
+	Path      string `json:"path"`
+	SHA256    string `json:"sha256"`
+	Integrity string `json:"integrity"`
+}
+
+// parseFormats parses the comma-separated -formats. The returned formats
+// are in the order of _archiveFormats, and always include tar.gz.
+func parseFormats(s string) ([]string, error) {
+	want := make(map[string]bool)
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		if !isArchiveFormat(f) {
+			return nil, fmt.Errorf("-formats: unknown format %q, expected some of %s", f, strings.Join(archiveFormatNames(), ","))
+		}
+		if want[f] {
+			return nil, fmt.Errorf("-formats: %q is given twice", f)
+		}
+		want[f] = true
+	}
+	if !want[_tgzFormat] {
+		return nil, fmt.Errorf("-formats must include %s, which the boilerplate refers to", _tgzFormat)
+	}
+
+	var ret []string
+	for _, f := range archiveFormatNames() {
+		if want[f] {
+			ret = append(ret, f)
+		}
+	}
+	return ret, nil
+}
+
+func archiveFormatNames() []string {
+	ret := make([]string, 0, len(_archiveFormats))
+	for _, f := range _archiveFormats {
+		ret = append(ret, f.ext)
+	}
+	return ret
+}
+
+func isArchiveFormat(format string) bool {
+	for _, f := range _archiveFormats {
+		if f.ext == format {
+			return true
+		}
+	}
+	return false
+}
+
+// archivePath returns the path of the release archive of tag in format.
+func archivePath(dir, tag, format string) string {
+	return path.Join(dir, fmt.Sprintf("hermetic_cc_toolchain-%s.%s", tag, format))
+}
+
+// writeArchive writes entries to w in format and returns the sha256 of what
+// was written.
+func writeArchive(w io.Writer, format string, entries []archiveEntry) (string, error) {
+	for _, f := range _archiveFormats {
+		if f.ext != format {
+			continue
+		}
+		hashw := sha256.New()
+		if err := f.write(io.MultiWriter(w, hashw), entries); err != nil {
+			return "", fmt.Errorf("write %s archive: %w", format, err)
+		}
+		return fmt.Sprintf("%x", hashw.Sum(nil)), nil
+	}
+	return "", fmt.Errorf("unknown archive format %q", format)
+}
+
+// writeTar writes the entries as a tarball. The headers have nothing but
+// the name, mode and size of the entry, so the tarball only depends on
+// the contents.
+func writeTar(w io.Writer, entries []archiveEntry) error {
+	tw := tar.NewWriter(w)
+	for _, e := range entries {
+		// Directories are inferred from the trailing slash of the name.
+		if err := tw.WriteHeader(&tar.Header{
+			Name:    e.name,
+			Mode:    e.mode,
+			Size:    int64(len(e.data)),
+			ModTime: _archiveModTime,
+			Format:  tar.FormatGNU,
+		}); err != nil {
+			return err
+		}
+		if _, err := tw.Write(e.data); err != nil {
+			return fmt.Errorf("writing %q to archive: %w", e.name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("close tar writer: %w", err)
+	}
+	return nil
+}
+
+func writeTgz(w io.Writer, entries []archiveEntry) error {
+	gzw, err := gzip.NewWriterLevel(w, gzip.BestCompression)
+	if err != nil {
+		return fmt.Errorf("create gzip writer: %w", err)
+	}
+	if err := writeTar(gzw, entries); err != nil {
+		return err
+	}
+	if err := gzw.Close(); err != nil {
+		return fmt.Errorf("close gzip stream: %w", err)
+	}
+	return nil
+}
+
+// writeTarZst compresses the tarball with zstd. The output of a single
+// encoder goroutine only depends on the input and the klauspost/compress
+// version in go.mod.
+func writeTarZst(w io.Writer, entries []archiveEntry) error {
+	zw, err := zstd.NewWriter(w,
+		zstd.WithEncoderLevel(zstd.SpeedBetterCompression),
+		zstd.WithEncoderConcurrency(1),
+	)
+	if err != nil {
+		return fmt.Errorf("create zstd writer: %w", err)
+	}
+	if err := writeTar(zw, entries); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("close zstd stream: %w", err)
+	}
+	return nil
+}
+
+// writeZip writes the entries as a zip file with the same names, modes and
+// modification time as the tarball.
+func writeZip(w io.Writer, entries []archiveEntry) error {
+	zw := zip.NewWriter(w)
+	for _, e := range entries {
+		hdr := &zip.FileHeader{
+			Name:     e.name,
+			Method:   zip.Deflate,
+			Modified: _archiveModTime,
+		}
+		mode := fs.FileMode(e.mode)
+		if e.isDir() {
+			hdr.Method = zip.Store
+			mode |= fs.ModeDir
+		}
+		hdr.SetMode(mode)
+
+		fw, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(e.data); err != nil {
+			return fmt.Errorf("writing %q to archive: %w", e.name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("close zip writer: %w", err)
+	}
+	return nil
+}
+
+func newReleaseArchive(format, fpath, shasum string) (releaseArchive, error) {
+	integrity, err := sriSHA256(shasum)
+	if err != nil {
+		return releaseArchive{}, err
+	}
+	return releaseArchive{
+		Format:    format,
+		Path:      fpath,
+		SHA256:    shasum,
+		Integrity: integrity,
+	}, nil
+}
@@ -0,0 +1,153 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFormats(t *testing.T) {
+	tests := []struct {
+		flag    string
+		want    []string
+		wantErr string
+	}{
+		{flag: "tar.gz", want: []string{"tar.gz"}},
+		{flag: "zip, tar.gz,tar.zst", want: []string{"tar.gz", "tar.zst", "zip"}},
+		{flag: "tar.zst", wantErr: "-formats must include tar.gz"},
+		{flag: "tar.gz,tar.xz", wantErr: `unknown format "tar.xz", expected some of tar.gz,tar.zst,zip`},
+		{flag: "tar.gz,zip,zip", wantErr: `"zip" is given twice`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.flag, func(t *testing.T) {
+			got, err := parseFormats(tt.flag)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestArchiveFormatsDeterministic(t *testing.T) {
+	repoRoot := initReleaseRepo(t)
+	overrides := map[string][]byte{"MODULE.bazel": []byte("module()\n")}
+
+	var tgz bytes.Buffer
+	_, err := makeTgz(&tgz, repoRoot, "HEAD", overrides)
+	require.NoError(t, err)
+	want, err := readTgzEntries(&tgz)
+	require.NoError(t, err)
+
+	for _, format := range archiveFormatNames() {
+		t.Run(format, func(t *testing.T) {
+			var first, second bytes.Buffer
+			hash, err := makeArchive(&first, repoRoot, "HEAD", overrides, format)
+			require.NoError(t, err)
+			assert.Equal(t, fmt.Sprintf("%x", sha256.Sum256(first.Bytes())), hash)
+
+			// Committing does not change the archive of the same tree.
+			commitFiles(t, repoRoot, "empty "+format, nil)
+			_, err = makeArchive(&second, repoRoot, "HEAD", overrides, format)
+			require.NoError(t, err)
+			assert.Equal(t, first.Bytes(), second.Bytes())
+
+			got, err := readArchiveEntriesOf(t, format, first.Bytes())
+			require.NoError(t, err)
+			assert.Equal(t, want, got)
+		})
+	}
+}
+
+// readArchiveEntriesOf reads the entries of an archive in format like
+// readTgzEntries does, checking that their headers are normalized.
+func readArchiveEntriesOf(t *testing.T, format string, data []byte) ([]tarEntry, error) {
+	switch format {
+	case "tar.gz":
+		return readTgzEntries(bytes.NewReader(data))
+	case "tar.zst":
+		zr, err := zstd.NewReader(bytes.NewReader(data))
+		require.NoError(t, err)
+		defer zr.Close()
+		// readTgzEntries wants gzip, so read the tarball here.
+		var ret []tarEntry
+		tr := tar.NewReader(zr)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				return ret, nil
+			}
+			require.NoError(t, err)
+			assert.True(t, _archiveModTime.Equal(hdr.ModTime), hdr.Name)
+			contents, err := io.ReadAll(tr)
+			require.NoError(t, err)
+			ret = append(ret, tarEntry{
+				name:   hdr.Name,
+				mode:   hdr.Mode,
+				size:   hdr.Size,
+				sha256: fmt.Sprintf("%x", sha256.Sum256(contents)),
+				format: hdr.Format,
+			})
+		}
+	case "zip":
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		require.NoError(t, err)
+		var ret []tarEntry
+		for _, f := range zr.File {
+			assert.True(t, _archiveModTime.Equal(f.Modified), f.Name)
+			assert.Equal(t, strings.HasSuffix(f.Name, "/"), f.Mode().IsDir(), f.Name)
+			r, err := f.Open()
+			require.NoError(t, err)
+			contents, err := io.ReadAll(r)
+			require.NoError(t, err)
+			ret = append(ret, tarEntry{
+				name:   f.Name,
+				mode:   int64(f.Mode().Perm()),
+				size:   int64(f.UncompressedSize64),
+				sha256: fmt.Sprintf("%x", sha256.Sum256(contents)),
+				// zip has no tar header format, but the same
+				// entries otherwise.
+				format: tar.FormatGNU,
+			})
+		}
+		return ret, nil
+	}
+	return nil, fmt.Errorf("unknown format %q", format)
+}
+
+func TestGenBoilerplateOtherFormats(t *testing.T) {
+	assert.NotContains(t, genBoilerplate(releaseEntry{Tag: "v4.3.0", SHA256: _testSHA256}), "also available")
+
+	tgz, err := newManifestArchive("v4.3.0", _tgzFormat, _testSHA256)
+	require.NoError(t, err)
+	zst, err := newManifestArchive("v4.3.0", "tar.zst", _testSHA256)
+	require.NoError(t, err)
+	got := genBoilerplate(releaseEntry{
+		Tag:      "v4.3.0",
+		SHA256:   _testSHA256,
+		Archives: []manifestArchive{tgz, zst},
+	})
+	assert.Contains(t, got, `)
+
+# The release is also available in these formats, at the same urls with
+# the extension replaced:
+#   .tar.zst: sha256 = "79338d8c5c4499c7402aea1fe78dcd20267f300e9f8f5886be7017d57ccf0fbc", integrity = "sha256-eTONjFxEmcdAKuof543NICZ/MA6fj1iGvnAX1XzPD7w="
+
+load("@hermetic_cc_toolchain//toolchain:defs.bzl", zig_toolchains = "toolchains")
+`)
+}
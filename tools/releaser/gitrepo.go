@@ -0,0 +1,409 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strings"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// gitRepo is the hermetic_cc_toolchain repository, read and written with a
+// Go git implementation, so the releaser does not depend on a git binary
+// or its version.
+type gitRepo struct {
+	repo *gogit.Repository
+}
+
+// openRepo opens the repository of repoRoot. repoRoot may be a linked
+// worktree of `git worktree add`, whose refs and objects are in the common
+// git directory of the main worktree.
+func openRepo(repoRoot string) (*gitRepo, error) {
+	repo, err := gogit.PlainOpenWithOptions(repoRoot, &gogit.PlainOpenOptions{
+		DetectDotGit:          true,
+		EnableDotGitCommonDir: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("open git repository %q: %w", repoRoot, err)
+	}
+	return &gitRepo{repo: repo}, nil
+}
+
+// resolve returns the commit of ref, e.g. "HEAD", "HEAD~1" or a tag.
+func (r *gitRepo) resolve(ref string) (*object.Commit, error) {
+	hash, err := r.repo.ResolveRevision(plumbing.Revision(ref))
+	if err != nil {
+		return nil, fmt.Errorf("resolve %q: %w", ref, err)
+	}
+	commit, err := r.repo.CommitObject(*hash)
+	if err != nil {
+		return nil, fmt.Errorf("resolve %q: %w", ref, err)
+	}
+	return commit, nil
+}
+
+// commitHash returns the full hash of the commit of ref.
+func (r *gitRepo) commitHash(ref string) (string, error) {
+	commit, err := r.resolve(ref)
+	if err != nil {
+		return "", err
+	}
+	return commit.Hash.String(), nil
+}
+
+// readFile returns the contents of fpath at ref. The error wraps
+// fs.ErrNotExist if ref does not have fpath.
+func (r *gitRepo) readFile(ref, fpath string) ([]byte, error) {
+	commit, err := r.resolve(ref)
+	if err != nil {
+		return nil, err
+	}
+	f, err := commit.File(fpath)
+	if errors.Is(err, object.ErrFileNotFound) {
+		return nil, fmt.Errorf("%s:%s: %w", ref, fpath, fs.ErrNotExist)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s:%s: %w", ref, fpath, err)
+	}
+	contents, err := f.Contents()
+	if err != nil {
+		return nil, fmt.Errorf("%s:%s: %w", ref, fpath, err)
+	}
+	return []byte(contents), nil
+}
+
+// isAncestor returns whether the commit of ancestor is the one of ref or
+// one of its ancestors.
+func (r *gitRepo) isAncestor(ancestor, ref string) (bool, error) {
+	a, err := r.resolve(ancestor)
+	if err != nil {
+		return false, err
+	}
+	c, err := r.resolve(ref)
+	if err != nil {
+		return false, err
+	}
+	return a.IsAncestor(c)
+}
+
+// tags returns the names of all tags.
+func (r *gitRepo) tags() ([]string, error) {
+	iter, err := r.repo.Tags()
+	if err != nil {
+		return nil, err
+	}
+	var ret []string
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		ret = append(ret, ref.Name().Short())
+		return nil
+	})
+	return ret, err
+}
+
+func (r *gitRepo) hasTag(tag string) (bool, error) {
+	_, err := r.repo.Tag(tag)
+	if errors.Is(err, gogit.ErrTagNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// branch returns the current branch, or "" if HEAD is detached.
+func (r *gitRepo) branch() (string, error) {
+	head, err := r.repo.Head()
+	if err != nil {
+		return "", err
+	}
+	if !head.Name().IsBranch() {
+		return "", nil
+	}
+	return head.Name().Short(), nil
+}
+
+// modified returns the tracked files with staged or unstaged changes.
+//
+// Untracked files are ignored, like the `git diff --exit-code` the releaser
+// used to run: the release archives, notes and provenance are written
+// untracked to the root of the repository, and the release commit only
+// adds the files the releaser writes, so other untracked files never make
+// it into a release.
+func (r *gitRepo) modified() ([]string, error) {
+	w, err := r.repo.Worktree()
+	if err != nil {
+		return nil, err
+	}
+	status, err := w.Status()
+	if err != nil {
+		return nil, err
+	}
+	var ret []string
+	for fpath, s := range status {
+		if s.Worktree == gogit.Untracked {
+			continue
+		}
+		if s.Worktree != gogit.Unmodified || s.Staging != gogit.Unmodified {
+			ret = append(ret, fpath)
+		}
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
+
+// commitAll commits paths, which may be new, and all other changes to
+// tracked files, like `git add -- paths && git commit -a`.
+func (r *gitRepo) commitAll(msg string, paths []string) error {
+	w, err := r.repo.Worktree()
+	if err != nil {
+		return err
+	}
+	for _, fpath := range paths {
+		if _, err := w.Add(fpath); err != nil {
+			return fmt.Errorf("git add %q: %w", fpath, err)
+		}
+	}
+	// The author is read from the git config.
+	if _, err := w.Commit(msg, &gogit.CommitOptions{All: true}); err != nil {
+		return fmt.Errorf("git commit: %w", err)
+	}
+	return nil
+}
+
+// createTag creates a lightweight tag of HEAD.
+func (r *gitRepo) createTag(tag string) error {
+	head, err := r.repo.Head()
+	if err != nil {
+		return err
+	}
+	if _, err := r.repo.CreateTag(tag, head.Hash(), nil); err != nil {
+		return fmt.Errorf("git tag %s: %w", tag, err)
+	}
+	return nil
+}
+
+// commits returns the non-merge commits of ref that are not in exclude (if
+// given), newest first, with the files they touched, like
+// `git log --no-merges --name-only exclude..ref`.
+func (r *gitRepo) commits(exclude, ref string) ([]changeCommit, error) {
+	head, err := r.resolve(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	excluded := make(map[plumbing.Hash]bool)
+	if exclude != "" {
+		c, err := r.resolve(exclude)
+		if err != nil {
+			return nil, err
+		}
+		if err := object.NewCommitPreorderIter(c, nil, nil).ForEach(func(c *object.Commit) error {
+			excluded[c.Hash] = true
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	var ret []changeCommit
+	err = object.NewCommitIterCTime(head, excluded, nil).ForEach(func(c *object.Commit) error {
+		if c.NumParents() > 1 {
+			return nil
+		}
+		files, err := changedFiles(c)
+		if err != nil {
+			return fmt.Errorf("commit %s: %w", c.Hash, err)
+		}
+		subject, _, _ := strings.Cut(c.Message, "\n")
+		ret = append(ret, changeCommit{
+			hash:    c.Hash.String()[:7],
+			subject: strings.TrimSpace(subject),
+			files:   files,
+		})
+		return nil
+	})
+	return ret, err
+}
+
+// changedFiles returns the paths that c changed since its parent, renamed
+// files by their new name.
+func changedFiles(c *object.Commit) ([]string, error) {
+	tree, err := c.Tree()
+	if err != nil {
+		return nil, err
+	}
+	var parentTree *object.Tree
+	if c.NumParents() == 1 {
+		parent, err := c.Parent(0)
+		if err != nil {
+			return nil, err
+		}
+		if parentTree, err = parent.Tree(); err != nil {
+			return nil, err
+		}
+	}
+
+	changes, err := object.DiffTreeWithOptions(context.Background(), parentTree, tree, object.DefaultDiffTreeOptions)
+	if err != nil {
+		return nil, err
+	}
+	var ret []string
+	for _, ch := range changes {
+		name := ch.To.Name
+		if name == "" {
+			name = ch.From.Name
+		}
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
+
+// archive returns what `git archive ref -- pathspecs...` contains: the files
+// of ref that match any of pathspecs and the directories they are in, in
+// tree order. Modes are the ones of `git archive` with its default umask,
+// 002. Pathspecs are literal paths (a file or a directory) or globs whose
+// wildcards match across slashes, like "toolchain/*".
+//
+// Unlike `git archive`, the export-ignore and export-subst attributes are
+// not supported; the release files do not use them.
+func (r *gitRepo) archive(ref string, pathspecs []string) ([]archiveEntry, error) {
+	matchers := make([]func(string) bool, 0, len(pathspecs))
+	for _, spec := range pathspecs {
+		m, err := pathspecMatcher(spec)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, m)
+	}
+	match := func(name string) bool {
+		for _, m := range matchers {
+			if m(name) {
+				return true
+			}
+		}
+		return false
+	}
+
+	commit, err := r.resolve(ref)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+	return r.archiveTree(tree, "", match)
+}
+
+func (r *gitRepo) archiveTree(tree *object.Tree, dir string, match func(string) bool) ([]archiveEntry, error) {
+	var ret []archiveEntry
+	for _, e := range tree.Entries {
+		name := dir + e.Name
+		switch e.Mode {
+		case filemode.Dir:
+			subtree, err := r.repo.TreeObject(e.Hash)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			entries, err := r.archiveTree(subtree, name+"/", match)
+			if err != nil {
+				return nil, err
+			}
+			// Like `git archive`, directories are only added if
+			// something in them is.
+			if len(entries) > 0 {
+				ret = append(ret, archiveEntry{name: name + "/", mode: 0775})
+				ret = append(ret, entries...)
+			}
+		case filemode.Submodule:
+			if match(name) {
+				ret = append(ret, archiveEntry{name: name + "/", mode: 0775})
+			}
+		case filemode.Regular, filemode.Deprecated, filemode.Executable:
+			if !match(name) {
+				continue
+			}
+			data, err := r.readBlob(e.Hash)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			mode := int64(0664)
+			if e.Mode == filemode.Executable {
+				mode = 0775
+			}
+			ret = append(ret, archiveEntry{name: name, mode: mode, data: data})
+		default:
+			if match(name) {
+				return nil, fmt.Errorf("%s: unsupported file mode %s in the release archive", name, e.Mode)
+			}
+		}
+	}
+	return ret, nil
+}
+
+func (r *gitRepo) readBlob(hash plumbing.Hash) ([]byte, error) {
+	blob, err := r.repo.BlobObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	rd, err := blob.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer rd.Close()
+	return io.ReadAll(rd)
+}
+
+// pathspecMatcher returns a matcher of the paths of a `git archive`
+// pathspec.
+func pathspecMatcher(spec string) (func(string) bool, error) {
+	if strings.HasPrefix(spec, ":") {
+		return nil, fmt.Errorf("pathspec %q: magic pathspecs are not supported", spec)
+	}
+	spec = strings.TrimSuffix(spec, "/")
+	if !strings.ContainsAny(spec, "*?[") {
+		return func(name string) bool {
+			return name == spec || strings.HasPrefix(name, spec+"/")
+		}, nil
+	}
+
+	var sb strings.Builder
+	sb.WriteString("^")
+	for i := 0; i < len(spec); i++ {
+		switch c := spec[i]; c {
+		case '*':
+			sb.WriteString(".*")
+		case '?':
+			sb.WriteString(".")
+		case '[':
+			end := strings.IndexByte(spec[i:], ']')
+			if end == -1 {
+				return nil, fmt.Errorf("pathspec %q: unterminated [", spec)
+			}
+			class := spec[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + class + "]")
+			i += end
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString("$")
+	re, err := regexp.Compile(sb.String())
+	if err != nil {
+		return nil, fmt.Errorf("pathspec %q: %w", spec, err)
+	}
+	return re.MatchString, nil
+}
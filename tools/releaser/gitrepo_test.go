@@ -0,0 +1,282 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"testing"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// initGitRepo creates an empty git repository on the main branch.
+func initGitRepo(t *testing.T) string {
+	t.Helper()
+	repoRoot := t.TempDir()
+	repo, err := gogit.PlainInitWithOptions(repoRoot, &gogit.PlainInitOptions{
+		InitOptions: gogit.InitOptions{DefaultBranch: plumbing.NewBranchReferenceName("main")},
+	})
+	require.NoError(t, err)
+	cfg, err := repo.Config()
+	require.NoError(t, err)
+	cfg.User.Name = "releaser"
+	cfg.User.Email = "releaser@example.com"
+	require.NoError(t, repo.SetConfig(cfg))
+	return repoRoot
+}
+
+// commitFiles writes files to the git repository at repoRoot and commits
+// them, and any other changes, with msg.
+func commitFiles(t *testing.T, repoRoot, msg string, files map[string]string) {
+	t.Helper()
+	for fpath, contents := range files {
+		fpath = path.Join(repoRoot, fpath)
+		require.NoError(t, os.MkdirAll(path.Dir(fpath), 0755))
+		require.NoError(t, os.WriteFile(fpath, []byte(contents), 0644))
+	}
+	repo, err := gogit.PlainOpen(repoRoot)
+	require.NoError(t, err)
+	w, err := repo.Worktree()
+	require.NoError(t, err)
+	require.NoError(t, w.AddWithOptions(&gogit.AddOptions{All: true}))
+	_, err = w.Commit(msg, &gogit.CommitOptions{AllowEmptyCommits: true})
+	require.NoError(t, err)
+}
+
+// tagRepo creates a lightweight tag of ref.
+func tagRepo(t *testing.T, repoRoot, tag, ref string) {
+	t.Helper()
+	repo, err := gogit.PlainOpen(repoRoot)
+	require.NoError(t, err)
+	hash, err := repo.ResolveRevision(plumbing.Revision(ref))
+	require.NoError(t, err)
+	_, err = repo.CreateTag(tag, *hash, nil)
+	require.NoError(t, err)
+}
+
+// checkoutRepo checks out the branch or commit of opts.
+func checkoutRepo(t *testing.T, repoRoot string, opts *gogit.CheckoutOptions) {
+	t.Helper()
+	repo, err := gogit.PlainOpen(repoRoot)
+	require.NoError(t, err)
+	w, err := repo.Worktree()
+	require.NoError(t, err)
+	require.NoError(t, w.Checkout(opts))
+}
+
+func TestPathspecMatcher(t *testing.T) {
+	tests := []struct {
+		spec string
+		name string
+		want bool
+	}{
+		{"LICENSE", "LICENSE", true},
+		{"LICENSE", "LICENSE.md", false},
+		{"toolchain", "toolchain/defs.bzl", true},
+		{"toolchain/", "toolchain/defs.bzl", true},
+		{"toolchain/*", "toolchain/defs.bzl", true},
+		{"toolchain/*", "toolchain/private/defs.bzl", true},
+		{"toolchain/*", "toolchainx/defs.bzl", false},
+		{"toolchain/*.bzl", "toolchain/private/defs.bzl", true},
+		{"toolchain/?efs.bzl", "toolchain/defs.bzl", true},
+		{"toolchain/[a-d]efs.bzl", "toolchain/defs.bzl", true},
+		{"toolchain/[!a-d]efs.bzl", "toolchain/defs.bzl", false},
+		{"tools/releaser/data/README", "tools/releaser/data/README", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec+" "+tt.name, func(t *testing.T) {
+			match, err := pathspecMatcher(tt.spec)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, match(tt.name))
+		})
+	}
+
+	_, err := pathspecMatcher(":(exclude)tools")
+	assert.ErrorContains(t, err, "magic pathspecs are not supported")
+	_, err = pathspecMatcher("toolchain/[a")
+	assert.ErrorContains(t, err, "unterminated [")
+}
+
+func TestGitRepo(t *testing.T) {
+	repoRoot := initRepo(t)
+	tagRepo(t, repoRoot, "v1.0.0", "HEAD")
+	commitFiles(t, repoRoot, "feat: add rules\n\nWith a body.", map[string]string{
+		"rules/BUILD":   "",
+		"rules/a.bzl":   "",
+		"rules/z/BUILD": "",
+	})
+	commitFiles(t, repoRoot, "empty", nil)
+
+	r, err := openRepo(repoRoot)
+	require.NoError(t, err)
+
+	branch, err := r.branch()
+	require.NoError(t, err)
+	assert.Equal(t, "main", branch)
+
+	tags, err := r.tags()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"v1.0.0"}, tags)
+	ok, err := r.hasTag("v1.0.0")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = r.hasTag("v1.0.1")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	data, err := r.readFile("v1.0.0", _glibcsPath)
+	require.NoError(t, err)
+	assert.Equal(t, `_GLIBCS = ["2.17", "2.28"]`, string(data))
+	_, err = r.readFile("v1.0.0", "rules/BUILD")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	commits, err := r.commits("v1.0.0", "HEAD")
+	require.NoError(t, err)
+	require.Len(t, commits, 2)
+	assert.Equal(t, "empty", commits[0].subject)
+	assert.Empty(t, commits[0].files)
+	assert.Equal(t, "feat: add rules", commits[1].subject)
+	assert.Equal(t, []string{"rules/BUILD", "rules/a.bzl", "rules/z/BUILD"}, commits[1].files)
+	assert.Len(t, commits[1].hash, 7)
+
+	all, err := r.commits("", "HEAD")
+	require.NoError(t, err)
+	assert.Len(t, all, 3)
+
+	modified, err := r.modified()
+	require.NoError(t, err)
+	assert.Empty(t, modified)
+	require.NoError(t, os.WriteFile(path.Join(repoRoot, "rules/a.bzl"), []byte("# changed\n"), 0644))
+	require.NoError(t, os.WriteFile(path.Join(repoRoot, "untracked"), nil, 0644))
+	modified, err = r.modified()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"rules/a.bzl"}, modified)
+
+	require.NoError(t, os.WriteFile(path.Join(repoRoot, "CHANGELOG.md"), nil, 0644))
+	require.NoError(t, r.commitAll("Releasing hermetic_cc_toolchain v1.1.0", []string{"CHANGELOG.md"}))
+	require.NoError(t, r.createTag("v1.1.0"))
+	modified, err = r.modified()
+	require.NoError(t, err)
+	assert.Empty(t, modified)
+	data, err = r.readFile("v1.1.0", "rules/a.bzl")
+	require.NoError(t, err)
+	assert.Equal(t, "# changed\n", string(data))
+	_, err = r.readFile("v1.1.0", "untracked")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+// TestGitRepoWorktree checks a linked worktree of `git worktree add`, if git
+// is installed.
+func TestGitRepoWorktree(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+
+	repoRoot := initRepo(t)
+	tagRepo(t, repoRoot, "v1.0.0", "HEAD")
+	commitFiles(t, repoRoot, "feat: add rules", map[string]string{"rules/BUILD": ""})
+	worktree := path.Join(t.TempDir(), "worktree")
+	cmd := exec.Command("git", "worktree", "add", "-b", "release-1.0", worktree, "v1.0.0")
+	cmd.Dir = repoRoot
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+
+	r, err := openRepo(worktree)
+	require.NoError(t, err)
+	head, err := r.commitHash("HEAD")
+	require.NoError(t, err)
+	tagged, err := r.commitHash("v1.0.0")
+	require.NoError(t, err)
+	assert.Equal(t, tagged, head)
+	branch, err := r.branch()
+	require.NoError(t, err)
+	assert.Equal(t, "release-1.0", branch)
+	_, err = r.readFile("main", "rules/BUILD")
+	require.NoError(t, err)
+
+	modified, err := r.modified()
+	require.NoError(t, err)
+	assert.Empty(t, modified)
+	require.NoError(t, os.WriteFile(path.Join(worktree, _glibcsPath), []byte("# changed\n"), 0644))
+	modified, err = r.modified()
+	require.NoError(t, err)
+	assert.Equal(t, []string{_glibcsPath}, modified)
+
+	// The release commit and tag are in the repository of the main
+	// worktree.
+	require.NoError(t, r.commitAll("Releasing hermetic_cc_toolchain v1.0.1", nil))
+	require.NoError(t, r.createTag("v1.0.1"))
+	main, err := openRepo(repoRoot)
+	require.NoError(t, err)
+	data, err := main.readFile("v1.0.1", _glibcsPath)
+	require.NoError(t, err)
+	assert.Equal(t, "# changed\n", string(data))
+	modified, err = main.modified()
+	require.NoError(t, err)
+	assert.Empty(t, modified)
+}
+
+// TestArchiveLikeGitArchive checks that gitRepo.archive has the entries
+// of `git archive`, if git is installed.
+func TestArchiveLikeGitArchive(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+
+	repoRoot := initReleaseRepo(t)
+	commitFiles(t, repoRoot, "add more files", map[string]string{
+		"toolchain/zig-wrapper.zig":      "// zig\n",
+		"toolchain/private/a/b/c.bzl":    "# c\n",
+		"toolchain-other/BUILD":          "",
+		"tools/releaser/data/other.json": "{}",
+	})
+	require.NoError(t, os.Chmod(path.Join(repoRoot, "toolchain", "zig-wrapper.zig"), 0755))
+	commitFiles(t, repoRoot, "make it executable", nil)
+
+	archive, err := readArchiveConfig(repoRoot, "HEAD")
+	require.NoError(t, err)
+	r, err := openRepo(repoRoot)
+	require.NoError(t, err)
+	got, err := r.archive("HEAD", archive.Include)
+	require.NoError(t, err)
+
+	cmd := exec.Command("git", append([]string{"archive", "--format=tar", "HEAD", "--"}, archive.Include...)...)
+	cmd.Dir = repoRoot
+	out, err := cmd.Output()
+	require.NoError(t, err)
+	var want []archiveEntry
+	tr := tar.NewReader(bytes.NewReader(out))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		if hdr.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		if len(data) == 0 {
+			data = nil
+		}
+		want = append(want, archiveEntry{name: hdr.Name, mode: hdr.Mode & 0777, data: data})
+	}
+
+	for i := range got {
+		if len(got[i].data) == 0 {
+			got[i].data = nil
+		}
+	}
+	assert.Equal(t, want, got)
+}
@@ -6,52 +6,42 @@
 package main
 
 import (
-	"archive/tar"
-	"compress/gzip"
-	"crypto/sha256"
+	"bytes"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
-	"os/exec"
 	"path"
 	"regexp"
 	"strings"
-	"time"
 
 	bzl "github.com/bazelbuild/buildtools/build"
 )
 
+const (
+	// _moduleStartMarker and _moduleEndMarker delimit the region of the
+	// bzlmod example files that updateModuleBoilerplate rewrites.
+	_moduleStartMarker = "# BEGIN hermetic_cc_toolchain, updated by //tools/releaser\n"
+	_moduleEndMarker   = "# END hermetic_cc_toolchain\n"
+)
+
 var (
 	// regexp for valid tags
 	_tagRegexp = regexp.MustCompile(`^v([0-9]+)\.([0-9]+)(\.([0-9]+))(-rc([0-9]+))?$`)
 
 	_errTag = errors.New("tag accepts the following formats: v1.0.0 v1.0.1-rc1")
 
-	// releaser is able to calculate the hash of any existing release. However,
-	// if the releaser was changed since cutting the hash (e.g. files got added
-	// or removed, the tar format changed, etc), then the previously-released
-	// tarball will not match the hash. Since we cannot change the hash since
-	// it was released, we can hardcode it here.
-	//
-	// Normally you don't need to set this value, unless the CI job updates the
-	// hashes of already-released versions. Then just hardcode it here.
-	_tagHashes = map[string]string{
-		"v2.0.0-rc2": "40dff82816735e631e8bd51ede3af1c4ed1ad4646928ffb6a0e53e228e55738c",
-		"v2.0.0":     "57f03a6c29793e8add7bd64186fc8066d23b5ffd06fe9cc6b0b8c499914d3a65",
-		"v2.1.0":     "892b0dd7aa88c3504a8821e65c44fd22f32c16afab12d89e9942fff492720b37",
-		"v2.1.1":     "86ace5cd211d0ae49a729a11afb344843698b64464f2095a776c57ebbdf06698",
-		"v2.1.3":     "a5caccbf6d86d4f60afd45b541a05ca4cc3f5f523aec7d3f7711e584600fb075",
-		"v2.2.1":     "3b8107de0d017fe32e6434086a9568f97c60a111b49dc34fc7001e139c30fdea",
-		"v3.0.0":     "fe00bd126e57a4c3fec4efa620bf074e3d1f1fbd70b75113ca56a010d7a70d93",
-	}
-
 	_boilerplateFiles = []string{
 		"README.md",
 		path.Join("examples", "rules_cc", "WORKSPACE"),
 	}
+
+	_moduleBoilerplateFiles = []string{
+		"README.md",
+		path.Join("examples", "bzlmod", "MODULE.bazel"),
+	}
 )
 
 func main() {
@@ -65,164 +55,582 @@ func log(msg string, format ...any) {
 	fmt.Fprintf(flag.CommandLine.Output(), msg+"\n", format...)
 }
 
-func run() (_err error) {
+// releaseConfig are the flags of a release.
+type releaseConfig struct {
+	repoRoot        string
+	tag             string
+	skipBranchCheck bool
+	verifyPath      string
+	bcrPath         string
+	dryRun          bool
+	outputFormat    string
+	deepMirrorCheck bool
+	signKey         string
+	verifySigDir    string
+	allowedSigners  string
+	signerIdentity  string
+	promoteRC       string
+	list            bool
+	formats         []string
+}
+
+// releaseDeps are what a release uses besides the files of the repository:
+// its git history, the network and stdout. Tests replace them to run the
+// releaser against fixture repositories and a fake zig mirror.
+type releaseDeps struct {
+	openRepo func(repoRoot string) (*gitRepo, error)
+	client   *http.Client
+	stdout   io.Writer
+}
+
+func run() error {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "check":
+			return runCheck(os.Args[2:])
+		case "backfill":
+			return runBackfill(os.Args[2:])
+		}
+	}
+
+	cfg, err := parseFlags(os.Args[1:])
+	if err != nil {
+		return err
+	}
+	return release(cfg, releaseDeps{
+		openRepo: openRepo,
+		client:   http.DefaultClient,
+		stdout:   os.Stdout,
+	})
+}
+
+// parseFlags returns the releaseConfig of the command line. The tag and
+// the other values are validated by release.
+func parseFlags(args []string) (releaseConfig, error) {
 	var (
-		repoRoot        string
-		tag             string
-		skipBranchCheck bool
+		cfg         releaseConfig
+		formatsFlag string
 	)
 
-	flag.StringVar(&repoRoot, "repoRoot", os.Getenv("BUILD_WORKSPACE_DIRECTORY"), "root directory of hermetic_cc_toolchain repo")
-	flag.StringVar(&tag, "tag", "", "tag for this release")
-	flag.BoolVar(&skipBranchCheck, "skipBranchCheck", false, "skip branch check (for testing the release tool)")
-
-	flag.Usage = func() {
-		fmt.Fprint(flag.CommandLine.Output(), `usage: bazel run //tools/releaser -- -repoRoot <repoRoot> -tag <tag>
+	fs := flag.NewFlagSet("releaser", flag.ExitOnError)
+	fs.StringVar(&cfg.repoRoot, "repoRoot", os.Getenv("BUILD_WORKSPACE_DIRECTORY"), "root directory of hermetic_cc_toolchain repo")
+	fs.StringVar(&cfg.tag, "tag", "", "tag for this release")
+	fs.BoolVar(&cfg.skipBranchCheck, "skipBranchCheck", false, "skip the checks of "+_branchesConfigPath+" (for testing the release tool)")
+	fs.StringVar(&cfg.verifyPath, "verify", "", "rebuild the tarball for -tag and compare it with this published tarball")
+	fs.StringVar(&cfg.bcrPath, "bcr", "", "write the Bazel Central Registry entry of the release to this registry checkout")
+	fs.BoolVar(&cfg.dryRun, "dry-run", false, "show what the release would change, without writing files, committing or tagging")
+	fs.BoolVar(&cfg.deepMirrorCheck, "deep", false, "download the Zig SDK for every host platform and verify its sha256")
+	fs.StringVar(&cfg.signKey, "sign-key", "", "sign the tarball and its provenance with this ssh private key (ssh-keygen -Y sign)")
+	fs.StringVar(&cfg.verifySigDir, "verify-signature", "", "verify the signed tarball and provenance of -tag in this directory, offline")
+	fs.StringVar(&cfg.allowedSigners, "allowed-signers", "", "ssh allowed_signers file for -verify-signature")
+	fs.StringVar(&cfg.signerIdentity, "identity", "", "expected signer of -verify-signature; by default any of -allowed-signers")
+	fs.StringVar(&cfg.promoteRC, "promote", "", "promote this release candidate of -tag, e.g. v3.1.0-rc2, refusing if the release would differ from it")
+	fs.BoolVar(&cfg.list, "list", false, "print the contents of the release tarball of HEAD for -tag, without releasing")
+	fs.StringVar(&formatsFlag, "formats", _tgzFormat, "comma-separated release archive formats: tar.gz (always built), tar.zst, zip")
+	fs.StringVar(&cfg.outputFormat, "output", "text", "release summary format: text (the log) or json (printed to stdout)")
+
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), `usage: bazel run //tools/releaser -- -repoRoot <repoRoot> -tag <tag>
+       bazel run //tools/releaser -- check [-tag <tag>]
+       bazel run //tools/releaser -- backfill
 
 This utility is intended to handle many of the steps to release a new version.
+"check" only checks that the boilerplate is up to date with the latest release,
+and that the toolchain constants are consistent. "backfill" records every
+release tag in releases.json.
 
 `)
-		flag.PrintDefaults()
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return cfg, err
+	}
+	if fs.NArg() > 0 {
+		return cfg, fmt.Errorf("unexpected arguments %q", fs.Args())
 	}
 
-	flag.Parse()
+	formats, err := parseFormats(formatsFlag)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.formats = formats
+	return cfg, nil
+}
 
-	if tag == "" {
+// release cuts, checks or verifies the release of cfg.tag, depending on
+// cfg.
+func release(cfg releaseConfig, deps releaseDeps) error {
+	if cfg.tag == "" {
 		return fmt.Errorf("tag is required")
 	}
 
-	if !_tagRegexp.MatchString(tag) {
+	if !_tagRegexp.MatchString(cfg.tag) {
 		return _errTag
 	}
 
-	type checkType struct {
-		args    []string
-		wantOut string
+	if cfg.outputFormat != "text" && cfg.outputFormat != "json" {
+		return fmt.Errorf("-output accepts text or json, got %q", cfg.outputFormat)
 	}
 
-	checks := []checkType{{[]string{"diff", "--stat", "--exit-code"}, ""}}
-	if !skipBranchCheck {
-		checks = append(
-			checks,
-			checkType{[]string{"branch", "--show-current"}, "main\n"},
-		)
+	// As in parseFlags, tar.gz is the default.
+	if len(cfg.formats) == 0 {
+		cfg.formats = []string{_tgzFormat}
 	}
 
-	log("checking if git tree is ready for the release")
-	for _, c := range checks {
-		out, err := git(repoRoot, c.args...)
-		if err != nil {
+	if cfg.promoteRC != "" {
+		if err := checkPromotable(cfg.promoteRC, cfg.tag); err != nil {
 			return err
 		}
+	}
 
-		if string(out) == c.wantOut {
-			continue
+	if cfg.list {
+		files := newPendingFiles(cfg.repoRoot)
+		if err := updateModuleVersion(files, cfg.tag); err != nil {
+			return err
 		}
+		var tgz bytes.Buffer
+		if _, err := makeTgz(&tgz, cfg.repoRoot, "HEAD", files.contents); err != nil {
+			return fmt.Errorf("make release tarball: %w", err)
+		}
+		return listArchive(deps.stdout, &tgz)
+	}
 
+	if cfg.verifyPath != "" {
+		return verifyRelease(cfg.repoRoot, cfg.tag, cfg.verifyPath)
+	}
+
+	if cfg.verifySigDir != "" {
+		if cfg.allowedSigners == "" {
+			return fmt.Errorf("-verify-signature requires -allowed-signers")
+		}
+		return verifyReleaseSignature(cfg.verifySigDir, cfg.tag, cfg.allowedSigners, cfg.signerIdentity)
+	}
+
+	log("checking if git tree is ready for the release")
+	repo, err := deps.openRepo(cfg.repoRoot)
+	if err != nil {
+		return err
+	}
+	modified, err := repo.modified()
+	if err != nil {
+		return err
+	}
+	if len(modified) > 0 {
 		return fmt.Errorf(
-			"unexpected output for %q. Expected %q, got:\n---\n%s\n---\n",
-			"git "+strings.Join(c.args, " "),
-			c.wantOut,
-			out,
+			"the working tree has uncommitted changes:\n---\n%s\n---\n",
+			strings.Join(modified, "\n"),
 		)
 	}
+	if !cfg.skipBranchCheck {
+		branches, err := readBranchesConfig(cfg.repoRoot)
+		if err != nil {
+			return err
+		}
+		branch, err := repo.branch()
+		if err != nil {
+			return err
+		}
+		tags, err := repo.tags()
+		if err != nil {
+			return err
+		}
+		if err := checkBranch(branches, branch, cfg.tag, tags); err != nil {
+			return err
+		}
+	}
 
-	if err := checkZigMirrored(repoRoot); err != nil {
+	if err := checkToolchainConfig(cfg.repoRoot); err != nil {
+		return err
+	}
+
+	mirror, err := checkZigMirrored(deps.client, cfg.repoRoot, cfg.deepMirrorCheck)
+	if err != nil {
 		return fmt.Errorf("zig is not mirrored: %w", err)
 	}
 
 	// if the tag already exists, do not cut a new one.
-	tagAlreadyExists := false
-	// cut a new tag if the tag does not already exist.
-	if out, err := git(repoRoot, "tag", "-l", tag); err != nil {
+	tagAlreadyExists, err := repo.hasTag(cfg.tag)
+	if err != nil {
 		return err
-	} else {
-		tagAlreadyExists = strings.TrimSpace(out) == tag
 	}
 
-	if hash, ok := _tagHashes[tag]; ok {
-		log("Asked for a pre-existing release which has a hardcoded hash. " +
+	manifest, err := readReleaseManifest(cfg.repoRoot)
+	if err != nil {
+		return err
+	}
+
+	files := newPendingFiles(cfg.repoRoot)
+	sep := strings.Repeat("-", 72)
+	out := releaseOutput{
+		Tag:         cfg.tag,
+		DryRun:      cfg.dryRun,
+		MirrorCheck: mirror,
+	}
+
+	if release, ok := manifest.lookup(cfg.tag); ok && release.Hash == hashPinned {
+		log("Asked for a pre-existing release which has a pinned hash. " +
 			"Running in 'check-only' mode.")
-		boilerplate := genBoilerplate(tag, hash)
-		if err := updateBoilerplate(repoRoot, boilerplate); err != nil {
+		boilerplate := genBoilerplate(release)
+		if err := updateBoilerplate(files, boilerplate); err != nil {
 			return fmt.Errorf("update boilerplate: %w", err)
 		}
-		log("updated %s", strings.Join(_boilerplateFiles, " and "))
-		sep := strings.Repeat("-", 72)
+		moduleBoilerplate := genModuleBoilerplate(cfg.tag)
+		if err := updateModuleBoilerplate(files, cfg.tag); err != nil {
+			return fmt.Errorf("update bzlmod boilerplate: %w", err)
+		}
+		if err := out.setFiles(files); err != nil {
+			return err
+		}
+		if cfg.dryRun {
+			if err := logDiff(files); err != nil {
+				return err
+			}
+		} else {
+			if err := files.flush(); err != nil {
+				return err
+			}
+			log("updated %s", strings.Join(_boilerplateFiles, " and "))
+			log("updated %s", strings.Join(_moduleBoilerplateFiles, " and "))
+		}
 		log("Release boilerplate:\n%[1]s\n%[2]s%[1]s\n", sep, boilerplate)
-		return nil
+		log("bzlmod boilerplate:\n%[1]s\n%[2]s%[1]s\n", sep, moduleBoilerplate)
+		if cfg.bcrPath != "" {
+			if cfg.dryRun {
+				log("would write the BCR entry to %s", cfg.bcrPath)
+			} else if err := releaseBCR(cfg.repoRoot, cfg.bcrPath, cfg.tag, release.SHA256); err != nil {
+				return err
+			}
+			out.BCR = cfg.bcrPath
+		}
+		if err := out.setHash(release.SHA256); err != nil {
+			return err
+		}
+		out.ZigVersion = release.ZigVersion
+		out.Boilerplate.Workspace = boilerplate
+		out.Boilerplate.Module = moduleBoilerplate
+		return writeOutput(deps.stdout, cfg.outputFormat, out)
 	}
 
-	if err := updateModuleVersion(repoRoot, tag); err != nil {
+	if manifest.Version != _releasesVersion {
+		return fmt.Errorf(
+			"%s does not record the zig version and commit of every release; "+
+				"run `bazel run //tools/releaser -- backfill` first",
+			_releasesPath,
+		)
+	}
+
+	if err := updateModuleVersion(files, cfg.tag); err != nil {
 		return err
 	}
 
 	releaseRef := "HEAD"
 	if tagAlreadyExists {
-		releaseRef = tag
+		releaseRef = cfg.tag
 	}
 
-	hash1, err := makeTgz(io.Discard, repoRoot, releaseRef)
+	var tgz1 bytes.Buffer
+	hash1, err := makeTgz(&tgz1, cfg.repoRoot, releaseRef, files.contents)
 	if err != nil {
 		return fmt.Errorf("calculate hash1 of release tarball: %w", err)
 	}
 
-	boilerplate := genBoilerplate(tag, hash1)
-	if err := updateBoilerplate(repoRoot, boilerplate); err != nil {
+	// Before anything is committed: hash2 is checked to be the same
+	// tarball.
+	if err := auditTgz(bytes.NewReader(tgz1.Bytes())); err != nil {
+		return fmt.Errorf("audit release tarball: %w", err)
+	}
+	log("all labels in the release tarball resolve")
+	if err := checkModule(repo, cfg.repoRoot, bytes.NewReader(tgz1.Bytes()), cfg.tag, releaseRef); err != nil {
+		return err
+	}
+	log("MODULE.bazel declares the dependencies of the release tarball")
+
+	if cfg.promoteRC != "" {
+		promotion, err := checkPromotion(cfg.repoRoot, cfg.promoteRC, cfg.tag, hash1, releaseRef, files.contents)
+		if err != nil {
+			return err
+		}
+		log("%s is %s with only the MODULE.bazel version changed", cfg.tag, cfg.promoteRC)
+		out.PromotedFrom = &promotion
+	}
+
+	// The other cfg.formats are built from the same entries, so they are
+	// only audited through the tarball.
+	hashes1 := map[string]string{_tgzFormat: hash1}
+	var archives []manifestArchive
+	for _, format := range cfg.formats {
+		if format != _tgzFormat {
+			shasum, err := makeArchive(io.Discard, cfg.repoRoot, releaseRef, files.contents, format)
+			if err != nil {
+				return fmt.Errorf("calculate hash1 of %s release archive: %w", format, err)
+			}
+			hashes1[format] = shasum
+		}
+		a, err := newManifestArchive(cfg.tag, format, hashes1[format])
+		if err != nil {
+			return err
+		}
+		archives = append(archives, a)
+	}
+
+	// A promoted release has the changes of its release candidate.
+	changesOf := cfg.tag
+	if cfg.promoteRC != "" {
+		changesOf = cfg.promoteRC
+	}
+	prevTag, err := previousTag(cfg.repoRoot, changesOf, releaseRef)
+	if err != nil {
+		return err
+	}
+	changelog, err := collectChanges(cfg.repoRoot, cfg.tag, prevTag, releaseRef)
+	if err != nil {
+		return fmt.Errorf("collect changes since %q: %w", prevTag, err)
+	}
+
+	// The release is recorded in releases.json of the release commit. The
+	// hash of the release commit is only known once it is committed, so it
+	// is in the release output, and the next release records it.
+	var commit string
+	if tagAlreadyExists {
+		commit, err = repo.commitHash(cfg.tag)
+		if err != nil {
+			return err
+		}
+	} else if err := manifest.recordCommits(repo); err != nil {
+		return fmt.Errorf("record release commits in %s: %w", _releasesPath, err)
+	}
+	if err := manifest.record(releaseEntry{
+		Tag:        cfg.tag,
+		SHA256:     hash1,
+		ZigVersion: changelog.zigVersion,
+		Hash:       hashReproducible,
+		Archives:   archives,
+	}); err != nil {
+		return fmt.Errorf("record release in %s: %w", _releasesPath, err)
+	}
+
+	// The boilerplate lists every format the release is recorded with,
+	// which for an existing tag may be more than cfg.formats.
+	recorded, _ := manifest.lookup(cfg.tag)
+	boilerplate := genBoilerplate(recorded)
+	if err := updateBoilerplate(files, boilerplate); err != nil {
 		return fmt.Errorf("update boilerplate: %w", err)
 	}
 
+	moduleBoilerplate := genModuleBoilerplate(cfg.tag)
+	if err := updateModuleBoilerplate(files, cfg.tag); err != nil {
+		return fmt.Errorf("update bzlmod boilerplate: %w", err)
+	}
+
+	if err := updateChangelog(files, changelog); err != nil {
+		return err
+	}
+	if err := writeReleaseManifest(files, manifest); err != nil {
+		return err
+	}
+
+	if err := out.setFiles(files); err != nil {
+		return err
+	}
+	if cfg.dryRun {
+		if err := logDiff(files); err != nil {
+			return err
+		}
+	} else if err := files.flush(); err != nil {
+		return err
+	}
+
 	// If tag does not exist, create a new commit with the updated hashes
 	// and cut the new tag.
 	//
 	// If the tag exists, skip committing the tag; we will just verify
 	// that the hashes in the README and examples/ are up to date.
-	if !tagAlreadyExists {
-		commitMsg := fmt.Sprintf("Releasing hermetic_cc_toolchain %s", tag)
-		if _, err := git(repoRoot, "commit", "-am", commitMsg); err != nil {
+	commitMsg := _releaseCommitPrefix + cfg.tag
+	switch {
+	case tagAlreadyExists:
+	case cfg.dryRun:
+		log("would commit with message %q", commitMsg)
+		log("would create tag %s", cfg.tag)
+	default:
+		// CHANGELOG.md may be new.
+		if err := repo.commitAll(commitMsg, files.paths); err != nil {
+			return err
+		}
+		if err := repo.createTag(cfg.tag); err != nil {
 			return err
 		}
-		if _, err := git(repoRoot, "tag", tag); err != nil {
+		if commit, err = repo.commitHash(cfg.tag); err != nil {
 			return err
 		}
 	}
 
 	// Cut the final release and compare hash1 and hash2 just in case.
-	fpath := path.Join(repoRoot, fmt.Sprintf("hermetic_cc_toolchain-%s.tar.gz", tag))
-	tgz, err := os.Create(fpath)
-	if err != nil {
-		return err
+	// Without the release commit (-dry-run), build it from the pending
+	// files, which is what the release commit would contain.
+	fpath := archivePath(cfg.repoRoot, cfg.tag, _tgzFormat)
+	var hash2 string
+	for _, format := range cfg.formats {
+		apath := archivePath(cfg.repoRoot, cfg.tag, format)
+		var shasum string
+		if cfg.dryRun {
+			shasum, err = makeArchive(io.Discard, cfg.repoRoot, releaseRef, files.contents, format)
+			if err != nil {
+				return fmt.Errorf("make %s release archive: %w", format, err)
+			}
+		} else {
+			f, err := os.Create(apath)
+			if err != nil {
+				return err
+			}
+
+			shasum, err = makeArchive(f, cfg.repoRoot, cfg.tag, nil, format)
+			if err != nil {
+				return fmt.Errorf("make %s release archive: %w", format, err)
+			}
+
+			if err := f.Close(); err != nil {
+				return err
+			}
+		}
+
+		if hashes1[format] != shasum {
+			// This may happen if the release archive depends on the
+			// boilerplate that gets updated with the new tag. Don't do
+			// this. We want the release commit to point to the correct
+			// hashes for that release.
+			return fmt.Errorf(
+				"hashes of the %s archive before and after release differ: %s %s",
+				format,
+				hashes1[format],
+				shasum,
+			)
+		}
+
+		archive, err := newReleaseArchive(format, apath, shasum)
+		if err != nil {
+			return err
+		}
+		if cfg.dryRun {
+			log("would write %s, sha256: %s, integrity: %s", apath, archive.SHA256, archive.Integrity)
+		} else {
+			log("wrote %s, sha256: %s, integrity: %s", apath, archive.SHA256, archive.Integrity)
+		}
+		out.Archives = append(out.Archives, archive)
+		if format == _tgzFormat {
+			hash2 = shasum
+		}
 	}
 
-	hash2, err := makeTgz(tgz, repoRoot, tag)
-	if err != nil {
-		return fmt.Errorf("make release tarball: %w", err)
+	notesPath := strings.TrimSuffix(fpath, ".tar.gz") + ".notes.md"
+	notes := changelog.releaseNotes(boilerplate, moduleBoilerplate)
+	if cfg.dryRun {
+		log("would write the release notes to %[1]s:\n%[2]s\n%[3]s%[2]s\n", notesPath, sep, notes)
+	} else {
+		if err := os.WriteFile(notesPath, []byte(notes), 0644); err != nil {
+			return fmt.Errorf("write %q: %w", notesPath, err)
+		}
+		log("wrote %s", notesPath)
 	}
+	out.ReleaseNotes = notesPath
 
-	if err := tgz.Close(); err != nil {
+	provPath := provenancePath(fpath)
+	archive, err := readArchiveConfig(cfg.repoRoot, releaseRef)
+	if err != nil {
 		return err
 	}
-
-	if hash1 != hash2 {
-		// This may happen if the release tarball depends on the boilerplate
-		// that gets updated with the new tag. Don't do this. We want the
-		// release commit to point to the correct hashes for that release.
-		return fmt.Errorf(
-			"hashes before and after release differ: %s %s",
-			hash1,
-			hash2,
-		)
+	prov := newProvenance(cfg.tag, commit, changelog.zigVersion, archive.Include, out.Archives)
+	var toSign []string
+	for _, a := range out.Archives {
+		toSign = append(toSign, a.Path)
 	}
+	toSign = append(toSign, provPath)
+	if cfg.dryRun {
+		log("would write the provenance to %s", provPath)
+		if cfg.signKey != "" {
+			log("would sign %s with %s", strings.Join(toSign, ", "), cfg.signKey)
+		}
+	} else {
+		if err := writeProvenance(provPath, prov); err != nil {
+			return err
+		}
+		log("wrote %s", provPath)
+		if cfg.signKey != "" {
+			for _, f := range toSign {
+				sigPath, err := signFile(cfg.signKey, f)
+				if err != nil {
+					return err
+				}
+				log("wrote %s", sigPath)
+				out.Signatures = append(out.Signatures, sigPath)
+			}
+		}
+	}
+	out.Provenance = provPath
 
-	log("wrote %s, sha256: %s", fpath, hash2)
+	if cfg.bcrPath != "" {
+		if cfg.dryRun {
+			log("would write the BCR entry to %s", cfg.bcrPath)
+		} else if err := releaseBCR(cfg.repoRoot, cfg.bcrPath, cfg.tag, hash2); err != nil {
+			return err
+		}
+		out.BCR = cfg.bcrPath
+	}
 
-	sep := strings.Repeat("-", 72)
 	log("Release boilerplate:\n%[1]s\n%[2]s%[1]s\n", sep, boilerplate)
+	log("bzlmod boilerplate:\n%[1]s\n%[2]s%[1]s\n", sep, moduleBoilerplate)
 
+	out.Tarball = fpath
+	if err := out.setHash(hash2); err != nil {
+		return err
+	}
+	out.ZigVersion = changelog.zigVersion
+	out.Commit = commit
+	out.Boilerplate.Workspace = boilerplate
+	out.Boilerplate.Module = moduleBoilerplate
+	return writeOutput(deps.stdout, cfg.outputFormat, out)
+}
+
+// logDiff logs the changes that the releaser would make to the working tree.
+func logDiff(files *pendingFiles) error {
+	diff, err := files.diff()
+	if err != nil {
+		return err
+	}
+	if diff == "" {
+		log("would not change any files")
+		return nil
+	}
+	log("would make the following changes:\n%s", diff)
 	return nil
 }
 
-func genBoilerplate(version, shasum string) string {
+// releaseBCR writes the Bazel Central Registry entry of an existing tag.
+func releaseBCR(repoRoot, registry, tag, shasum string) error {
+	module, err := moduleAt(repoRoot, tag, tag)
+	if err != nil {
+		return err
+	}
+	if err := writeBCR(repoRoot, registry, tag, shasum, module); err != nil {
+		return fmt.Errorf("write BCR entry: %w", err)
+	}
+	log("wrote %s", path.Join(registry, "modules", _bcrModuleName, strings.TrimPrefix(tag, "v")))
+	return nil
+}
+
+// genBoilerplate returns the WORKSPACE snippet of release. The archives in
+// formats other than tar.gz get a line each after http_archive.
+func genBoilerplate(release releaseEntry) string {
+	var alsoReleased string
+	if others := release.otherArchives(); len(others) > 0 {
+		var sb strings.Builder
+		sb.WriteString("\n# The release is also available in these formats, at the same urls with\n# the extension replaced:\n")
+		for _, a := range others {
+			fmt.Fprintf(&sb, "#   .%s: sha256 = \"%s\", integrity = \"%s\"\n", a.Format, a.SHA256, a.Integrity)
+		}
+		alsoReleased = sb.String()
+	}
+
 	return fmt.Sprintf(`load("@bazel_tools//tools/build_defs/repo:http.bzl", "http_archive")
 
 HERMETIC_CC_TOOLCHAIN_VERSION = "%[1]s"
@@ -235,26 +643,64 @@ http_archive(
         "https://github.com/uber/hermetic_cc_toolchain/releases/download/{0}/hermetic_cc_toolchain-{0}.tar.gz".format(HERMETIC_CC_TOOLCHAIN_VERSION),
     ],
 )
-
+%[3]s
 load("@hermetic_cc_toolchain//toolchain:defs.bzl", zig_toolchains = "toolchains")
 
 # Plain zig_toolchains() will pick reasonable defaults. See
 # toolchain/defs.bzl:toolchains on how to change the Zig SDK version and
 # download URL.
 zig_toolchains()
-`, version, shasum)
+`, release.Tag, release.SHA256, alsoReleased)
+}
+
+// genModuleBoilerplate returns the MODULE.bazel snippet for the given tag.
+func genModuleBoilerplate(tag string) string {
+	return genModuleDeps(tag) + `
+register_toolchains(
+    "@zig_sdk//toolchain/...",
+    "@zig_sdk//libc_aware/toolchain/...",
+)
+`
+}
+
+// genModuleRegion returns the marked region of the bzlmod example files for
+// the given tag. It leaves out register_toolchains: which toolchains to
+// register is up to each file.
+func genModuleRegion(tag string) string {
+	return _moduleStartMarker + genModuleDeps(tag) + _moduleEndMarker
+}
+
+// genModuleDeps returns the bazel_dep on the given tag and the repositories
+// of its toolchains extension.
+func genModuleDeps(tag string) string {
+	return fmt.Sprintf(`bazel_dep(name = "hermetic_cc_toolchain", version = "%s")
+
+toolchains = use_extension("@hermetic_cc_toolchain//toolchain:ext.bzl", "toolchains")
+use_repo(toolchains, "zig_sdk")
+`, strings.TrimPrefix(tag, "v"))
 }
 
 // updateBoilerplate updates all example files with the given version.
-func updateBoilerplate(repoRoot string, boilerplate string) error {
+func updateBoilerplate(files *pendingFiles, boilerplate string) error {
 	const (
 		startMarker = `load("@bazel_tools//tools/build_defs/repo:http.bzl", "http_archive")` + "\n"
 		endMarker   = "zig_toolchains()\n"
 	)
 
-	for _, gotpath := range _boilerplateFiles {
-		f := path.Join(repoRoot, gotpath)
-		data, err := os.ReadFile(f)
+	return replaceBoilerplate(files, _boilerplateFiles, startMarker, endMarker, boilerplate)
+}
+
+// updateModuleBoilerplate updates the marked region of all bzlmod example
+// files to the given tag.
+func updateModuleBoilerplate(files *pendingFiles, tag string) error {
+	return replaceBoilerplate(files, _moduleBoilerplateFiles, _moduleStartMarker, _moduleEndMarker, genModuleRegion(tag))
+}
+
+// replaceBoilerplate replaces everything from startMarker to the first
+// endMarker after it with boilerplate in each of the files.
+func replaceBoilerplate(files *pendingFiles, paths []string, startMarker, endMarker, boilerplate string) error {
+	for _, gotpath := range paths {
+		data, err := files.read(gotpath)
 		if err != nil {
 			return err
 		}
@@ -267,290 +713,77 @@ func updateBoilerplate(repoRoot string, boilerplate string) error {
 			return fmt.Errorf("%q does not contain start marker %q...", gotpath, startMarker[0:16])
 		}
 
-		endMarkerIdx := strings.Index(dataStr, endMarker)
+		endMarkerIdx := strings.Index(dataStr[startMarkerIdx:], endMarker)
 		if endMarkerIdx == -1 {
-			return fmt.Errorf("%q does not contain end marker %q...", gotpath, endMarker[0:16])
+			return fmt.Errorf("%q does not contain end marker %q", gotpath, endMarker)
 		}
+		endMarkerIdx += startMarkerIdx
 
 		preamble := dataStr[0:startMarkerIdx]
 		epilogue := dataStr[endMarkerIdx+len(endMarker):]
 		newBoilerplate := preamble + boilerplate + epilogue
 
-		if err := os.WriteFile(f, []byte(newBoilerplate), 0644); err != nil {
-			return fmt.Errorf("write %q: %w", f, err)
-		}
+		files.write(gotpath, []byte(newBoilerplate))
 	}
 
 	return nil
 }
 
-func updateModuleVersion(repoRoot string, tag string) error {
-	modulePath := path.Join(repoRoot, "MODULE.bazel")
-	data, err := os.ReadFile(modulePath)
+func updateModuleVersion(files *pendingFiles, tag string) error {
+	data, err := files.read("MODULE.bazel")
 	if err != nil {
 		return err
 	}
-	modFile, err := bzl.ParseModule(modulePath, data)
+	data, err = setModuleVersion(path.Join(files.repoRoot, "MODULE.bazel"), data, tag)
 	if err != nil {
 		return err
 	}
-	moduleName := "hermetic_cc_toolchain"
-	moduleRule := modFile.RuleNamed(moduleName)
-	if moduleRule == nil {
-		return fmt.Errorf("%q does not declare module %q", modulePath, moduleName)
-	}
-	moduleRule.SetAttr("version", &bzl.StringExpr{Value: strings.TrimPrefix(tag, "v")})
-	return os.WriteFile(modulePath, bzl.Format(modFile), 0644)
-}
-
-func git(repoRoot string, args ...string) (string, error) {
-	cmd := exec.Command("git", args...)
-	cmd.Dir = repoRoot
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		return "", fmt.Errorf(
-			"git %s: %v\n---\n%s\n---\n",
-			strings.Join(args, " "),
-			err,
-			out,
-		)
-	}
-	return string(out), nil
+	files.write("MODULE.bazel", data)
+	return nil
 }
 
-func makeTgz(w io.Writer, repoRoot string, ref string) (string, error) {
-	hashw := sha256.New()
-
-	gzw, err := gzip.NewWriterLevel(io.MultiWriter(w, hashw), gzip.BestCompression)
+// moduleAt returns MODULE.bazel as it is shipped in the release tarball of
+// ref, i.e. with the module version set to tag.
+func moduleAt(repoRoot, ref, tag string) ([]byte, error) {
+	r, err := openRepo(repoRoot)
 	if err != nil {
-		return "", fmt.Errorf("create gzip writer: %w", err)
+		return nil, err
 	}
-
-	tw := tar.NewWriter(gzw)
-
-	// WORKSPACE in the resulting tarball needs to be much
-	// smaller than of hermetic_cc_toolchain. See #15.
-	// See that README why we are not adding the top-level README.md.
-	// These files will become top-level during processing.
-	substitutes := map[string]string{
-		"tools/releaser/data/WORKSPACE": "WORKSPACE",
-		"tools/releaser/data/README":    "README",
-	}
-
-	removals := map[string]struct{}{
-		"tools/":               struct{}{},
-		"tools/releaser/":      struct{}{},
-		"tools/releaser/data/": struct{}{},
-	}
-
-	updates := map[string]struct{}{
-		"MODULE.bazel": {},
-	}
-
-	// Paths to be included to the release
-	cmd := exec.Command(
-		"git",
-		"archive",
-		"--format=tar",
-		ref,
-		"LICENSE",
-		"toolchain/*",
-
-		// files to be renamed
-		"tools/releaser/data/WORKSPACE",
-		"tools/releaser/data/README",
-
-		// files to be updated
-		"MODULE.bazel",
-	)
-
-	// the tarball produced by `git archive` has too many artifacts:
-	// - file metadata is different when different SHAs are used.
-	// - the archive contains the repo SHA as a "comment".
-	// Therefore, parse whatever `git archive` outputs and sanitize it.
-	cmd.Dir = repoRoot
-	cmd.Stderr = os.Stderr
-
-	stdout, err := cmd.StdoutPipe()
+	data, err := r.readFile(ref, "MODULE.bazel")
 	if err != nil {
-		return "", fmt.Errorf("StdoutPipe: %w", err)
-	}
-
-	if err := cmd.Start(); err != nil {
-		return "", fmt.Errorf("git archive: %w", err)
+		return nil, err
 	}
-
-	tr := tar.NewReader(stdout)
-	for {
-		hdr, err := tr.Next()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return "", fmt.Errorf("read archive: %w", err)
-		}
-
-		// pax headers contain things we want to clean in
-		// the first place.
-		if hdr.Typeflag == tar.TypeXGlobalHeader {
-			continue
-		}
-
-		name := hdr.Name
-
-		if _, ok := removals[name]; ok {
-			continue
-		}
-
-		if n, ok := substitutes[name]; ok {
-			name = n
-		}
-
-		source := io.NopCloser(tr)
-		size := hdr.Size
-		if _, ok := updates[name]; ok {
-			newFile, err := os.Open(path.Join(repoRoot, name))
-			if err != nil {
-				return "", err
-			}
-			source = newFile
-			fileInfo, err := newFile.Stat()
-			if err != nil {
-				return "", err
-			}
-			size = fileInfo.Size()
-		}
-
-		if err := tw.WriteHeader(&tar.Header{
-			Name:    name,
-			Mode:    int64(hdr.Mode & 0777),
-			Size:    size,
-			ModTime: time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC),
-			Format:  tar.FormatGNU,
-		}); err != nil {
-			return "", err
-		}
-
-		_, err = io.Copy(tw, source)
-		_ = source.Close()
-		if err != nil {
-			return "", fmt.Errorf("writing %q to archive: %w", name, err)
-		}
-	}
-
-	if err := tw.Close(); err != nil {
-		return "", fmt.Errorf("close tar writer: %w", err)
-	}
-
-	if err := gzw.Close(); err != nil {
-		return "", fmt.Errorf("close gzip stream: %w", err)
-	}
-
-	// If at this point cmd.Wait() is called, it gets stuck
-	// on Windows. Since there isn't any value from the subprocess
-	// at this point, do the best-effort Kill followed by Wait.
-	_ = cmd.Process.Kill()
-	_ = cmd.Wait()
-
-	return fmt.Sprintf("%x", hashw.Sum(nil)), nil
-}
-
-type zigUpstream struct {
-	version     string // e.g. 0.11.0-dev.2619+bd3e248c7
-	urlTemplate string // https://mirror.bazel.build/ziglang.org/builds/zig-{host_platform}-{version}.{_ext}
+	return setModuleVersion(path.Join(repoRoot, "MODULE.bazel"), data, tag)
 }
 
-// check if zig sdk is properly mirrored
-func checkZigMirrored(repoRoot string) error {
-	upstream, err := parseZigUpstream(path.Join(repoRoot, "toolchain", "private", "zig_sdk.bzl"))
+// setModuleVersion returns the MODULE.bazel contents with the module version
+// set to the given tag.
+func setModuleVersion(modulePath string, data []byte, tag string) ([]byte, error) {
+	modFile, err := bzl.ParseModule(modulePath, data)
 	if err != nil {
-		return err
-	}
-
-	if !strings.Contains(upstream.version, "dev") {
-		log("skipping mirror check for release version %q", upstream.version)
-		return nil
+		return nil, err
 	}
-
-	// spot-checking only windows-x86_64, because:
-	// - to check all platforms, we should parse much more of zig_sdk.bzl.
-	// - so we'd rather pick a single platform and test it.
-	// - because windows coverage is smallest, let's take the windows platform.
-	url := strings.Replace(upstream.urlTemplate, "{host_platform}", "windows-x86_64", 1)
-	url = strings.ReplaceAll(url, "{version}", upstream.version)
-	url = strings.Replace(url, "{_ext}", "zip", 1)
-
-	log("checking if zig is mirorred in %q", url)
-
-	resp, err := http.Head(url)
-	if err != nil {
-		return err
-	}
-
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("got non-200: %s", resp.Status)
+	moduleName := "hermetic_cc_toolchain"
+	moduleRule := modFile.RuleNamed(moduleName)
+	if moduleRule == nil {
+		return nil, fmt.Errorf("%q does not declare module %q", modulePath, moduleName)
 	}
-
-	return nil
+	moduleRule.SetAttr("version", &bzl.StringExpr{Value: strings.TrimPrefix(tag, "v")})
+	return bzl.Format(modFile), nil
 }
 
-// parseZigUpstrem parses "VERSION" from toolchain/private/zig_sdk.bzl
-func parseZigUpstream(defsPath string) (zigUpstream, error) {
-	var ret zigUpstream
+// makeTgz writes the release tarball for ref to w and returns its sha256.
+// See readArchiveEntries for what goes into it.
+func makeTgz(w io.Writer, repoRoot string, ref string, overrides map[string][]byte) (string, error) {
+	return makeArchive(w, repoRoot, ref, overrides, _tgzFormat)
+}
 
-	data, err := os.ReadFile(defsPath)
+// makeArchive writes the release archive for ref in format to w and returns
+// its sha256.
+func makeArchive(w io.Writer, repoRoot string, ref string, overrides map[string][]byte, format string) (string, error) {
+	entries, err := readArchiveEntries(repoRoot, ref, overrides)
 	if err != nil {
-		return ret, err
+		return "", err
 	}
-	parsed, err := bzl.Parse(defsPath, data)
-	if err != nil {
-		return ret, err
-	}
-
-	var nightlyFormat, releaseFormat string
-	for _, expr := range parsed.Stmt {
-		def, ok := expr.(*bzl.AssignExpr)
-		if !ok {
-			continue
-		}
-
-		key := def.LHS.(*bzl.Ident)
-		var to *string
-
-		switch key.Name {
-		case "VERSION":
-			to = &ret.version
-		case "URL_FORMAT_RELEASE":
-			to = &releaseFormat
-		case "URL_FORMAT_NIGHTLY":
-			to = &nightlyFormat
-		default:
-			continue
-		}
-
-		value, ok := def.RHS.(*bzl.StringExpr)
-		if !ok {
-			return ret, errors.New("got a non-string expression")
-		}
-
-		*to = value.Value
-	}
-
-	if ret.version == "" {
-		return ret, errors.New("VERSION not found")
-	}
-	if strings.Contains(ret.version, "dev") {
-		ret.urlTemplate = strings.Replace(nightlyFormat,
-			"https://ziglang.org/",
-			"https://mirror.bazel.build/ziglang.org/",
-			1,
-		)
-	} else {
-		ret.urlTemplate = releaseFormat
-	}
-	if ret.urlTemplate == "" {
-		return ret, fmt.Errorf("url format for %q not found", ret.version)
-	}
-
-	return ret, nil
+	return writeArchive(w, format, entries)
 }
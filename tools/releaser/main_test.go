@@ -3,11 +3,21 @@
 package main
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"path"
+	"strings"
 	"testing"
 
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -28,7 +38,7 @@ func TestRegex(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		t.Run(fmt.Sprintf("tag=%s good=%s", tt.tag, tt.good), func(t *testing.T) {
+		t.Run(fmt.Sprintf("tag=%s good=%t", tt.tag, tt.good), func(t *testing.T) {
 			matched := _tagRegexp.MatchString(tt.tag)
 
 			if tt.good && !matched {
@@ -40,60 +50,708 @@ func TestRegex(t *testing.T) {
 	}
 }
 
-func TestParseZigVersion(t *testing.T) {
+func TestUpdateModuleBoilerplate(t *testing.T) {
+	repoRoot := t.TempDir()
+	for _, f := range _moduleBoilerplateFiles {
+		fpath := path.Join(repoRoot, f)
+		require.NoError(t, os.MkdirAll(path.Dir(fpath), 0755))
+		contents := "before\n\n" + genModuleRegion("v1.0.0") + "\nafter\n"
+		require.NoError(t, os.WriteFile(fpath, []byte(contents), 0644))
+	}
+
+	files := newPendingFiles(repoRoot)
+	require.NoError(t, updateModuleBoilerplate(files, "v2.0.0"))
+	require.NoError(t, files.flush())
+
+	for _, f := range _moduleBoilerplateFiles {
+		got, err := os.ReadFile(path.Join(repoRoot, f))
+		require.NoError(t, err)
+		assert.Equal(t, `before
+
+# BEGIN hermetic_cc_toolchain, updated by //tools/releaser
+bazel_dep(name = "hermetic_cc_toolchain", version = "2.0.0")
+
+toolchains = use_extension("@hermetic_cc_toolchain//toolchain:ext.bzl", "toolchains")
+use_repo(toolchains, "zig_sdk")
+# END hermetic_cc_toolchain
+
+after
+`, string(got))
+	}
+}
+
+func TestUpdateModuleBoilerplateNoMarker(t *testing.T) {
 	tests := []struct {
 		name     string
 		contents string
-		want     zigUpstream
 		wantErr  string
 	}{
 		{
-			name:     "released url",
-			contents: `VERSION = "0.11.0"; URL_FORMAT_RELEASE = "https://ziglang.org/download/{version}/zig-{host_platform}-{version}.{_ext}"`,
-			want: zigUpstream{
-				version:     "0.11.0",
-				urlTemplate: "https://ziglang.org/download/{version}/zig-{host_platform}-{version}.{_ext}",
+			name:     "no start marker",
+			contents: genModuleBoilerplate("v1.0.0"),
+			wantErr:  "does not contain start marker",
+		},
+		{
+			name:     "no end marker",
+			contents: _moduleStartMarker + genModuleBoilerplate("v1.0.0"),
+			wantErr:  "does not contain end marker",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repoRoot := t.TempDir()
+			for _, f := range _moduleBoilerplateFiles {
+				fpath := path.Join(repoRoot, f)
+				require.NoError(t, os.MkdirAll(path.Dir(fpath), 0755))
+				require.NoError(t, os.WriteFile(fpath, []byte(tt.contents), 0644))
+			}
+
+			err := updateModuleBoilerplate(newPendingFiles(repoRoot), "v2.0.0")
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestUpdateBoilerplate(t *testing.T) {
+	repoRoot := t.TempDir()
+	for _, f := range _boilerplateFiles {
+		fpath := path.Join(repoRoot, f)
+		require.NoError(t, os.MkdirAll(path.Dir(fpath), 0755))
+		contents := "before\n\n" + genBoilerplate(releaseEntry{Tag: "v1.0.0", SHA256: strings.Repeat("0", 64)}) + "\nzig_toolchains()\n"
+		require.NoError(t, os.WriteFile(fpath, []byte(contents), 0644))
+	}
+
+	files := newPendingFiles(repoRoot)
+	require.NoError(t, updateBoilerplate(files, genBoilerplate(releaseEntry{Tag: "v2.0.0", SHA256: _testSHA256})))
+	for _, f := range _boilerplateFiles {
+		got, err := files.read(f)
+		require.NoError(t, err)
+		// Only the first zig_toolchains() ends the boilerplate.
+		assert.Equal(t, "before\n\n"+genBoilerplate(releaseEntry{Tag: "v2.0.0", SHA256: _testSHA256})+"\nzig_toolchains()\n", string(got))
+	}
+}
+
+func TestUpdateModuleVersion(t *testing.T) {
+	repoRoot := t.TempDir()
+	require.NoError(t, os.WriteFile(path.Join(repoRoot, "MODULE.bazel"), []byte(`module(name = "hermetic_cc_toolchain")
+
+bazel_dep(name = "platforms", version = "0.0.10")
+`), 0644))
+
+	files := newPendingFiles(repoRoot)
+	require.NoError(t, updateModuleVersion(files, "v2.0.0-rc1"))
+	got, err := files.read("MODULE.bazel")
+	require.NoError(t, err)
+	assert.Equal(t, `module(
+    name = "hermetic_cc_toolchain",
+    version = "2.0.0-rc1",
+)
+
+bazel_dep(name = "platforms", version = "0.0.10")
+`, string(got))
+
+	require.NoError(t, os.WriteFile(path.Join(repoRoot, "MODULE.bazel"), []byte(`module(name = "rules_zig")`+"\n"), 0644))
+	err = updateModuleVersion(newPendingFiles(repoRoot), "v2.0.0")
+	assert.ErrorContains(t, err, `does not declare module "hermetic_cc_toolchain"`)
+}
+
+func TestParseFlags(t *testing.T) {
+	t.Setenv("BUILD_WORKSPACE_DIRECTORY", "/src")
+
+	got, err := parseFlags([]string{"-tag", "v1.0.0", "-dry-run", "-formats", "zip,tar.gz"})
+	require.NoError(t, err)
+	assert.Equal(t, releaseConfig{
+		repoRoot:     "/src",
+		tag:          "v1.0.0",
+		dryRun:       true,
+		outputFormat: "text",
+		formats:      []string{"tar.gz", "zip"},
+	}, got)
+
+	_, err = parseFlags([]string{"-tag", "v1.0.0", "-formats", "zip"})
+	assert.ErrorContains(t, err, "-formats must include tar.gz")
+	_, err = parseFlags([]string{"-tag", "v1.0.0", "v1.0.1"})
+	assert.ErrorContains(t, err, `unexpected arguments ["v1.0.1"]`)
+}
+
+const (
+	// _fixtureSHA256 is the sha256 of the v1.0.0 tarball of
+	// initFixtureRepo. It only changes if the fixture or the tarball
+	// format does; the latter breaks the reproducibility of past
+	// releases.
+	_fixtureSHA256 = "618306ebc57a2aa5e1d135a09b134335e967726e31f3e4703af1a8abcfa46099"
+
+	// _fixtureList is the -list of the v1.0.0 tarball of
+	// initFixtureRepo.
+	_fixtureList = `0664        4 LICENSE
+0664       98 MODULE.bazel
+0775        0 toolchain/
+0664       86 toolchain/defs.bzl
+0775        0 toolchain/private/
+0664       35 toolchain/private/defs.bzl
+0664      323 toolchain/private/zig_sdk.bzl
+0664       15 README
+0664       42 WORKSPACE
+`
+
+	_fixtureLinux = "/download/0.15.2/zig-x86_64-linux-0.15.2.tar.xz"
+	_fixtureMacos = "/download/0.15.2/zig-aarch64-macos-0.15.2.tar.xz"
+)
+
+// initFixtureRepo creates a hermetic_cc_toolchain repository released as
+// v0.9.0 with one more commit, with the files the releaser reads and
+// updates. Zig is downloaded from ziglang.org, see fixtureDeps.
+func initFixtureRepo(t *testing.T) string {
+	t.Helper()
+	repoRoot := initGitRepo(t)
+	writeZigSDK(t, repoRoot, "https://ziglang.org/download/{version}/zig-{zig_platform}-{version}.{_ext}")
+	archive, err := os.ReadFile(path.Join("data", "archive.json"))
+	require.NoError(t, err)
+	branches, err := os.ReadFile(path.Join("data", "branches.json"))
+	require.NoError(t, err)
+	oldSHA256 := strings.Repeat("0", 64)
+	commitFiles(t, repoRoot, "initial", map[string]string{
+		_archiveConfigPath:              string(archive),
+		_branchesConfigPath:             string(branches),
+		_releasesPath:                   `{"version": 2, "releases": []}`,
+		_glibcsPath:                     `_GLIBCS = ["2.17", "2.28"]` + "\n",
+		"LICENSE":                       "MIT\n",
+		"tools/releaser/data/README":    "release README\n",
+		"tools/releaser/data/WORKSPACE": "workspace(name = \"hermetic_cc_toolchain\")\n",
+		"MODULE.bazel": `module(
+    name = "hermetic_cc_toolchain",
+    version = "0.9.0",
+)
+`,
+		"README.md": "# hermetic_cc_toolchain\n\n```starlark\n" + genBoilerplate(releaseEntry{Tag: "v0.9.0", SHA256: oldSHA256}) +
+			"```\n\n```starlark\n" + genModuleRegion("v0.9.0") + "```\n",
+		"examples/rules_cc/WORKSPACE":  genBoilerplate(releaseEntry{Tag: "v0.9.0", SHA256: oldSHA256}),
+		"examples/bzlmod/MODULE.bazel": genModuleRegion("v0.9.0"),
+	})
+	tagRepo(t, repoRoot, "v0.9.0", "HEAD")
+	commitFiles(t, repoRoot, "Add glibc 2.41", map[string]string{
+		_glibcsPath: `_GLIBCS = ["2.17", "2.28", "2.41"]` + "\n",
+		// v1 is the next major version.
+		"MODULE.bazel": `module(
+    name = "hermetic_cc_toolchain",
+    version = "0.9.0",
+    compatibility_level = 1,
+)
+`,
+	})
+	return repoRoot
+}
+
+// fixtureDeps are the releaseDeps of initFixtureRepo, with the zig
+// downloads served by mirror.
+func fixtureDeps(t *testing.T, mirror *httptest.Server, stdout io.Writer) releaseDeps {
+	t.Helper()
+	u, err := url.Parse(mirror.URL)
+	require.NoError(t, err)
+	transport := mirror.Client().Transport
+	return releaseDeps{
+		openRepo: openRepo,
+		client: &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			// Whatever the host, e.g. ziglang.org.
+			r = r.Clone(r.Context())
+			r.URL.Scheme = u.Scheme
+			r.URL.Host = u.Host
+			return transport.RoundTrip(r)
+		})},
+		stdout: stdout,
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// fixtureMirror mirrors the zig of initFixtureRepo.
+func fixtureMirror(t *testing.T) *httptest.Server {
+	return fakeZigMirror(t, map[string]string{
+		_fixtureLinux: "linux-x86_64",
+		_fixtureMacos: "macos-aarch64",
+	})
+}
+
+func fixtureConfig(repoRoot string) releaseConfig {
+	return releaseConfig{
+		repoRoot:     repoRoot,
+		tag:          "v1.0.0",
+		outputFormat: "json",
+		formats:      []string{_tgzFormat},
+	}
+}
+
+// fixtureState is what a release may change in the repository.
+type fixtureState struct {
+	head     string
+	tags     []string
+	modified []string
+	files    map[string]string
+}
+
+func readFixtureState(t *testing.T, repoRoot string) fixtureState {
+	t.Helper()
+	r, err := openRepo(repoRoot)
+	require.NoError(t, err)
+	var ret fixtureState
+	ret.head, err = r.commitHash("HEAD")
+	require.NoError(t, err)
+	ret.tags, err = r.tags()
+	require.NoError(t, err)
+	ret.modified, err = r.modified()
+	require.NoError(t, err)
+
+	ret.files = make(map[string]string)
+	entries, err := os.ReadDir(repoRoot)
+	require.NoError(t, err)
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), "hermetic_cc_toolchain-") {
+			ret.files[e.Name()] = readFile(t, path.Join(repoRoot, e.Name()))
+		}
+	}
+	for _, f := range []string{"README.md", "MODULE.bazel", _changelogPath, _releasesPath} {
+		data, err := os.ReadFile(path.Join(repoRoot, f))
+		if err == nil {
+			ret.files[f] = string(data)
+		}
+	}
+	return ret
+}
+
+func TestRelease(t *testing.T) {
+	repoRoot := initFixtureRepo(t)
+	before := readFixtureState(t, repoRoot)
+	var stdout bytes.Buffer
+	require.NoError(t, release(fixtureConfig(repoRoot), fixtureDeps(t, fixtureMirror(t), &stdout)))
+
+	var out releaseOutput
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &out))
+	assert.Equal(t, _fixtureSHA256, out.SHA256)
+	assert.Equal(t, "v1.0.0", out.Tag)
+	assert.False(t, out.DryRun)
+	assert.Equal(t, "0.15.2", out.ZigVersion)
+	assert.Equal(t, []string{
+		"https://ziglang.org" + _fixtureLinux,
+		"https://ziglang.org" + _fixtureMacos,
+	}, out.MirrorCheck.URLs)
+	assert.Equal(t, []string{
+		"MODULE.bazel",
+		"README.md",
+		"examples/rules_cc/WORKSPACE",
+		"examples/bzlmod/MODULE.bazel",
+		_changelogPath,
+		_releasesPath,
+	}, out.FilesModified)
+
+	// The release commit has the updated files, is tagged and leaves the
+	// tree clean.
+	r, err := openRepo(repoRoot)
+	require.NoError(t, err)
+	commits, err := r.commits(before.head, "HEAD")
+	require.NoError(t, err)
+	require.Len(t, commits, 1)
+	assert.Equal(t, "Releasing hermetic_cc_toolchain v1.0.0", commits[0].subject)
+	assert.ElementsMatch(t, out.FilesModified, commits[0].files)
+	after := readFixtureState(t, repoRoot)
+	assert.Equal(t, []string{"v0.9.0", "v1.0.0"}, after.tags)
+	assert.Empty(t, after.modified)
+	tagged, err := r.commitHash("v1.0.0")
+	require.NoError(t, err)
+	head, err := r.commitHash("HEAD")
+	require.NoError(t, err)
+	assert.Equal(t, head, tagged)
+
+	// releases.json has the release. Its commit is only in the output,
+	// until the next release records it.
+	assert.Equal(t, tagged, out.Commit)
+	tgzArchive, err := newManifestArchive("v1.0.0", _tgzFormat, _fixtureSHA256)
+	require.NoError(t, err)
+	var manifest releaseManifest
+	require.NoError(t, json.Unmarshal([]byte(after.files[_releasesPath]), &manifest))
+	assert.Equal(t, []releaseEntry{{
+		Tag:        "v1.0.0",
+		SHA256:     _fixtureSHA256,
+		ZigVersion: "0.15.2",
+		Hash:       hashReproducible,
+		Archives:   []manifestArchive{tgzArchive},
+	}}, manifest.Releases)
+
+	assert.Equal(t, "# hermetic_cc_toolchain\n\n```starlark\n"+genBoilerplate(releaseEntry{Tag: "v1.0.0", SHA256: _fixtureSHA256})+
+		"```\n\n```starlark\n"+genModuleRegion("v1.0.0")+"```\n", after.files["README.md"])
+	assert.Equal(t, `module(
+    name = "hermetic_cc_toolchain",
+    version = "1.0.0",
+    compatibility_level = 1,
+)
+`, after.files["MODULE.bazel"])
+	assert.Regexp(t, "^# Changelog\n\n## v1.0.0\n\nChanges since v0.9.0.\n\n"+
+		"### Upgrade notes\n\n- New glibc versions: 2.41.\n\n"+
+		"### Toolchain\n\n- Add glibc 2.41 \\([0-9a-f]{7}\\)\n$", after.files[_changelogPath])
+
+	// The release artifacts are next to the repository.
+	tgz := after.files["hermetic_cc_toolchain-v1.0.0.tar.gz"]
+	assert.Equal(t, _fixtureSHA256, fmt.Sprintf("%x", sha256.Sum256([]byte(tgz))))
+	assert.Contains(t, after.files, "hermetic_cc_toolchain-v1.0.0.notes.md")
+	assert.Contains(t, after.files, "hermetic_cc_toolchain-v1.0.0.intoto.json")
+	assert.Len(t, after.files, 7)
+
+	var list bytes.Buffer
+	require.NoError(t, listArchive(&list, strings.NewReader(tgz)))
+	assert.Equal(t, _fixtureList, list.String())
+}
+
+func TestReleaseRecordsPreviousCommit(t *testing.T) {
+	repoRoot := initFixtureRepo(t)
+	require.NoError(t, release(fixtureConfig(repoRoot), fixtureDeps(t, fixtureMirror(t), io.Discard)))
+	commitFiles(t, repoRoot, "fix: a fix", map[string]string{"LICENSE": "MIT License\n"})
+
+	cfg := fixtureConfig(repoRoot)
+	cfg.tag = "v1.0.1"
+	require.NoError(t, release(cfg, fixtureDeps(t, fixtureMirror(t), io.Discard)))
+
+	// The commit of v1.0.0 is recorded by the release commit of v1.0.1.
+	r, err := openRepo(repoRoot)
+	require.NoError(t, err)
+	tagged, err := r.commitHash("v1.0.0")
+	require.NoError(t, err)
+	released, err := r.readFile("v1.0.1", _releasesPath)
+	require.NoError(t, err)
+	var manifest releaseManifest
+	require.NoError(t, json.Unmarshal(released, &manifest))
+	require.Len(t, manifest.Releases, 2)
+	assert.Equal(t, "v1.0.0", manifest.Releases[0].Tag)
+	assert.Equal(t, tagged, manifest.Releases[0].Commit)
+	assert.Equal(t, "v1.0.1", manifest.Releases[1].Tag)
+	assert.Empty(t, manifest.Releases[1].Commit)
+	assert.Empty(t, readFixtureState(t, repoRoot).modified)
+}
+
+func TestReleaseDryRun(t *testing.T) {
+	repoRoot := initFixtureRepo(t)
+	before := readFixtureState(t, repoRoot)
+	cfg := fixtureConfig(repoRoot)
+	cfg.dryRun = true
+	var stdout bytes.Buffer
+	require.NoError(t, release(cfg, fixtureDeps(t, fixtureMirror(t), &stdout)))
+
+	var out releaseOutput
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &out))
+	assert.True(t, out.DryRun)
+	assert.Equal(t, _fixtureSHA256, out.SHA256)
+	assert.Len(t, out.FilesModified, 6)
+	assert.Equal(t, before, readFixtureState(t, repoRoot))
+}
+
+func TestReleaseExistingTag(t *testing.T) {
+	repoRoot := initFixtureRepo(t)
+	mirror := fixtureMirror(t)
+	require.NoError(t, release(fixtureConfig(repoRoot), fixtureDeps(t, mirror, io.Discard)))
+	before := readFixtureState(t, repoRoot)
+	assert.Empty(t, before.modified)
+
+	// The tag is rebuilt with the same hashes, and nothing is committed.
+	var stdout bytes.Buffer
+	require.NoError(t, release(fixtureConfig(repoRoot), fixtureDeps(t, mirror, &stdout)))
+	var out releaseOutput
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &out))
+	assert.Equal(t, _fixtureSHA256, out.SHA256)
+	assert.Empty(t, out.FilesModified)
+	assert.Equal(t, before, readFixtureState(t, repoRoot))
+}
+
+func TestReleaseFormats(t *testing.T) {
+	repoRoot := initFixtureRepo(t)
+	mirror := fixtureMirror(t)
+	cfg := fixtureConfig(repoRoot)
+	cfg.formats = []string{_tgzFormat, "zip"}
+	var stdout bytes.Buffer
+	require.NoError(t, release(cfg, fixtureDeps(t, mirror, &stdout)))
+	var out releaseOutput
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &out))
+	require.Len(t, out.Archives, 2)
+
+	// Every format is recorded, and the boilerplate lists the other ones.
+	tgz, err := newManifestArchive("v1.0.0", _tgzFormat, out.Archives[0].SHA256)
+	require.NoError(t, err)
+	zip, err := newManifestArchive("v1.0.0", "zip", out.Archives[1].SHA256)
+	require.NoError(t, err)
+	m, err := readReleaseManifest(repoRoot)
+	require.NoError(t, err)
+	recorded, ok := m.lookup("v1.0.0")
+	require.True(t, ok)
+	assert.Equal(t, []manifestArchive{tgz, zip}, recorded.Archives)
+	assert.Equal(t, "https://github.com/uber/hermetic_cc_toolchain/releases/download/v1.0.0/hermetic_cc_toolchain-v1.0.0.zip", zip.URL)
+	before := readFixtureState(t, repoRoot)
+	assert.Empty(t, before.modified)
+	assert.Contains(t, before.files["README.md"], genBoilerplate(recorded))
+	assert.Contains(t, before.files["README.md"], `#   .zip: sha256 = "`+zip.SHA256+`"`)
+
+	// Without -formats, the boilerplate of the tag still lists the zip.
+	stdout.Reset()
+	require.NoError(t, release(fixtureConfig(repoRoot), fixtureDeps(t, mirror, &stdout)))
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &out))
+	assert.Empty(t, out.FilesModified)
+	after := readFixtureState(t, repoRoot)
+	assert.Equal(t, before.head, after.head)
+	assert.Empty(t, after.modified)
+	assert.Equal(t, before.files["README.md"], after.files["README.md"])
+}
+
+func TestReleasePinned(t *testing.T) {
+	repoRoot := initFixtureRepo(t)
+	pinned := strings.Repeat("ab", 32)
+	commitFiles(t, repoRoot, "pin v0.9.0", map[string]string{
+		_releasesPath: `{"version": 1, "releases": [{"tag": "v0.9.0", "sha256": "` + pinned + `", "hash": "pinned"}]}`,
+	})
+	before := readFixtureState(t, repoRoot)
+
+	cfg := fixtureConfig(repoRoot)
+	cfg.tag = "v0.9.0"
+	var stdout bytes.Buffer
+	require.NoError(t, release(cfg, fixtureDeps(t, fixtureMirror(t), &stdout)))
+
+	// Only the boilerplate is updated to the pinned hash: nothing is
+	// built, committed or tagged.
+	var out releaseOutput
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &out))
+	assert.Equal(t, pinned, out.SHA256)
+	assert.Empty(t, out.Tarball)
+	assert.Equal(t, []string{"README.md", "examples/rules_cc/WORKSPACE"}, out.FilesModified)
+
+	after := readFixtureState(t, repoRoot)
+	assert.Equal(t, before.head, after.head)
+	assert.Equal(t, before.tags, after.tags)
+	assert.Equal(t, out.FilesModified, after.modified)
+	assert.Contains(t, after.files["README.md"], `sha256 = "`+pinned+`"`)
+	assert.Equal(t, before.files[_releasesPath], after.files[_releasesPath])
+}
+
+func TestReleaseErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		prepare func(t *testing.T, repoRoot string, cfg *releaseConfig)
+		mirror  map[string]string
+		wantErr string
+	}{
+		{
+			name:    "no tag",
+			prepare: func(t *testing.T, _ string, cfg *releaseConfig) { cfg.tag = "" },
+			wantErr: "tag is required",
+		},
+		{
+			name:    "bad tag",
+			prepare: func(t *testing.T, _ string, cfg *releaseConfig) { cfg.tag = "1.0.0" },
+			wantErr: _errTag.Error(),
+		},
+		{
+			name: "dirty tree",
+			prepare: func(t *testing.T, repoRoot string, _ *releaseConfig) {
+				require.NoError(t, os.WriteFile(path.Join(repoRoot, "LICENSE"), []byte("GPL\n"), 0644))
+			},
+			wantErr: "the working tree has uncommitted changes:\n---\nLICENSE\n---\n",
+		},
+		{
+			name: "wrong branch",
+			prepare: func(t *testing.T, repoRoot string, _ *releaseConfig) {
+				checkoutRepo(t, repoRoot, &gogit.CheckoutOptions{
+					Branch: plumbing.NewBranchReferenceName("feature"),
+					Create: true,
+				})
 			},
+			wantErr: `releases are cut from main, release-{major}.{minor}, release-{major}.x, not "feature"`,
 		},
 		{
-			name:     "nightly url",
-			contents: `VERSION = "0.11.0-dev.2619+bd3e248c7"; URL_FORMAT_NIGHTLY = "https://ziglang.org/builds/zig-{host_platform}-{version}.{_ext}"`,
-			want: zigUpstream{
-				version:     "0.11.0-dev.2619+bd3e248c7",
-				urlTemplate: "https://mirror.bazel.build/ziglang.org/builds/zig-{host_platform}-{version}.{_ext}",
+			name: "detached HEAD",
+			prepare: func(t *testing.T, repoRoot string, _ *releaseConfig) {
+				r, err := openRepo(repoRoot)
+				require.NoError(t, err)
+				c, err := r.resolve("v0.9.0")
+				require.NoError(t, err)
+				checkoutRepo(t, repoRoot, &gogit.CheckoutOptions{Hash: c.Hash})
 			},
+			wantErr: `releases are cut from main, release-{major}.{minor}, release-{major}.x, not ""`,
 		},
 		{
-			name:     "not an assignment",
-			contents: `def VERSION(x): return x`,
-			wantErr:  "got a non-string expression",
+			name: "backwards",
+			prepare: func(t *testing.T, repoRoot string, _ *releaseConfig) {
+				tagRepo(t, repoRoot, "v1.1.0-rc1", "HEAD")
+			},
+			wantErr: "v1.0.0 is before v1.1.0-rc1, the tags of main do not go backwards",
+		},
+		{
+			name: "other line",
+			prepare: func(t *testing.T, repoRoot string, _ *releaseConfig) {
+				checkoutReleaseBranch(t, repoRoot, "release-0.9", "v0.9.0")
+			},
+			wantErr: "release-0.9 only cuts v0.9.* tags, not v1.0.0",
+		},
+		{
+			name: "unrecorded releases",
+			prepare: func(t *testing.T, repoRoot string, _ *releaseConfig) {
+				commitFiles(t, repoRoot, "downgrade releases.json", map[string]string{
+					_releasesPath: `{"version": 1, "releases": []}`,
+				})
+			},
+			wantErr: _releasesPath + " does not record the zig version and commit of every release; " +
+				"run `bazel run //tools/releaser -- backfill` first",
+		},
+		{
+			name: "compatibility_level",
+			prepare: func(t *testing.T, repoRoot string, _ *releaseConfig) {
+				commitFiles(t, repoRoot, "revert compatibility_level", map[string]string{
+					"MODULE.bazel": `module(name = "hermetic_cc_toolchain", version = "0.9.0")` + "\n",
+				})
+			},
+			wantErr: "MODULE.bazel: the major version changes from v0.9.0 to v1.0.0, but compatibility_level is 0, like in v0.9.0",
+		},
+		{
+			name: "dev dependency",
+			prepare: func(t *testing.T, repoRoot string, _ *releaseConfig) {
+				commitFiles(t, repoRoot, "use skylib", map[string]string{
+					"MODULE.bazel": `module(
+    name = "hermetic_cc_toolchain",
+    version = "0.9.0",
+    compatibility_level = 1,
+)
+
+bazel_dep(name = "bazel_skylib", version = "1.7.1", dev_dependency = True)
+`,
+					"toolchain/utils.bzl": `load("@bazel_skylib//lib:paths.bzl", "paths")` + "\n",
+				})
+			},
+			wantErr: `toolchain/utils.bzl:1: "@bazel_skylib//lib:paths.bzl": @bazel_skylib is a dev_dependency of MODULE.bazel`,
+		},
+		{
+			name:    "not mirrored",
+			mirror:  map[string]string{_fixtureLinux: "linux-x86_64"},
+			wantErr: "zig is not mirrored: https://ziglang.org" + _fixtureMacos + ": got non-200: 404 Not Found",
 		},
 		{
-			name:     "missing version assignment",
-			contents: "x1 = 1",
-			wantErr:  "assign statement VERSION = <...> not found",
+			name: "missing marker",
+			prepare: func(t *testing.T, repoRoot string, _ *releaseConfig) {
+				commitFiles(t, repoRoot, "drop the example", map[string]string{
+					"examples/rules_cc/WORKSPACE": "# moved\n",
+				})
+			},
+			wantErr: `update boilerplate: "examples/rules_cc/WORKSPACE" does not contain start marker`,
 		},
 		{
-			name:     "missing url assignment",
-			contents: `VERSION = "0.11.0"; URL_FORMAT_NIGHTLY = "https://ziglang.org/builds/zig-{host_platform}-{version}.{_ext}"`,
-			wantErr:  "url format for '0.11.0' not found",
+			name: "missing module marker",
+			prepare: func(t *testing.T, repoRoot string, _ *releaseConfig) {
+				commitFiles(t, repoRoot, "drop the example", map[string]string{
+					"examples/bzlmod/MODULE.bazel": "# moved\n",
+				})
+			},
+			wantErr: `update bzlmod boilerplate: "examples/bzlmod/MODULE.bazel" does not contain start marker`,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			dir := t.TempDir()
-			fname := path.Join(dir, "toolchain.defs")
-			require.NoError(t, os.WriteFile(fname, []byte(tt.contents), 0644))
-
-			got, err := parseZigUpstream(fname)
-			if tt.wantErr != "" {
-				assert.Error(t, err, tt.wantErr)
-				return
+			repoRoot := initFixtureRepo(t)
+			cfg := fixtureConfig(repoRoot)
+			if tt.prepare != nil {
+				tt.prepare(t, repoRoot, &cfg)
 			}
+			before := readFixtureState(t, repoRoot)
 
-			require.NoError(t, err)
-			assert.Equal(t, tt.want, got)
+			mirror := fixtureMirror(t)
+			if tt.mirror != nil {
+				mirror = fakeZigMirror(t, tt.mirror)
+			}
+			var stdout bytes.Buffer
+			err := release(cfg, fixtureDeps(t, mirror, &stdout))
+			assert.ErrorContains(t, err, tt.wantErr)
+
+			// Nothing is written, committed or tagged.
+			assert.Empty(t, stdout.String())
+			assert.Equal(t, before, readFixtureState(t, repoRoot))
 		})
 	}
 }
+
+func TestReleaseSkipBranchCheck(t *testing.T) {
+	repoRoot := initFixtureRepo(t)
+	checkoutRepo(t, repoRoot, &gogit.CheckoutOptions{
+		Branch: plumbing.NewBranchReferenceName("feature"),
+		Create: true,
+	})
+	cfg := fixtureConfig(repoRoot)
+	cfg.skipBranchCheck = true
+	var stdout bytes.Buffer
+	require.NoError(t, release(cfg, fixtureDeps(t, fixtureMirror(t), &stdout)))
+
+	var out releaseOutput
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &out))
+	assert.Equal(t, _fixtureSHA256, out.SHA256)
+}
+
+// checkoutReleaseBranch creates branch at tag and checks it out.
+func checkoutReleaseBranch(t *testing.T, repoRoot, branch, tag string) {
+	t.Helper()
+	r, err := openRepo(repoRoot)
+	require.NoError(t, err)
+	c, err := r.resolve(tag)
+	require.NoError(t, err)
+	checkoutRepo(t, repoRoot, &gogit.CheckoutOptions{
+		Branch: plumbing.NewBranchReferenceName(branch),
+		Create: true,
+		Hash:   c.Hash,
+	})
+}
+
+func TestReleaseBackport(t *testing.T) {
+	repoRoot := initFixtureRepo(t)
+	tagRepo(t, repoRoot, "v1.0.0", "HEAD")
+	checkoutReleaseBranch(t, repoRoot, "release-0.9", "v0.9.0")
+	commitFiles(t, repoRoot, "fix: backport a fix", map[string]string{"LICENSE": "MIT License\n"})
+	before := readFixtureState(t, repoRoot)
+
+	cfg := fixtureConfig(repoRoot)
+	cfg.tag = "v0.9.1"
+	var stdout bytes.Buffer
+	require.NoError(t, release(cfg, fixtureDeps(t, fixtureMirror(t), &stdout)))
+
+	// The release commit is on the release branch.
+	after := readFixtureState(t, repoRoot)
+	assert.Equal(t, []string{"v0.9.0", "v0.9.1", "v1.0.0"}, after.tags)
+	r, err := openRepo(repoRoot)
+	require.NoError(t, err)
+	branch, err := r.branch()
+	require.NoError(t, err)
+	assert.Equal(t, "release-0.9", branch)
+	commits, err := r.commits(before.head, "v0.9.1")
+	require.NoError(t, err)
+	require.Len(t, commits, 1)
+	assert.Equal(t, "Releasing hermetic_cc_toolchain v0.9.1", commits[0].subject)
+
+	// The changes are the ones of the branch since v0.9.0, without the
+	// ones of main.
+	assert.Regexp(t, "^# Changelog\n\n## v0.9.1\n\nChanges since v0.9.0.\n\n"+
+		"### Bug fixes\n\n- backport a fix \\([0-9a-f]{7}\\)\n$", after.files[_changelogPath])
+	assert.Contains(t, after.files["MODULE.bazel"], `version = "0.9.1"`)
+
+	// The next patch release goes on, but not backwards.
+	cfg.tag = "v0.9.1-rc1"
+	err = release(cfg, fixtureDeps(t, fixtureMirror(t), io.Discard))
+	assert.EqualError(t, err, "v0.9.1-rc1 is before v0.9.1, the tags of release-0.9 do not go backwards")
+	cfg.tag = "v0.9.2-rc1"
+	assert.NoError(t, release(cfg, fixtureDeps(t, fixtureMirror(t), io.Discard)))
+}
+
+func TestReleaseList(t *testing.T) {
+	repoRoot := initFixtureRepo(t)
+	before := readFixtureState(t, repoRoot)
+	cfg := fixtureConfig(repoRoot)
+	cfg.list = true
+	var stdout bytes.Buffer
+	// -list needs neither the network nor the git history checks.
+	require.NoError(t, release(cfg, releaseDeps{stdout: &stdout}))
+	assert.Equal(t, _fixtureList, stdout.String())
+	assert.Equal(t, before, readFixtureState(t, repoRoot))
+}
@@ -0,0 +1,303 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+)
+
+const (
+	// _releasesPath is the manifest of all releases, relative to repoRoot.
+	_releasesPath = "tools/releaser/data/releases.json"
+
+	// _releasesVersion is the version of the releases.json format. Bump it
+	// on incompatible changes, so older releasers refuse to rewrite it.
+	//
+	// Version 2 records the sha256, the zig version and the commit of
+	// every release, so mirrors can verify the archives from releases.json
+	// alone.
+	_releasesVersion = 2
+
+	// _releasesVersionUnrecorded is the version of releases.json before the
+	// zig version and the commit were recorded. It is still read, but
+	// releases are only recorded once `releaser backfill` upgraded it.
+	_releasesVersionUnrecorded = 1
+
+	// hashReproducible means the releaser still computes the released hash.
+	hashReproducible = "reproducible"
+
+	// hashPinned means the releaser was changed since cutting the release
+	// (e.g. files got added or removed, the tar format changed, etc), so
+	// the released tarball no longer matches what the releaser computes.
+	// Since we cannot change the hash since it was released, it is pinned.
+	//
+	// Normally you don't need to pin a release, unless the CI job updates
+	// the hashes of already-released versions. Then just change the "hash"
+	// of that release to "pinned".
+	hashPinned = "pinned"
+)
+
+// releaseManifest is the contents of releases.json.
+type releaseManifest struct {
+	Version  int            `json:"version"`
+	Releases []releaseEntry `json:"releases"`
+}
+
+// releaseEntry describes a single release tarball.
+type releaseEntry struct {
+	Tag        string `json:"tag"`
+	SHA256     string `json:"sha256"`
+	ZigVersion string `json:"zig_version,omitempty"`
+	Commit     string `json:"commit,omitempty"`
+	Hash       string `json:"hash"`
+
+	// Archives are the archives of the release in every format, tar.gz
+	// included. Releases made before -formats only have the tar.gz one,
+	// whose sha256 is SHA256, and do not list it.
+	Archives []manifestArchive `json:"archives,omitempty"`
+}
+
+// manifestArchive is where the release archive in one format is published.
+type manifestArchive struct {
+	Format    string `json:"format"`
+	URL       string `json:"url"`
+	SHA256    string `json:"sha256"`
+	Integrity string `json:"integrity"`
+}
+
+func newManifestArchive(tag, format, shasum string) (manifestArchive, error) {
+	integrity, err := sriSHA256(shasum)
+	if err != nil {
+		return manifestArchive{}, err
+	}
+	return manifestArchive{
+		Format:    format,
+		URL:       releaseURL(tag, format),
+		SHA256:    shasum,
+		Integrity: integrity,
+	}, nil
+}
+
+// releaseURL returns the GitHub release url of the archive of tag in format.
+func releaseURL(tag, format string) string {
+	return fmt.Sprintf("https://github.com/uber/hermetic_cc_toolchain/releases/download/%[1]s/hermetic_cc_toolchain-%[1]s.%[2]s", tag, format)
+}
+
+func readReleaseManifest(repoRoot string) (*releaseManifest, error) {
+	fpath := path.Join(repoRoot, _releasesPath)
+	data, err := os.ReadFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+
+	var m releaseManifest
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&m); err != nil {
+		return nil, fmt.Errorf("parse %q: %w", fpath, err)
+	}
+
+	if m.Version != _releasesVersion && m.Version != _releasesVersionUnrecorded {
+		return nil, fmt.Errorf("%q: unsupported version %d, expected %d", fpath, m.Version, _releasesVersion)
+	}
+
+	seen := make(map[string]struct{}, len(m.Releases))
+	for i, r := range m.Releases {
+		if !_tagRegexp.MatchString(r.Tag) {
+			return nil, fmt.Errorf("%q: %q: %w", fpath, r.Tag, _errTag)
+		}
+		if _, ok := seen[r.Tag]; ok {
+			return nil, fmt.Errorf("%q: duplicate release %q", fpath, r.Tag)
+		}
+		seen[r.Tag] = struct{}{}
+		if r.Hash != hashReproducible && r.Hash != hashPinned {
+			return nil, fmt.Errorf("%q: %s: hash must be %q or %q, got %q",
+				fpath, r.Tag, hashReproducible, hashPinned, r.Hash)
+		}
+		if err := checkManifestArchives(r); err != nil {
+			return nil, fmt.Errorf("%q: %s: %w", fpath, r.Tag, err)
+		}
+		if m.Version == _releasesVersion {
+			if err := checkRecorded(r, i == len(m.Releases)-1); err != nil {
+				return nil, fmt.Errorf("%q: %s: %w", fpath, r.Tag, err)
+			}
+		}
+	}
+
+	return &m, nil
+}
+
+// writeReleaseManifest adds releases.json with the releases of m to files.
+func writeReleaseManifest(files *pendingFiles, m *releaseManifest) error {
+	data, err := json.MarshalIndent(m, "", "    ")
+	if err != nil {
+		return err
+	}
+	files.write(_releasesPath, append(data, '\n'))
+	return nil
+}
+
+// checkRecorded checks that r records what mirrors need to verify the
+// release. The commit of the last release is only known after its release
+// commit, so it is recorded by the next release (see recordCommits).
+func checkRecorded(r releaseEntry, last bool) error {
+	switch {
+	case r.SHA256 == "":
+		return errors.New("sha256 is not recorded")
+	case r.ZigVersion == "":
+		return errors.New("zig_version is not recorded")
+	case r.Commit == "" && !last:
+		return errors.New("commit is not recorded")
+	}
+	return nil
+}
+
+// checkManifestArchives checks that the archives of r are the ones the
+// releaser would record.
+func checkManifestArchives(r releaseEntry) error {
+	if len(r.Archives) == 0 {
+		return nil
+	}
+	seen := make(map[string]bool, len(r.Archives))
+	for _, a := range r.Archives {
+		if !isArchiveFormat(a.Format) {
+			return fmt.Errorf("unknown archive format %q", a.Format)
+		}
+		if seen[a.Format] {
+			return fmt.Errorf("duplicate %s archive", a.Format)
+		}
+		seen[a.Format] = true
+		want, err := newManifestArchive(r.Tag, a.Format, a.SHA256)
+		if err != nil {
+			return fmt.Errorf("%s archive: %w", a.Format, err)
+		}
+		if a != want {
+			return fmt.Errorf("%s archive: want url %q and integrity %q, got %q and %q",
+				a.Format, want.URL, want.Integrity, a.URL, a.Integrity)
+		}
+		if a.Format == _tgzFormat && a.SHA256 != r.SHA256 {
+			return fmt.Errorf("%s archive: sha256 %s differs from the sha256 of the release, %s",
+				a.Format, a.SHA256, r.SHA256)
+		}
+	}
+	if !seen[_tgzFormat] {
+		return fmt.Errorf("archives do not include %s", _tgzFormat)
+	}
+	return nil
+}
+
+// otherArchives returns the archives of r in formats other than tar.gz.
+func (r releaseEntry) otherArchives() []manifestArchive {
+	var ret []manifestArchive
+	for _, a := range r.Archives {
+		if a.Format != _tgzFormat {
+			ret = append(ret, a)
+		}
+	}
+	return ret
+}
+
+// compareArchiveFormats orders archives like _archiveFormats.
+func compareArchiveFormats(a, b manifestArchive) int {
+	formats := archiveFormatNames()
+	return slices.Index(formats, a.Format) - slices.Index(formats, b.Format)
+}
+
+func (m *releaseManifest) lookup(tag string) (releaseEntry, bool) {
+	for _, r := range m.Releases {
+		if r.Tag == tag {
+			return r, true
+		}
+	}
+	return releaseEntry{}, false
+}
+
+// recordCommits records the commit of every release of m that is tagged in
+// r. The commit of a release is only known once the release is committed,
+// so it is recorded by the next release.
+func (m *releaseManifest) recordCommits(r *gitRepo) error {
+	for _, e := range m.Releases {
+		if e.Commit != "" {
+			continue
+		}
+		tagged, err := r.hasTag(e.Tag)
+		if err != nil {
+			return err
+		}
+		if !tagged {
+			continue
+		}
+		commit, err := r.commitHash(e.Tag)
+		if err != nil {
+			return err
+		}
+		if err := m.record(releaseEntry{Tag: e.Tag, Commit: commit}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// record appends a release to the manifest. A release that is already
+// recorded may only gain fields and archive formats that were previously
+// unknown; changing a recorded value is an error, since the release is
+// already published.
+func (m *releaseManifest) record(e releaseEntry) error {
+	for i, r := range m.Releases {
+		if r.Tag != e.Tag {
+			continue
+		}
+
+		r.Archives = slices.Clone(r.Archives)
+		for _, a := range e.Archives {
+			j := slices.IndexFunc(r.Archives, func(have manifestArchive) bool {
+				return have.Format == a.Format
+			})
+			if j == -1 {
+				r.Archives = append(r.Archives, a)
+				continue
+			}
+			if r.Archives[j] != a {
+				return fmt.Errorf(
+					"%s is already released with %s sha256 %s, refusing to overwrite it with %s",
+					e.Tag, a.Format, r.Archives[j].SHA256, a.SHA256,
+				)
+			}
+		}
+		slices.SortStableFunc(r.Archives, compareArchiveFormats)
+
+		for _, f := range []struct {
+			name      string
+			have, new *string
+		}{
+			{"sha256", &r.SHA256, &e.SHA256},
+			{"zig_version", &r.ZigVersion, &e.ZigVersion},
+			{"commit", &r.Commit, &e.Commit},
+			{"hash", &r.Hash, &e.Hash},
+		} {
+			if *f.have == "" {
+				*f.have = *f.new
+				continue
+			}
+			if *f.new != "" && *f.have != *f.new {
+				return fmt.Errorf(
+					"%s is already released with %s %s, refusing to overwrite it with %s",
+					e.Tag, f.name, *f.have, *f.new,
+				)
+			}
+		}
+
+		m.Releases[i] = r
+		return nil
+	}
+
+	m.Releases = append(m.Releases, e)
+	return nil
+}
@@ -0,0 +1,196 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+package main
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReleaseManifestRoundtrip(t *testing.T) {
+	repoRoot := t.TempDir()
+	require.NoError(t, os.MkdirAll(path.Join(repoRoot, path.Dir(_releasesPath)), 0755))
+
+	m := &releaseManifest{Version: _releasesVersion}
+	require.NoError(t, m.record(releaseEntry{Tag: "v1.0.0", SHA256: "aa", ZigVersion: "0.15.2", Hash: hashPinned}))
+	files := newPendingFiles(repoRoot)
+	require.NoError(t, writeReleaseManifest(files, m))
+	require.NoError(t, files.flush())
+
+	got, err := readReleaseManifest(repoRoot)
+	require.NoError(t, err)
+	assert.Equal(t, m, got)
+}
+
+func TestReadReleaseManifestErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		wantErr  string
+	}{
+		{
+			name:     "unknown version",
+			contents: `{"version": 3, "releases": []}`,
+			wantErr:  "unsupported version 3",
+		},
+		{
+			name:     "no sha256",
+			contents: `{"version": 2, "releases": [{"tag": "v1.0.0", "sha256": "", "zig_version": "0.15.2", "hash": "pinned"}]}`,
+			wantErr:  "v1.0.0: sha256 is not recorded",
+		},
+		{
+			name:     "no zig version",
+			contents: `{"version": 2, "releases": [{"tag": "v1.0.0", "sha256": "aa", "hash": "pinned"}]}`,
+			wantErr:  "v1.0.0: zig_version is not recorded",
+		},
+		{
+			name: "no commit",
+			contents: `{"version": 2, "releases": [
+				{"tag": "v1.0.0", "sha256": "aa", "zig_version": "0.15.2", "hash": "pinned"},
+				{"tag": "v1.1.0", "sha256": "bb", "zig_version": "0.15.2", "hash": "pinned"}
+			]}`,
+			wantErr: "v1.0.0: commit is not recorded",
+		},
+		{
+			name:     "bad tag",
+			contents: `{"version": 1, "releases": [{"tag": "1.0.0", "sha256": "aa", "hash": "pinned"}]}`,
+			wantErr:  "tag accepts the following formats",
+		},
+		{
+			name: "duplicate",
+			contents: `{"version": 1, "releases": [
+				{"tag": "v1.0.0", "sha256": "aa", "hash": "pinned"},
+				{"tag": "v1.0.0", "sha256": "aa", "hash": "pinned"}
+			]}`,
+			wantErr: `duplicate release "v1.0.0"`,
+		},
+		{
+			name:     "bad hash status",
+			contents: `{"version": 1, "releases": [{"tag": "v1.0.0", "sha256": "aa", "hash": "maybe"}]}`,
+			wantErr:  `hash must be "reproducible" or "pinned"`,
+		},
+		{
+			name: "unknown archive format",
+			contents: `{"version": 1, "releases": [{"tag": "v1.0.0", "sha256": "aa", "hash": "pinned", "archives": [
+				{"format": "rar", "url": "", "sha256": "aa", "integrity": ""}
+			]}]}`,
+			wantErr: `v1.0.0: unknown archive format "rar"`,
+		},
+		{
+			name: "archive of another url",
+			contents: `{"version": 1, "releases": [{"tag": "v1.0.0", "sha256": "aa", "hash": "pinned", "archives": [
+				{"format": "tar.gz", "url": "https://example.com/v1.0.0.tar.gz", "sha256": "aa", "integrity": "sha256-qg=="}
+			]}]}`,
+			wantErr: `v1.0.0: tar.gz archive: want url "https://github.com/uber/hermetic_cc_toolchain/releases/download/v1.0.0/hermetic_cc_toolchain-v1.0.0.tar.gz"`,
+		},
+		{
+			name: "tarball of another sha256",
+			contents: `{"version": 1, "releases": [{"tag": "v1.0.0", "sha256": "aa", "hash": "pinned", "archives": [
+				{"format": "tar.gz", "url": "https://github.com/uber/hermetic_cc_toolchain/releases/download/v1.0.0/hermetic_cc_toolchain-v1.0.0.tar.gz", "sha256": "bb", "integrity": "sha256-uw=="}
+			]}]}`,
+			wantErr: "v1.0.0: tar.gz archive: sha256 bb differs from the sha256 of the release, aa",
+		},
+		{
+			name: "no tarball",
+			contents: `{"version": 1, "releases": [{"tag": "v1.0.0", "sha256": "aa", "hash": "pinned", "archives": [
+				{"format": "zip", "url": "https://github.com/uber/hermetic_cc_toolchain/releases/download/v1.0.0/hermetic_cc_toolchain-v1.0.0.zip", "sha256": "bb", "integrity": "sha256-uw=="}
+			]}]}`,
+			wantErr: "v1.0.0: archives do not include tar.gz",
+		},
+		{
+			name:     "unknown field",
+			contents: `{"version": 1, "releases": [], "extra": true}`,
+			wantErr:  `unknown field "extra"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repoRoot := t.TempDir()
+			fpath := path.Join(repoRoot, _releasesPath)
+			require.NoError(t, os.MkdirAll(path.Dir(fpath), 0755))
+			require.NoError(t, os.WriteFile(fpath, []byte(tt.contents), 0644))
+
+			_, err := readReleaseManifest(repoRoot)
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestReleaseManifestRecord(t *testing.T) {
+	m := &releaseManifest{Version: _releasesVersion}
+	require.NoError(t, m.record(releaseEntry{Tag: "v1.0.0", SHA256: "aa", Hash: hashReproducible}))
+
+	// filling in unknown fields is fine
+	require.NoError(t, m.record(releaseEntry{
+		Tag:        "v1.0.0",
+		SHA256:     "aa",
+		ZigVersion: "0.11.0",
+		Commit:     "cafe",
+		Hash:       hashReproducible,
+	}))
+
+	// changing a published hash is not
+	assert.EqualError(t,
+		m.record(releaseEntry{Tag: "v1.0.0", SHA256: "bb", Hash: hashReproducible}),
+		"v1.0.0 is already released with sha256 aa, refusing to overwrite it with bb",
+	)
+
+	require.NoError(t, m.record(releaseEntry{Tag: "v1.0.1", SHA256: "cc", Hash: hashReproducible}))
+
+	assert.Equal(t, []releaseEntry{
+		{Tag: "v1.0.0", SHA256: "aa", ZigVersion: "0.11.0", Commit: "cafe", Hash: hashReproducible},
+		{Tag: "v1.0.1", SHA256: "cc", Hash: hashReproducible},
+	}, m.Releases)
+}
+
+func TestReleaseManifestRecordArchives(t *testing.T) {
+	archive := func(format, shasum string) manifestArchive {
+		a, err := newManifestArchive("v1.0.0", format, shasum)
+		require.NoError(t, err)
+		return a
+	}
+	m := &releaseManifest{Version: _releasesVersion}
+	require.NoError(t, m.record(releaseEntry{
+		Tag:      "v1.0.0",
+		SHA256:   "aa",
+		Hash:     hashReproducible,
+		Archives: []manifestArchive{archive(_tgzFormat, "aa"), archive("zip", "bb")},
+	}))
+
+	// formats may be added, and are kept in the order of -formats
+	require.NoError(t, m.record(releaseEntry{
+		Tag:      "v1.0.0",
+		SHA256:   "aa",
+		Archives: []manifestArchive{archive(_tgzFormat, "aa"), archive("tar.zst", "cc")},
+	}))
+	got, ok := m.lookup("v1.0.0")
+	require.True(t, ok)
+	assert.Equal(t, []manifestArchive{
+		archive(_tgzFormat, "aa"),
+		archive("tar.zst", "cc"),
+		archive("zip", "bb"),
+	}, got.Archives)
+
+	// but a published archive may not change
+	assert.EqualError(t,
+		m.record(releaseEntry{Tag: "v1.0.0", Archives: []manifestArchive{archive("zip", "dd")}}),
+		"v1.0.0 is already released with zip sha256 bb, refusing to overwrite it with dd",
+	)
+	got, _ = m.lookup("v1.0.0")
+	assert.Len(t, got.Archives, 3)
+}
+
+// TestReleasesJSON makes sure the checked-in manifest is readable.
+func TestReleasesJSON(t *testing.T) {
+	m, err := readReleaseManifest(path.Join("..", ".."))
+	require.NoError(t, err)
+
+	r, ok := m.lookup("v3.0.0")
+	require.True(t, ok)
+	assert.Equal(t, hashPinned, r.Hash)
+}
@@ -0,0 +1,99 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/uber/hermetic_cc_toolchain/tools/internal/zigsdk"
+)
+
+// checkZigMirrored checks that the Zig SDK of every host platform can be
+// downloaded from every URL format that toolchain/defs.bzl would use. With
+// deep, the archives are downloaded and their sha256 verified.
+func checkZigMirrored(client *http.Client, repoRoot string, deep bool) (mirrorCheck, error) {
+	var ret mirrorCheck
+
+	upstream, err := zigsdk.ParseUpstream(path.Join(repoRoot, zigsdk.ZigSDKPath))
+	if err != nil {
+		return ret, err
+	}
+
+	platforms, err := zigsdk.ParseHostPlatforms(
+		path.Join(repoRoot, zigsdk.ZigSDKPath),
+		path.Join(repoRoot, zigsdk.DefsPath),
+	)
+	if err != nil {
+		return ret, err
+	}
+
+	for _, format := range upstream.URLFormats() {
+		// Nightly releases are purged from ziglang.org after ~90 days, so
+		// only the mirror is required to have them.
+		required := !(upstream.IsDev() && strings.HasPrefix(format, zigsdk.ZigDownloads))
+		for _, platform := range platforms.Names() {
+			url := zigsdk.URL(format, upstream.Version, platform, platforms.Ext[platform])
+			log("checking if zig is mirrored in %q", url)
+
+			var err error
+			if deep {
+				err = checkZigArchive(client, url, platforms.SHA256[platform])
+			} else {
+				err = checkZigURL(client, url)
+			}
+			if err == nil {
+				ret.URLs = append(ret.URLs, url)
+				continue
+			}
+
+			if required {
+				return ret, fmt.Errorf("%s: %w", url, err)
+			}
+			log("ignoring %q: %s", url, err)
+			ret.Missing = append(ret.Missing, url)
+		}
+	}
+
+	ret.Deep = deep
+	return ret, nil
+}
+
+func checkZigURL(client *http.Client, url string) error {
+	resp, err := client.Head(url)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("got non-200: %s", resp.Status)
+	}
+	return nil
+}
+
+func checkZigArchive(client *http.Client, url, wantSHA256 string) error {
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("got non-200: %s", resp.Status)
+	}
+
+	hashw := sha256.New()
+	if _, err := io.Copy(hashw, resp.Body); err != nil {
+		return fmt.Errorf("download: %w", err)
+	}
+	if got := fmt.Sprintf("%x", hashw.Sum(nil)); got != wantSHA256 {
+		return fmt.Errorf("sha256 mismatch: expected %s, got %s", wantSHA256, got)
+	}
+	return nil
+}
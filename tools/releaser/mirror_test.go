@@ -0,0 +1,119 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/hermetic_cc_toolchain/tools/internal/zigsdk"
+)
+
+// fakeZigMirror serves the given files, keyed by URL path.
+func fakeZigMirror(t *testing.T, files map[string]string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// writeZigSDK writes zig_sdk.bzl and defs.bzl with two host platforms whose
+// archives contain the platform name.
+func writeZigSDK(t *testing.T, repoRoot, urlFormat string) {
+	t.Helper()
+	sum := func(s string) string { return fmt.Sprintf("%x", sha256.Sum256([]byte(s))) }
+	for fpath, contents := range map[string]string{
+		zigsdk.ZigSDKPath: fmt.Sprintf(`VERSION = "0.15.2"
+
+HOST_PLATFORM_SHA256 = {
+    "linux-x86_64": "%s",
+    "macos-aarch64": "%s",
+}
+
+URL_FORMAT_RELEASE = "%s"
+`, sum("linux-x86_64"), sum("macos-aarch64"), urlFormat),
+		zigsdk.DefsPath: `_HOST_PLATFORM_EXT = {
+    "linux-x86_64": "tar.xz",
+    "macos-aarch64": "tar.xz",
+}
+`,
+	} {
+		fpath = path.Join(repoRoot, fpath)
+		require.NoError(t, os.MkdirAll(path.Dir(fpath), 0755))
+		require.NoError(t, os.WriteFile(fpath, []byte(contents), 0644))
+	}
+}
+
+func TestCheckZigMirrored(t *testing.T) {
+	const (
+		linux = "/download/0.15.2/zig-x86_64-linux-0.15.2.tar.xz"
+		macos = "/download/0.15.2/zig-aarch64-macos-0.15.2.tar.xz"
+	)
+
+	tests := []struct {
+		name    string
+		files   map[string]string
+		deep    bool
+		wantErr string
+	}{
+		{
+			name:  "all mirrored",
+			files: map[string]string{linux: "linux-x86_64", macos: "macos-aarch64"},
+		},
+		{
+			name:  "all mirrored, deep",
+			files: map[string]string{linux: "linux-x86_64", macos: "macos-aarch64"},
+			deep:  true,
+		},
+		{
+			name:    "macos aarch64 missing",
+			files:   map[string]string{linux: "linux-x86_64"},
+			wantErr: macos + ": got non-200: 404 Not Found",
+		},
+		{
+			name:    "bad checksum, deep",
+			files:   map[string]string{linux: "linux-x86_64", macos: "corrupted"},
+			deep:    true,
+			wantErr: macos + ": sha256 mismatch",
+		},
+		{
+			// without -deep, the contents are not checked.
+			name:  "bad checksum",
+			files: map[string]string{linux: "linux-x86_64", macos: "corrupted"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := fakeZigMirror(t, tt.files)
+			repoRoot := t.TempDir()
+			writeZigSDK(t, repoRoot, srv.URL+"/download/{version}/zig-{zig_platform}-{version}.{_ext}")
+
+			got, err := checkZigMirrored(srv.Client(), repoRoot, tt.deep)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, mirrorCheck{
+				URLs: []string{srv.URL + linux, srv.URL + macos},
+				Deep: tt.deep,
+			}, got)
+		})
+	}
+}
@@ -0,0 +1,299 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	bzl "github.com/bazelbuild/buildtools/build"
+)
+
+// _repoRefRegexp matches labels of other repositories by their apparent
+// name, e.g. "@platforms//os:linux". Canonical names (@@) are not matched.
+var _repoRefRegexp = regexp.MustCompile(`^@([A-Za-z0-9._-]+)//`)
+
+// _builtinRepos are visible to every module without a bazel_dep.
+var _builtinRepos = map[string]struct{}{
+	"bazel_tools": {},
+}
+
+// moduleFile is what lintModule needs of a MODULE.bazel.
+type moduleFile struct {
+	name               string
+	version            string
+	compatibilityLevel int
+	// repos are the repositories visible to the module by their apparent
+	// name: the module itself, its bazel_deps and the use_repo of its
+	// module extensions. The value is whether the repository is only
+	// visible with dev_dependency = True.
+	repos map[string]bool
+}
+
+func parseModuleFile(fpath string, data []byte) (moduleFile, error) {
+	ret := moduleFile{repos: make(map[string]bool)}
+	f, err := bzl.ParseModule(fpath, data)
+	if err != nil {
+		return ret, err
+	}
+
+	modules := f.Rules("module")
+	if len(modules) != 1 {
+		return ret, fmt.Errorf("%q: expected one module(), got %d", fpath, len(modules))
+	}
+	module := modules[0]
+	ret.name = module.AttrString("name")
+	ret.version = module.AttrString("version")
+	if level := module.Attr("compatibility_level"); level != nil {
+		lit, ok := level.(*bzl.LiteralExpr)
+		if !ok {
+			return ret, fmt.Errorf("%q: compatibility_level is not an integer", fpath)
+		}
+		ret.compatibilityLevel, err = strconv.Atoi(lit.Token)
+		if err != nil {
+			return ret, fmt.Errorf("%q: compatibility_level: %w", fpath, err)
+		}
+	}
+	ret.repos[ret.name] = false
+	if repoName := module.AttrString("repo_name"); repoName != "" {
+		ret.repos[repoName] = false
+	}
+
+	for _, dep := range f.Rules("bazel_dep") {
+		name := dep.AttrString("repo_name")
+		if name == "" {
+			name = dep.AttrString("name")
+		}
+		ret.addRepo(name, isTrue(dep.Attr("dev_dependency")))
+	}
+
+	// use_extension() results, by variable name.
+	extDev := make(map[string]bool)
+	for _, stmt := range f.Stmt {
+		assign, ok := stmt.(*bzl.AssignExpr)
+		if !ok {
+			continue
+		}
+		lhs, ok := assign.LHS.(*bzl.Ident)
+		if !ok {
+			continue
+		}
+		call, ok := assign.RHS.(*bzl.CallExpr)
+		if !ok || callName(call) != "use_extension" {
+			continue
+		}
+		extDev[lhs.Name] = isTrue(kwarg(call, "dev_dependency"))
+	}
+	for _, use := range f.Rules("use_repo") {
+		if len(use.Call.List) == 0 {
+			continue
+		}
+		ext, ok := use.Call.List[0].(*bzl.Ident)
+		if !ok {
+			return ret, fmt.Errorf("%q: use_repo() of something other than a use_extension() variable", fpath)
+		}
+		dev, ok := extDev[ext.Name]
+		if !ok {
+			return ret, fmt.Errorf("%q: use_repo(%s) of an unknown module extension", fpath, ext.Name)
+		}
+		for _, arg := range use.Call.List[1:] {
+			switch arg := arg.(type) {
+			case *bzl.StringExpr:
+				ret.addRepo(arg.Value, dev)
+			case *bzl.AssignExpr:
+				// name = "repo in the extension"
+				if lhs, ok := arg.LHS.(*bzl.Ident); ok {
+					ret.addRepo(lhs.Name, dev)
+				}
+			}
+		}
+	}
+
+	return ret, nil
+}
+
+// addRepo makes name visible. A repository that is visible both with and
+// without dev_dependency is not a dev dependency.
+func (m *moduleFile) addRepo(name string, dev bool) {
+	if prevDev, ok := m.repos[name]; ok && !prevDev {
+		return
+	}
+	m.repos[name] = dev
+}
+
+// lintModule checks the MODULE.bazel of a release tarball before it is
+// tagged, for what the Bazel Central Registry presubmit would reject:
+//
+//   - the compatibility_level is bumped with the major version, compared
+//     to prevModule of prevTag (if any);
+//   - the repositories that the shipped files load from or refer to by
+//     label are bazel_deps, and not dev_dependency ones.
+//
+// Build file templates of other repositories are not checked, because
+// their labels are resolved in those repositories.
+func lintModule(tgz io.Reader, tag, prevTag string, prevModule []byte) error {
+	_, sources, err := readTgzSources(tgz)
+	if err != nil {
+		return err
+	}
+	data, ok := sources["MODULE.bazel"]
+	if !ok {
+		return fmt.Errorf("the release tarball has no MODULE.bazel")
+	}
+	module, err := parseModuleFile("MODULE.bazel", data)
+	if err != nil {
+		return err
+	}
+
+	var problems []string
+	if prevTag != "" && prevModule != nil {
+		prev, err := parseModuleFile(prevTag+":MODULE.bazel", prevModule)
+		if err != nil {
+			return err
+		}
+		if tagMajor(tag) != tagMajor(prevTag) && module.compatibilityLevel <= prev.compatibilityLevel {
+			problems = append(problems, fmt.Sprintf(
+				"MODULE.bazel: the major version changes from %s to %s, but compatibility_level is %d, like in %s",
+				prevTag, tag, module.compatibilityLevel, prevTag,
+			))
+		}
+	}
+
+	names := make([]string, 0, len(sources))
+	for name := range sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if name == "MODULE.bazel" || name == "WORKSPACE" || starlarkKind(name) != "own" {
+			continue
+		}
+		refs, err := repoRefs(name, sources[name])
+		if err != nil {
+			return err
+		}
+		for _, ref := range refs {
+			if _, ok := _builtinRepos[ref.repo]; ok {
+				continue
+			}
+			dev, ok := module.repos[ref.repo]
+			switch {
+			case !ok:
+				problems = append(problems, fmt.Sprintf("%s: @%s is not a bazel_dep of MODULE.bazel", ref.where, ref.repo))
+			case dev:
+				problems = append(problems, fmt.Sprintf("%s: @%s is a dev_dependency of MODULE.bazel", ref.where, ref.repo))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf(
+			"MODULE.bazel of the release tarball has %d problem(s):\n---\n%s\n---\n",
+			len(problems),
+			strings.Join(problems, "\n"),
+		)
+	}
+	return nil
+}
+
+// checkModule is lintModule of the release tarball tgz of tag, cut from
+// ref, against the previous tag that ref has.
+func checkModule(r *gitRepo, repoRoot string, tgz io.Reader, tag, ref string) error {
+	prevTag, err := previousTag(repoRoot, tag, ref)
+	if err != nil {
+		return err
+	}
+	var prevModule []byte
+	if prevTag != "" {
+		prevModule, err = r.readFile(prevTag, "MODULE.bazel")
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return lintModule(tgz, tag, prevTag, prevModule)
+}
+
+type repoRef struct {
+	repo  string
+	where string
+}
+
+// repoRefs returns the repositories that file name refers to in the
+// module's repository mapping: in load()s and Label()s, and, for BUILD
+// files, in any label.
+func repoRefs(name string, data []byte) ([]repoRef, error) {
+	parsed, err := bzl.Parse(name, data)
+	if err != nil {
+		return nil, fmt.Errorf("parse %q from the release tarball: %w", name, err)
+	}
+	base := path.Base(name)
+	isBuild := base == "BUILD" || base == "BUILD.bazel"
+
+	var ret []repoRef
+	add := func(str *bzl.StringExpr) {
+		m := _repoRefRegexp.FindStringSubmatch(str.Value)
+		if m == nil {
+			return
+		}
+		line, _ := str.Span()
+		ret = append(ret, repoRef{
+			repo:  m[1],
+			where: fmt.Sprintf("%s:%d: %q", name, line.Line, str.Value),
+		})
+	}
+
+	for _, load := range loads(parsed) {
+		add(load.Module)
+	}
+	bzl.Walk(parsed, func(expr bzl.Expr, stack []bzl.Expr) {
+		str, ok := expr.(*bzl.StringExpr)
+		if !ok || isLoadModule(stack, str) {
+			return
+		}
+		if isBuild || isLabelArg(stack) {
+			add(str)
+		}
+	})
+	return ret, nil
+}
+
+func tagMajor(tag string) string {
+	m := _tagRegexp.FindStringSubmatch(tag)
+	if m == nil {
+		return ""
+	}
+	return m[1]
+}
+
+func callName(call *bzl.CallExpr) string {
+	if fn, ok := call.X.(*bzl.Ident); ok {
+		return fn.Name
+	}
+	return ""
+}
+
+func kwarg(call *bzl.CallExpr, name string) bzl.Expr {
+	for _, arg := range call.List {
+		assign, ok := arg.(*bzl.AssignExpr)
+		if !ok {
+			continue
+		}
+		if lhs, ok := assign.LHS.(*bzl.Ident); ok && lhs.Name == name {
+			return assign.RHS
+		}
+	}
+	return nil
+}
+
+func isTrue(expr bzl.Expr) bool {
+	ident, ok := expr.(*bzl.Ident)
+	return ok && ident.Name == "True"
+}
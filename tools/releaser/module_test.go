@@ -0,0 +1,253 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const _testModule = `module(
+    name = "hermetic_cc_toolchain",
+    version = "1.0.0",
+    compatibility_level = 1,
+)
+
+bazel_dep(name = "platforms", version = "0.0.10")
+bazel_dep(name = "rules_cc", version = "0.2.14", repo_name = "my_rules_cc")
+bazel_dep(name = "rules_go", version = "0.54.0", dev_dependency = True)
+
+go_sdk = use_extension("@rules_go//go:extensions.bzl", "go_sdk", dev_dependency = True)
+use_repo(go_sdk, "go_default_sdk")
+
+toolchains = use_extension("//toolchain:ext.bzl", "toolchains")
+use_repo(toolchains, "zig_sdk", sdk = "zig_sdk_0_15")
+`
+
+func TestParseModuleFile(t *testing.T) {
+	got, err := parseModuleFile("MODULE.bazel", []byte(_testModule))
+	require.NoError(t, err)
+	assert.Equal(t, moduleFile{
+		name:               "hermetic_cc_toolchain",
+		version:            "1.0.0",
+		compatibilityLevel: 1,
+		repos: map[string]bool{
+			"hermetic_cc_toolchain": false,
+			"platforms":             false,
+			"my_rules_cc":           false,
+			"rules_go":              true,
+			"go_default_sdk":        true,
+			"zig_sdk":               false,
+			"sdk":                   false,
+		},
+	}, got)
+
+	tests := []struct {
+		name     string
+		contents string
+		wantErr  string
+	}{
+		{
+			name:     "no module",
+			contents: `bazel_dep(name = "platforms", version = "0.0.10")`,
+			wantErr:  "expected one module(), got 0",
+		},
+		{
+			name:     "compatibility_level",
+			contents: `module(name = "m", compatibility_level = "1")`,
+			wantErr:  "compatibility_level is not an integer",
+		},
+		{
+			name:     "unknown extension",
+			contents: "module(name = \"m\")\nuse_repo(other, \"x\")",
+			wantErr:  "use_repo(other) of an unknown module extension",
+		},
+		{
+			name:     "unparsable",
+			contents: "module(",
+			wantErr:  "MODULE.bazel",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseModuleFile("MODULE.bazel", []byte(tt.contents))
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestLintModule(t *testing.T) {
+	base := map[string]string{
+		"MODULE.bazel": _testModule,
+		"toolchain/BUILD": `load("@my_rules_cc//cc:defs.bzl", "cc_library")
+cc_library(name = "lib", target_compatible_with = ["@platforms//os:linux"])`,
+		"toolchain/defs.bzl": `load("@bazel_tools//tools/build_defs/repo:http.bzl", "http_archive")
+
+_TOOLCHAIN = Label("@zig_sdk//:toolchain")
+# Resolved by the user of the module, not in its repository mapping.
+_REGISTER = "@zig_sdk_of_the_user//toolchain/..."
+`,
+		// Labels of a foreign build file resolve in its own repository.
+		"toolchain/BUILD.sdk.bazel": `alias(name = "go", actual = "@rules_go//go")`,
+	}
+	with := func(changes map[string]string) map[string]string {
+		ret := make(map[string]string, len(base))
+		for k, v := range base {
+			ret[k] = v
+		}
+		for k, v := range changes {
+			ret[k] = v
+		}
+		return ret
+	}
+	prevModule := []byte(`module(name = "hermetic_cc_toolchain", version = "0.9.0")`)
+
+	tests := []struct {
+		name    string
+		files   map[string]string
+		tag     string
+		prevTag string
+		wantErr []string
+	}{
+		{
+			name:    "ok",
+			files:   base,
+			prevTag: "v0.9.0",
+		},
+		{
+			name:  "first release",
+			files: base,
+		},
+		{
+			name: "same major",
+			files: with(map[string]string{
+				"MODULE.bazel":       `module(name = "hermetic_cc_toolchain", version = "0.10.0")`,
+				"toolchain/BUILD":    "",
+				"toolchain/defs.bzl": "",
+			}),
+			tag:     "v0.10.0",
+			prevTag: "v0.9.0",
+		},
+		{
+			name: "compatibility_level not bumped",
+			files: with(map[string]string{
+				"MODULE.bazel":       `module(name = "hermetic_cc_toolchain", version = "1.0.0")`,
+				"toolchain/BUILD":    "",
+				"toolchain/defs.bzl": "",
+			}),
+			prevTag: "v0.9.0",
+			wantErr: []string{
+				"1 problem(s)",
+				"MODULE.bazel: the major version changes from v0.9.0 to v1.0.0, but compatibility_level is 0, like in v0.9.0",
+			},
+		},
+		{
+			name: "missing bazel_dep",
+			files: with(map[string]string{
+				"toolchain/BUILD": `load("@rules_cc//cc:defs.bzl", "cc_library")`,
+			}),
+			wantErr: []string{`toolchain/BUILD:1: "@rules_cc//cc:defs.bzl": @rules_cc is not a bazel_dep of MODULE.bazel`},
+		},
+		{
+			name: "dev dependency",
+			files: with(map[string]string{
+				"toolchain/private/defs.bzl": `load("@rules_go//go:def.bzl", "go_binary")
+
+_SDK = Label("@go_default_sdk//:bin/go")`,
+			}),
+			wantErr: []string{
+				"2 problem(s)",
+				`toolchain/private/defs.bzl:1: "@rules_go//go:def.bzl": @rules_go is a dev_dependency of MODULE.bazel`,
+				`toolchain/private/defs.bzl:3: "@go_default_sdk//:bin/go": @go_default_sdk is a dev_dependency of MODULE.bazel`,
+			},
+		},
+		{
+			name: "no MODULE.bazel",
+			files: map[string]string{
+				"toolchain/BUILD": "",
+			},
+			wantErr: []string{"the release tarball has no MODULE.bazel"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var prev []byte
+			if tt.prevTag != "" {
+				prev = prevModule
+			}
+			tag := tt.tag
+			if tag == "" {
+				tag = "v1.0.0"
+			}
+			err := lintModule(testTgz(t, tt.files), tag, tt.prevTag, prev)
+			if len(tt.wantErr) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			for _, want := range tt.wantErr {
+				assert.ErrorContains(t, err, want)
+			}
+		})
+	}
+}
+
+func TestLintModuleRelease(t *testing.T) {
+	if _, err := openRepo("../.."); err != nil {
+		t.Skip("not in a git checkout (e.g. in the bazel sandbox)")
+	}
+
+	files := newPendingFiles("../..")
+	require.NoError(t, updateModuleVersion(files, "v99.0.0"))
+
+	var tgz bytes.Buffer
+	_, err := makeTgz(&tgz, "../..", "HEAD", files.contents)
+	require.NoError(t, err)
+	assert.NoError(t, lintModule(&tgz, "v99.0.0", "", nil))
+}
+
+// TestUpdateModuleBoilerplateRegisterToolchains makes sure the toolchains
+// that a bzlmod example file registers after the marked region are kept.
+func TestUpdateModuleBoilerplateRegisterToolchains(t *testing.T) {
+	const registered = `
+register_toolchains(
+    "@zig_sdk//libc_aware/toolchain:linux_amd64_gnu.2.31",
+    "@zig_sdk//toolchain:windows_amd64",
+)
+`
+	module := `module(name = "example")
+
+bazel_dep(name = "platforms", version = "0.0.10")
+` + genModuleRegion("v1.0.0") + registered
+
+	repoRoot := t.TempDir()
+	for _, f := range _moduleBoilerplateFiles {
+		fpath := path.Join(repoRoot, f)
+		require.NoError(t, os.MkdirAll(path.Dir(fpath), 0755))
+		require.NoError(t, os.WriteFile(fpath, []byte(module), 0644))
+	}
+	files := newPendingFiles(repoRoot)
+	require.NoError(t, updateModuleBoilerplate(files, "v2.0.0"))
+
+	fpath := _moduleBoilerplateFiles[1]
+	got, err := files.read(fpath)
+	require.NoError(t, err)
+	assert.Equal(t, `module(name = "example")
+
+bazel_dep(name = "platforms", version = "0.0.10")
+`+genModuleRegion("v2.0.0")+registered, string(got))
+	m, err := parseModuleFile(fpath, got)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{
+		"example":               false,
+		"platforms":             false,
+		"hermetic_cc_toolchain": false,
+		"zig_sdk":               false,
+	}, m.repos)
+}
@@ -0,0 +1,87 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+package main
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// releaseOutput describes the release artifacts, so automation (e.g. release
+// uploads or registry submissions) does not need to parse the log (-output).
+type releaseOutput struct {
+	Tag string `json:"tag"`
+	// DryRun is set if nothing was written, committed or tagged.
+	DryRun bool `json:"dry_run"`
+	// Commit is the release commit, which releases.json only records with
+	// the next release. It is empty with -dry-run and for releases with a
+	// pinned hash.
+	Commit string `json:"commit,omitempty"`
+	// Tarball is empty for releases with a pinned hash, which are not
+	// rebuilt.
+	Tarball    string `json:"tarball,omitempty"`
+	Provenance string `json:"provenance,omitempty"`
+	// ReleaseNotes is the markdown body of the release.
+	ReleaseNotes string `json:"release_notes,omitempty"`
+	// Signatures are only written with -sign-key.
+	Signatures []string `json:"signatures,omitempty"`
+	// Archives are the release archive in every format of -formats. They
+	// are empty for releases with a pinned hash.
+	Archives []releaseArchive `json:"archives,omitempty"`
+	// SHA256 and Integrity are of the tar.gz tarball.
+	SHA256      string      `json:"sha256"`
+	Integrity   string      `json:"integrity"`
+	ZigVersion  string      `json:"zig_version,omitempty"`
+	MirrorCheck mirrorCheck `json:"mirror_check"`
+	// FilesModified are relative to the repository root.
+	FilesModified []string `json:"files_modified"`
+	Boilerplate   struct {
+		Workspace string `json:"workspace"`
+		Module    string `json:"module"`
+	} `json:"boilerplate"`
+	// PromotedFrom is set for releases made with -promote.
+	PromotedFrom *promotion `json:"promoted_from,omitempty"`
+	// BCR is the registry the release entry was written to, if any.
+	BCR string `json:"bcr,omitempty"`
+}
+
+// mirrorCheck is the result of checkZigMirrored.
+type mirrorCheck struct {
+	// URLs that were found to be mirrored.
+	URLs []string `json:"urls"`
+	// Missing are optional URLs that could not be downloaded.
+	Missing []string `json:"missing,omitempty"`
+	// Deep is set if the archives were downloaded and their sha256 verified.
+	Deep bool `json:"deep"`
+}
+
+func (o *releaseOutput) setHash(shasum string) error {
+	integrity, err := sriSHA256(shasum)
+	if err != nil {
+		return err
+	}
+	o.SHA256 = shasum
+	o.Integrity = integrity
+	return nil
+}
+
+func (o *releaseOutput) setFiles(files *pendingFiles) error {
+	changed, err := files.changed()
+	if err != nil {
+		return err
+	}
+	o.FilesModified = append([]string{}, changed...)
+	return nil
+}
+
+// writeOutput prints the release summary to w. The text format is the log
+// that is already printed, so there is nothing to add.
+func writeOutput(w io.Writer, format string, o releaseOutput) error {
+	if format != "json" {
+		return nil
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "    ")
+	return enc.Encode(o)
+}
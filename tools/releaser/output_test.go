@@ -0,0 +1,60 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+package main
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteOutput(t *testing.T) {
+	repoRoot := t.TempDir()
+	require.NoError(t, os.WriteFile(path.Join(repoRoot, "README.md"), []byte("old\n"), 0644))
+	files := newPendingFiles(repoRoot)
+	files.write("README.md", []byte("new\n"))
+
+	out := releaseOutput{
+		Tag:         "v4.3.0",
+		Tarball:     "/src/hermetic_cc_toolchain-v4.3.0.tar.gz",
+		ZigVersion:  "0.15.2",
+		MirrorCheck: mirrorCheck{URLs: []string{"https://ziglang.org/download/0.15.2/zig-x86_64-linux-0.15.2.tar.xz"}},
+	}
+	require.NoError(t, out.setHash(_testSHA256))
+	require.NoError(t, out.setFiles(files))
+	out.Boilerplate.Workspace = "zig_toolchains()\n"
+	out.Boilerplate.Module = "register_toolchains()\n"
+
+	var text bytes.Buffer
+	require.NoError(t, writeOutput(&text, "text", out))
+	assert.Empty(t, text.String())
+
+	var got bytes.Buffer
+	require.NoError(t, writeOutput(&got, "json", out))
+	assert.Equal(t, `{
+    "tag": "v4.3.0",
+    "dry_run": false,
+    "tarball": "/src/hermetic_cc_toolchain-v4.3.0.tar.gz",
+    "sha256": "79338d8c5c4499c7402aea1fe78dcd20267f300e9f8f5886be7017d57ccf0fbc",
+    "integrity": "sha256-eTONjFxEmcdAKuof543NICZ/MA6fj1iGvnAX1XzPD7w=",
+    "zig_version": "0.15.2",
+    "mirror_check": {
+        "urls": [
+            "https://ziglang.org/download/0.15.2/zig-x86_64-linux-0.15.2.tar.xz"
+        ],
+        "deep": false
+    },
+    "files_modified": [
+        "README.md"
+    ],
+    "boilerplate": {
+        "workspace": "zig_toolchains()\n",
+        "module": "register_toolchains()\n"
+    }
+}
+`, got.String())
+}
@@ -0,0 +1,106 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// pendingFiles are changes to the working tree that the releaser wants to
+// make. They are kept in memory until flush, so they can be shown instead
+// of written (-dry-run).
+type pendingFiles struct {
+	repoRoot string
+	paths    []string          // in order of the first write
+	contents map[string][]byte // keyed by path relative to repoRoot
+}
+
+func newPendingFiles(repoRoot string) *pendingFiles {
+	return &pendingFiles{
+		repoRoot: repoRoot,
+		contents: make(map[string][]byte),
+	}
+}
+
+// read returns the pending contents of fpath, or what is in the working tree
+// if fpath was not written.
+func (p *pendingFiles) read(fpath string) ([]byte, error) {
+	if data, ok := p.contents[fpath]; ok {
+		return data, nil
+	}
+	return os.ReadFile(path.Join(p.repoRoot, fpath))
+}
+
+func (p *pendingFiles) write(fpath string, data []byte) {
+	if _, ok := p.contents[fpath]; !ok {
+		p.paths = append(p.paths, fpath)
+	}
+	p.contents[fpath] = data
+}
+
+// changed returns the paths whose pending contents differ from the working
+// tree.
+func (p *pendingFiles) changed() ([]string, error) {
+	var ret []string
+	for _, fpath := range p.paths {
+		old, err := os.ReadFile(path.Join(p.repoRoot, fpath))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if !bytes.Equal(old, p.contents[fpath]) {
+			ret = append(ret, fpath)
+		}
+	}
+	return ret, nil
+}
+
+// flush writes all pending files to the working tree.
+func (p *pendingFiles) flush() error {
+	for _, fpath := range p.paths {
+		f := path.Join(p.repoRoot, fpath)
+		if err := os.WriteFile(f, p.contents[fpath], 0644); err != nil {
+			return fmt.Errorf("write %q: %w", f, err)
+		}
+	}
+	return nil
+}
+
+// diff returns a unified diff of the working tree and the pending files.
+func (p *pendingFiles) diff() (string, error) {
+	var sb strings.Builder
+	for _, fpath := range p.paths {
+		old, err := os.ReadFile(path.Join(p.repoRoot, fpath))
+		if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+		diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        splitLines(old),
+			B:        splitLines(p.contents[fpath]),
+			FromFile: "a/" + fpath,
+			ToFile:   "b/" + fpath,
+			Context:  3,
+		})
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(diff)
+	}
+	return sb.String(), nil
+}
+
+// splitLines splits data into lines, keeping the line endings. Unlike
+// difflib.SplitLines, it does not make up an empty line at the end.
+func splitLines(data []byte) []string {
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
@@ -0,0 +1,46 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+package main
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPendingFiles(t *testing.T) {
+	repoRoot := t.TempDir()
+	require.NoError(t, os.WriteFile(path.Join(repoRoot, "README.md"), []byte("one\ntwo\nthree\n"), 0644))
+	require.NoError(t, os.WriteFile(path.Join(repoRoot, "LICENSE"), []byte("MIT\n"), 0644))
+
+	files := newPendingFiles(repoRoot)
+	files.write("README.md", []byte("one\n2\nthree\n"))
+	files.write("LICENSE", []byte("MIT\n"))
+
+	got, err := files.read("README.md")
+	require.NoError(t, err)
+	assert.Equal(t, "one\n2\nthree\n", string(got))
+
+	changed, err := files.changed()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"README.md"}, changed)
+
+	diff, err := files.diff()
+	require.NoError(t, err)
+	assert.Equal(t, `--- a/README.md
++++ b/README.md
+@@ -1,3 +1,3 @@
+ one
+-two
++2
+ three
+`, diff)
+
+	// nothing is written before flush
+	assert.Equal(t, "one\ntwo\nthree\n", readFile(t, path.Join(repoRoot, "README.md")))
+	require.NoError(t, files.flush())
+	assert.Equal(t, "one\n2\nthree\n", readFile(t, path.Join(repoRoot, "README.md")))
+}
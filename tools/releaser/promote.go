@@ -0,0 +1,101 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// promotion is the release candidate a final release was promoted from.
+type promotion struct {
+	From   string `json:"from"`
+	Commit string `json:"commit"`
+	// SHA256 is of the release candidate tarball.
+	SHA256 string `json:"sha256"`
+}
+
+// checkPromotable validates the tags of -promote: rcTag must be a release
+// candidate of tag.
+func checkPromotable(rcTag, tag string) error {
+	m := _tagRegexp.FindStringSubmatch(rcTag)
+	if m == nil {
+		return fmt.Errorf("-promote: %w", _errTag)
+	}
+	if m[5] == "" {
+		return fmt.Errorf("-promote: %s is not a release candidate", rcTag)
+	}
+	if final := strings.TrimSuffix(rcTag, m[5]); final != tag {
+		return fmt.Errorf("-promote: %s can only be promoted to %s, not %s", rcTag, final, tag)
+	}
+	return nil
+}
+
+// checkPromotion checks that the release tarball of ref, with the files in
+// overrides, is the tarball of rcTag with only the MODULE.bazel version
+// changed to tag. hash is the sha256 of the former.
+func checkPromotion(repoRoot, rcTag, tag, hash, ref string, overrides map[string][]byte) (promotion, error) {
+	var ret promotion
+
+	r, err := openRepo(repoRoot)
+	if err != nil {
+		return ret, err
+	}
+	ret.Commit, err = r.commitHash(rcTag)
+	if err != nil {
+		return ret, err
+	}
+	ret.From = rcTag
+
+	rcModule, err := moduleAt(repoRoot, rcTag, rcTag)
+	if err != nil {
+		return ret, err
+	}
+	ret.SHA256, err = makeTgz(io.Discard, repoRoot, rcTag, map[string][]byte{"MODULE.bazel": rcModule})
+	if err != nil {
+		return ret, fmt.Errorf("rebuild %s tarball: %w", rcTag, err)
+	}
+
+	// The release candidate as if it were tagged tag.
+	promotedModule, err := moduleAt(repoRoot, rcTag, tag)
+	if err != nil {
+		return ret, err
+	}
+	var promoted bytes.Buffer
+	promotedHash, err := makeTgz(&promoted, repoRoot, rcTag, map[string][]byte{"MODULE.bazel": promotedModule})
+	if err != nil {
+		return ret, fmt.Errorf("rebuild %s tarball: %w", rcTag, err)
+	}
+	if promotedHash == hash {
+		return ret, nil
+	}
+
+	var final bytes.Buffer
+	if _, err := makeTgz(&final, repoRoot, ref, overrides); err != nil {
+		return ret, fmt.Errorf("make %s tarball: %w", tag, err)
+	}
+	want, err := readTgzEntries(&promoted)
+	if err != nil {
+		return ret, err
+	}
+	got, err := readTgzEntries(&final)
+	if err != nil {
+		return ret, err
+	}
+
+	diffs := diffTgzEntries(want, got, rcTag, tag)
+	if len(diffs) == 0 {
+		// Should not happen: the tarballs are built the same way.
+		return ret, fmt.Errorf("refusing to promote %s: archive entries are identical, but the tarballs differ", rcTag)
+	}
+	return ret, fmt.Errorf(
+		"refusing to promote %s to %s, the release would change since the release candidate, %d difference(s):\n---\n%s\n---\n",
+		rcTag,
+		tag,
+		len(diffs),
+		strings.Join(diffs, "\n"),
+	)
+}
@@ -0,0 +1,107 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+package main
+
+import (
+	"io"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckPromotable(t *testing.T) {
+	assert.NoError(t, checkPromotable("v3.1.0-rc2", "v3.1.0"))
+	assert.ErrorContains(t, checkPromotable("v3.1.0", "v3.1.0"), "v3.1.0 is not a release candidate")
+	assert.ErrorContains(t, checkPromotable("v3.1.0-rc2", "v3.1.1"), "v3.1.0-rc2 can only be promoted to v3.1.0, not v3.1.1")
+	assert.ErrorContains(t, checkPromotable("3.1.0-rc2", "v3.1.0"), "tag accepts the following formats")
+}
+
+// initReleaseRepo creates a git repository with all the files of the
+// release tarball and tags it v1.0.0-rc1.
+func initReleaseRepo(t *testing.T) string {
+	t.Helper()
+	repoRoot := initRepo(t)
+	archive, err := os.ReadFile(path.Join("data", "archive.json"))
+	require.NoError(t, err)
+	commitFiles(t, repoRoot, "add release files", map[string]string{
+		_archiveConfigPath:              string(archive),
+		"LICENSE":                       "MIT",
+		"MODULE.bazel":                  `module(name = "hermetic_cc_toolchain", version = "1.0.0-rc1")` + "\n",
+		"README.md":                     "# hermetic_cc_toolchain\n",
+		"toolchain/defs.bzl":            "# defs\n",
+		"tools/releaser/data/README":    "release README\n",
+		"tools/releaser/data/WORKSPACE": "workspace(name = \"hermetic_cc_toolchain\")\n",
+	})
+	tagRepo(t, repoRoot, "v1.0.0-rc1", "HEAD")
+	return repoRoot
+}
+
+// promote is what run does before checkPromotion.
+func promote(t *testing.T, repoRoot string) (promotion, error) {
+	t.Helper()
+	files := newPendingFiles(repoRoot)
+	require.NoError(t, updateModuleVersion(files, "v1.0.0"))
+	hash, err := makeTgz(io.Discard, repoRoot, "HEAD", files.contents)
+	require.NoError(t, err)
+	return checkPromotion(repoRoot, "v1.0.0-rc1", "v1.0.0", hash, "HEAD", files.contents)
+}
+
+func TestCheckPromotion(t *testing.T) {
+	t.Run("unchanged", func(t *testing.T) {
+		repoRoot := initReleaseRepo(t)
+		got, err := promote(t, repoRoot)
+		require.NoError(t, err)
+
+		r, err := openRepo(repoRoot)
+		require.NoError(t, err)
+		commit, err := r.commitHash("v1.0.0-rc1")
+		require.NoError(t, err)
+		rcModule, err := moduleAt(repoRoot, "v1.0.0-rc1", "v1.0.0-rc1")
+		require.NoError(t, err)
+		rcHash, err := makeTgz(io.Discard, repoRoot, "v1.0.0-rc1", map[string][]byte{"MODULE.bazel": rcModule})
+		require.NoError(t, err)
+		assert.Equal(t, promotion{
+			From:   "v1.0.0-rc1",
+			Commit: strings.TrimSpace(commit),
+			SHA256: rcHash,
+		}, got)
+	})
+
+	t.Run("changes outside of the release", func(t *testing.T) {
+		repoRoot := initReleaseRepo(t)
+		commitFiles(t, repoRoot, "docs: update README", map[string]string{
+			"README.md": "# hermetic_cc_toolchain\n\nMore docs.\n",
+		})
+		_, err := promote(t, repoRoot)
+		assert.NoError(t, err)
+	})
+
+	t.Run("toolchain changed", func(t *testing.T) {
+		repoRoot := initReleaseRepo(t)
+		commitFiles(t, repoRoot, "fix: defs", map[string]string{
+			"toolchain/defs.bzl": "# fixed defs\n",
+			"toolchain/new.bzl":  "# new\n",
+		})
+		_, err := promote(t, repoRoot)
+		assert.ErrorContains(t, err, "refusing to promote v1.0.0-rc1 to v1.0.0")
+		assert.ErrorContains(t, err, "toolchain/defs.bzl: size v1.0.0-rc1 7, v1.0.0 13")
+		assert.ErrorContains(t, err, "toolchain/new.bzl: only in v1.0.0 tarball")
+	})
+
+	t.Run("module changed", func(t *testing.T) {
+		repoRoot := initReleaseRepo(t)
+		commitFiles(t, repoRoot, "feat: add a dependency", map[string]string{
+			"MODULE.bazel": `module(name = "hermetic_cc_toolchain", version = "1.0.0-rc1")
+
+bazel_dep(name = "platforms", version = "0.0.10")
+`,
+		})
+		_, err := promote(t, repoRoot)
+		assert.ErrorContains(t, err, "MODULE.bazel: size")
+	})
+}
@@ -0,0 +1,118 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+const (
+	_inTotoStatementType = "https://in-toto.io/Statement/v1"
+	_slsaPredicateType   = "https://slsa.dev/provenance/v1"
+	_releaserBuildType   = "https://github.com/uber/hermetic_cc_toolchain/tools/releaser@v1"
+)
+
+// provenance is an in-toto statement with a SLSA provenance predicate about
+// the release tarball. It does not have timestamps, so it is as
+// reproducible as the tarball itself.
+type provenance struct {
+	Type          string          `json:"_type"`
+	Subject       []inTotoSubject `json:"subject"`
+	PredicateType string          `json:"predicateType"`
+	Predicate     slsaProvenance  `json:"predicate"`
+}
+
+type inTotoSubject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+type slsaProvenance struct {
+	BuildDefinition struct {
+		BuildType          string             `json:"buildType"`
+		ExternalParameters provenanceParams   `json:"externalParameters"`
+		ResolvedDeps       []inTotoSubjectURI `json:"resolvedDependencies"`
+	} `json:"buildDefinition"`
+	RunDetails struct {
+		Builder struct {
+			ID string `json:"id"`
+		} `json:"builder"`
+	} `json:"runDetails"`
+}
+
+type provenanceParams struct {
+	Tag        string `json:"tag"`
+	ZigVersion string `json:"zigVersion"`
+	// ArchivePaths are the `git archive` paths of makeTgz, from
+	// archive.json.
+	ArchivePaths []string `json:"archivePaths"`
+}
+
+type inTotoSubjectURI struct {
+	URI    string            `json:"uri"`
+	Digest map[string]string `json:"digest"`
+}
+
+// provenancePath returns where the provenance of the tarball is written.
+func provenancePath(tarball string) string {
+	return strings.TrimSuffix(tarball, ".tar.gz") + ".intoto.json"
+}
+
+// newProvenance returns the provenance of the release archives of tag.
+func newProvenance(tag, commit, zigVersion string, archivePaths []string, archives []releaseArchive) provenance {
+	var p provenance
+	p.Type = _inTotoStatementType
+	for _, a := range archives {
+		p.Subject = append(p.Subject, inTotoSubject{
+			Name:   path.Base(a.Path),
+			Digest: map[string]string{"sha256": a.SHA256},
+		})
+	}
+	p.PredicateType = _slsaPredicateType
+
+	def := &p.Predicate.BuildDefinition
+	def.BuildType = _releaserBuildType
+	def.ExternalParameters = provenanceParams{
+		Tag:          tag,
+		ZigVersion:   zigVersion,
+		ArchivePaths: archivePaths,
+	}
+	def.ResolvedDeps = []inTotoSubjectURI{{
+		URI:    fmt.Sprintf("git+https://github.com/%s/%s@refs/tags/%s", _bcrOwner, _bcrModuleName, tag),
+		Digest: map[string]string{"gitCommit": commit},
+	}}
+	p.Predicate.RunDetails.Builder.ID = _releaserBuildType
+
+	return p
+}
+
+func writeProvenance(fpath string, p provenance) error {
+	data, err := json.MarshalIndent(p, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(fpath, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("write %q: %w", fpath, err)
+	}
+	return nil
+}
+
+func readProvenance(fpath string) (provenance, error) {
+	var p provenance
+	data, err := os.ReadFile(fpath)
+	if err != nil {
+		return p, err
+	}
+	if err := json.Unmarshal(data, &p); err != nil {
+		return p, fmt.Errorf("parse %q: %w", fpath, err)
+	}
+	if p.Type != _inTotoStatementType || p.PredicateType != _slsaPredicateType {
+		return p, fmt.Errorf("%q: expected a %s statement with a %s predicate", fpath, _inTotoStatementType, _slsaPredicateType)
+	}
+	return p, nil
+}
@@ -0,0 +1,60 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+package main
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProvenance(t *testing.T) {
+	dir := t.TempDir()
+	tarball := path.Join(dir, "hermetic_cc_toolchain-v4.3.0.tar.gz")
+	provPath := provenancePath(tarball)
+	assert.Equal(t, path.Join(dir, "hermetic_cc_toolchain-v4.3.0.intoto.json"), provPath)
+
+	tgz, err := newReleaseArchive(_tgzFormat, tarball, _testSHA256)
+	require.NoError(t, err)
+	zipArchive, err := newReleaseArchive("zip", archivePath(dir, "v4.3.0", "zip"), _testSHA256)
+	require.NoError(t, err)
+	want := newProvenance("v4.3.0", "0123abcd", "0.15.2", []string{"LICENSE", "toolchain/*"}, []releaseArchive{tgz, zipArchive})
+	require.NoError(t, writeProvenance(provPath, want))
+
+	got, err := readProvenance(provPath)
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+
+	assert.Equal(t, []inTotoSubject{
+		{
+			Name:   "hermetic_cc_toolchain-v4.3.0.tar.gz",
+			Digest: map[string]string{"sha256": _testSHA256},
+		},
+		{
+			Name:   "hermetic_cc_toolchain-v4.3.0.zip",
+			Digest: map[string]string{"sha256": _testSHA256},
+		},
+	}, got.Subject)
+	def := got.Predicate.BuildDefinition
+	assert.Equal(t, provenanceParams{
+		Tag:          "v4.3.0",
+		ZigVersion:   "0.15.2",
+		ArchivePaths: []string{"LICENSE", "toolchain/*"},
+	}, def.ExternalParameters)
+	assert.Equal(t, []inTotoSubjectURI{{
+		URI:    "git+https://github.com/uber/hermetic_cc_toolchain@refs/tags/v4.3.0",
+		Digest: map[string]string{"gitCommit": "0123abcd"},
+	}}, def.ResolvedDeps)
+}
+
+func TestReadProvenanceWrongType(t *testing.T) {
+	fpath := path.Join(t.TempDir(), "prov.json")
+	require.NoError(t, os.WriteFile(fpath, []byte(`{"_type": "https://in-toto.io/Statement/v0.1"}`), 0644))
+
+	_, err := readProvenance(fpath)
+	assert.ErrorContains(t, err, "expected a https://in-toto.io/Statement/v1 statement")
+}
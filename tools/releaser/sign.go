@@ -0,0 +1,135 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+)
+
+// _signNamespace separates release signatures from other uses of the same
+// ssh key, see ssh-keygen(1).
+const _signNamespace = "hermetic_cc_toolchain"
+
+// signFile writes a detached signature of fpath to fpath.sig, using the
+// ssh private key at keyPath.
+func signFile(keyPath, fpath string) (string, error) {
+	sigPath := fpath + ".sig"
+	// ssh-keygen refuses to overwrite signatures.
+	if err := os.Remove(sigPath); err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	if _, err := sshKeygen(nil, "-Y", "sign", "-f", keyPath, "-n", _signNamespace, fpath); err != nil {
+		return "", fmt.Errorf("sign %q: %w", fpath, err)
+	}
+	return sigPath, nil
+}
+
+// verifyFile verifies the detached signature fpath.sig of fpath. If
+// identity is empty, it is looked up in allowedSigners.
+func verifyFile(allowedSigners, identity, fpath string) (string, error) {
+	sigPath := fpath + ".sig"
+	if identity == "" {
+		out, err := sshKeygen(nil, "-Y", "find-principals", "-f", allowedSigners, "-s", sigPath)
+		if err != nil {
+			return "", fmt.Errorf("%q is not signed by any of %q: %w", fpath, allowedSigners, err)
+		}
+		identity, _, _ = strings.Cut(strings.TrimSpace(out), "\n")
+	}
+
+	data, err := os.ReadFile(fpath)
+	if err != nil {
+		return "", err
+	}
+	if _, err := sshKeygen(data,
+		"-Y", "verify",
+		"-f", allowedSigners,
+		"-I", identity,
+		"-n", _signNamespace,
+		"-s", sigPath,
+	); err != nil {
+		return "", fmt.Errorf("verify %q: %w", fpath, err)
+	}
+	return identity, nil
+}
+
+// verifyReleaseSignature checks, without network access or the repository,
+// the signatures of the tarball and its provenance in dir, and that the
+// provenance is about that tarball. The archives of the other formats in
+// the provenance are checked the same way if they are in dir.
+func verifyReleaseSignature(dir, tag, allowedSigners, identity string) error {
+	tarball := archivePath(dir, tag, _tgzFormat)
+	provPath := provenancePath(tarball)
+
+	for _, fpath := range []string{tarball, provPath} {
+		signer, err := verifyFile(allowedSigners, identity, fpath)
+		if err != nil {
+			return err
+		}
+		log("%s: good signature by %s", fpath, signer)
+	}
+
+	prov, err := readProvenance(provPath)
+	if err != nil {
+		return err
+	}
+	if got := prov.Predicate.BuildDefinition.ExternalParameters.Tag; got != tag {
+		return fmt.Errorf("%q is the provenance of %s, not %s", provPath, got, tag)
+	}
+
+	var hasTarball bool
+	for _, s := range prov.Subject {
+		fpath := path.Join(dir, s.Name)
+		if fpath == tarball {
+			hasTarball = true
+		} else {
+			if _, err := os.Stat(fpath); os.IsNotExist(err) {
+				continue
+			}
+			signer, err := verifyFile(allowedSigners, identity, fpath)
+			if err != nil {
+				return err
+			}
+			log("%s: good signature by %s", fpath, signer)
+		}
+
+		data, err := os.ReadFile(fpath)
+		if err != nil {
+			return err
+		}
+		shasum := fmt.Sprintf("%x", sha256.Sum256(data))
+		if s.Digest["sha256"] != shasum {
+			return fmt.Errorf("%q: sha256 %s is not a subject of %q", fpath, shasum, provPath)
+		}
+		log("%s: sha256 %s matches the provenance", fpath, shasum)
+	}
+	if !hasTarball {
+		return fmt.Errorf("%q is not a subject of %q", tarball, provPath)
+	}
+	return nil
+}
+
+func sshKeygen(stdin []byte, args ...string) (string, error) {
+	cmd := exec.Command("ssh-keygen", args...)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf(
+			"ssh-keygen %s: %v\n---\n%s\n---\n",
+			strings.Join(args, " "),
+			err,
+			stderr.String(),
+		)
+	}
+	return stdout.String(), nil
+}
@@ -0,0 +1,123 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeSigningKey creates an ssh key and an allowed_signers file that
+// trusts it for identity.
+func writeSigningKey(t *testing.T, dir, identity string) (key, allowedSigners string) {
+	t.Helper()
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen is not available")
+	}
+
+	key = path.Join(dir, identity)
+	_, err := sshKeygen(nil, "-q", "-t", "ed25519", "-N", "", "-C", identity, "-f", key)
+	require.NoError(t, err)
+
+	pub, err := os.ReadFile(key + ".pub")
+	require.NoError(t, err)
+	allowedSigners = path.Join(dir, identity+".allowed_signers")
+	require.NoError(t, os.WriteFile(allowedSigners, []byte(fmt.Sprintf(`%s namespaces="%s" %s`, identity, _signNamespace, pub)), 0644))
+	return key, allowedSigners
+}
+
+// writeSignedRelease writes a signed tarball, zip and provenance of tag to
+// dir.
+func writeSignedRelease(t *testing.T, dir, key, tag string) string {
+	t.Helper()
+	var archives []releaseArchive
+	for _, format := range []string{_tgzFormat, "zip"} {
+		fpath := archivePath(dir, tag, format)
+		require.NoError(t, os.WriteFile(fpath, []byte("MIT "+format), 0644))
+		archive, err := newReleaseArchive(format, fpath, fmt.Sprintf("%x", sha256.Sum256([]byte("MIT "+format))))
+		require.NoError(t, err)
+		archives = append(archives, archive)
+	}
+	tarball := archives[0].Path
+	prov := newProvenance(tag, "0123abcd", "0.15.2", []string{"LICENSE"}, archives)
+	require.NoError(t, writeProvenance(provenancePath(tarball), prov))
+
+	for _, f := range []string{tarball, archives[1].Path, provenancePath(tarball)} {
+		sigPath, err := signFile(key, f)
+		require.NoError(t, err)
+		assert.Equal(t, f+".sig", sigPath)
+	}
+	return tarball
+}
+
+func TestVerifyReleaseSignature(t *testing.T) {
+	keys := t.TempDir()
+	key, allowedSigners := writeSigningKey(t, keys, "releaser@example.com")
+	_, otherSigners := writeSigningKey(t, keys, "other@example.com")
+
+	t.Run("good", func(t *testing.T) {
+		dir := t.TempDir()
+		writeSignedRelease(t, dir, key, "v4.3.0")
+		assert.NoError(t, verifyReleaseSignature(dir, "v4.3.0", allowedSigners, ""))
+		assert.NoError(t, verifyReleaseSignature(dir, "v4.3.0", allowedSigners, "releaser@example.com"))
+	})
+
+	t.Run("resigned", func(t *testing.T) {
+		dir := t.TempDir()
+		writeSignedRelease(t, dir, key, "v4.3.0")
+		writeSignedRelease(t, dir, key, "v4.3.0")
+		assert.NoError(t, verifyReleaseSignature(dir, "v4.3.0", allowedSigners, ""))
+	})
+
+	t.Run("untrusted signer", func(t *testing.T) {
+		dir := t.TempDir()
+		writeSignedRelease(t, dir, key, "v4.3.0")
+		err := verifyReleaseSignature(dir, "v4.3.0", otherSigners, "")
+		assert.ErrorContains(t, err, "is not signed by any of")
+		err = verifyReleaseSignature(dir, "v4.3.0", allowedSigners, "other@example.com")
+		assert.ErrorContains(t, err, "verify")
+	})
+
+	t.Run("tampered tarball", func(t *testing.T) {
+		dir := t.TempDir()
+		tarball := writeSignedRelease(t, dir, key, "v4.3.0")
+		require.NoError(t, os.WriteFile(tarball, []byte("GPL"), 0644))
+		err := verifyReleaseSignature(dir, "v4.3.0", allowedSigners, "")
+		assert.ErrorContains(t, err, "verify")
+	})
+
+	t.Run("tampered zip", func(t *testing.T) {
+		dir := t.TempDir()
+		writeSignedRelease(t, dir, key, "v4.3.0")
+		require.NoError(t, os.WriteFile(archivePath(dir, "v4.3.0", "zip"), []byte("GPL"), 0644))
+		err := verifyReleaseSignature(dir, "v4.3.0", allowedSigners, "")
+		assert.ErrorContains(t, err, "verify")
+	})
+
+	t.Run("only the tarball", func(t *testing.T) {
+		dir := t.TempDir()
+		writeSignedRelease(t, dir, key, "v4.3.0")
+		require.NoError(t, os.Remove(archivePath(dir, "v4.3.0", "zip")))
+		assert.NoError(t, verifyReleaseSignature(dir, "v4.3.0", allowedSigners, ""))
+	})
+
+	t.Run("provenance of another tag", func(t *testing.T) {
+		dir := t.TempDir()
+		tarball := writeSignedRelease(t, dir, key, "v4.3.0")
+		other := path.Join(dir, "hermetic_cc_toolchain-v4.4.0.tar.gz")
+		require.NoError(t, os.Rename(tarball, other))
+		require.NoError(t, os.Rename(tarball+".sig", other+".sig"))
+		require.NoError(t, os.Rename(provenancePath(tarball), provenancePath(other)))
+		require.NoError(t, os.Rename(provenancePath(tarball)+".sig", provenancePath(other)+".sig"))
+		err := verifyReleaseSignature(dir, "v4.4.0", allowedSigners, "")
+		assert.ErrorContains(t, err, "is the provenance of v4.3.0, not v4.4.0")
+	})
+}
@@ -0,0 +1,165 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// tarEntry is everything about a single tarball entry that affects the hash
+// of the release tarball.
+type tarEntry struct {
+	name   string
+	mode   int64
+	size   int64
+	sha256 string
+	format tar.Format
+}
+
+// verifyRelease rebuilds the release tarball of tag and compares it, entry by
+// entry, with the already-published tarball at publishedPath.
+func verifyRelease(repoRoot, tag, publishedPath string) error {
+	module, err := moduleAt(repoRoot, tag, tag)
+	if err != nil {
+		return err
+	}
+
+	var rebuilt bytes.Buffer
+	rebuiltHash, err := makeTgz(&rebuilt, repoRoot, tag, map[string][]byte{"MODULE.bazel": module})
+	if err != nil {
+		return fmt.Errorf("rebuild release tarball: %w", err)
+	}
+
+	published, err := os.ReadFile(publishedPath)
+	if err != nil {
+		return err
+	}
+	publishedHash := fmt.Sprintf("%x", sha256.Sum256(published))
+
+	want, err := readTgzEntries(bytes.NewReader(published))
+	if err != nil {
+		return fmt.Errorf("read %q: %w", publishedPath, err)
+	}
+	got, err := readTgzEntries(&rebuilt)
+	if err != nil {
+		return fmt.Errorf("read rebuilt tarball: %w", err)
+	}
+
+	log("published sha256: %s", publishedHash)
+	log("rebuilt sha256:   %s", rebuiltHash)
+
+	diffs := diffTgzEntries(want, got, "published", "rebuilt")
+	if len(diffs) == 0 {
+		if publishedHash == rebuiltHash {
+			log("%s is reproducible", tag)
+			return nil
+		}
+		// All entries are the same, so what differs is the tar
+		// padding or the gzip stream (e.g. compression level).
+		return fmt.Errorf("%s: archive entries are identical, but the tar or gzip encoding differs", tag)
+	}
+
+	return fmt.Errorf(
+		"%s is not reproducible, %d difference(s):\n---\n%s\n---\n",
+		tag,
+		len(diffs),
+		strings.Join(diffs, "\n"),
+	)
+}
+
+// readTgzEntries reads all entries of a gzipped tarball.
+func readTgzEntries(r io.Reader) ([]tarEntry, error) {
+	gzr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gzr.Close()
+
+	var ret []tarEntry
+	tr := tar.NewReader(gzr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		hashw := sha256.New()
+		if _, err := io.Copy(hashw, tr); err != nil {
+			return nil, fmt.Errorf("read %q: %w", hdr.Name, err)
+		}
+
+		ret = append(ret, tarEntry{
+			name:   hdr.Name,
+			mode:   hdr.Mode,
+			size:   hdr.Size,
+			sha256: fmt.Sprintf("%x", hashw.Sum(nil)),
+			format: hdr.Format,
+		})
+	}
+
+	return ret, nil
+}
+
+// diffTgzEntries returns a human-readable line for every difference between
+// the want and the got entries, e.g. the published and the rebuilt ones.
+func diffTgzEntries(want, got []tarEntry, wantLabel, gotLabel string) []string {
+	gotByName := make(map[string]tarEntry, len(got))
+	for _, e := range got {
+		gotByName[e.name] = e
+	}
+	wantByName := make(map[string]tarEntry, len(want))
+	for _, e := range want {
+		wantByName[e.name] = e
+	}
+
+	var diffs []string
+	for _, w := range want {
+		g, ok := gotByName[w.name]
+		if !ok {
+			diffs = append(diffs, fmt.Sprintf("%s: only in %s tarball", w.name, wantLabel))
+			continue
+		}
+		if w.mode != g.mode {
+			diffs = append(diffs, fmt.Sprintf("%s: mode %s %o, %s %o", w.name, wantLabel, w.mode, gotLabel, g.mode))
+		}
+		if w.size != g.size {
+			diffs = append(diffs, fmt.Sprintf("%s: size %s %d, %s %d", w.name, wantLabel, w.size, gotLabel, g.size))
+		}
+		if w.sha256 != g.sha256 {
+			diffs = append(diffs, fmt.Sprintf("%s: sha256 %s %s, %s %s", w.name, wantLabel, w.sha256, gotLabel, g.sha256))
+		}
+		if w.format != g.format {
+			diffs = append(diffs, fmt.Sprintf("%s: header format %s %s, %s %s", w.name, wantLabel, w.format, gotLabel, g.format))
+		}
+	}
+	for _, g := range got {
+		if _, ok := wantByName[g.name]; !ok {
+			diffs = append(diffs, fmt.Sprintf("%s: only in %s tarball", g.name, gotLabel))
+		}
+	}
+
+	if len(diffs) > 0 || len(want) != len(got) {
+		return diffs
+	}
+	for i := range want {
+		if want[i].name != got[i].name {
+			diffs = append(diffs, fmt.Sprintf(
+				"entry #%d: %s %s, %s %s (entries are ordered differently)",
+				i, wantLabel, want[i].name, gotLabel, got[i].name,
+			))
+			break
+		}
+	}
+	return diffs
+}
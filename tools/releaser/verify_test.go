@@ -0,0 +1,115 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadTgzEntries(t *testing.T) {
+	var buf bytes.Buffer
+	gzw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gzw)
+	for _, f := range []struct {
+		name, body string
+		mode       int64
+	}{
+		{"LICENSE", "MIT", 0664},
+		{"toolchain/", "", 0775},
+	} {
+		require.NoError(t, tw.WriteHeader(&tar.Header{
+			Name:    f.name,
+			Mode:    f.mode,
+			Size:    int64(len(f.body)),
+			ModTime: time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC),
+			Format:  tar.FormatGNU,
+		}))
+		_, err := tw.Write([]byte(f.body))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gzw.Close())
+
+	got, err := readTgzEntries(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, []tarEntry{
+		{
+			name:   "LICENSE",
+			mode:   0664,
+			size:   3,
+			sha256: "e5dcffe836b6ec8a58e492419b550e65fb8cbdc308503979e5dacb33ac7ea3b7",
+			format: tar.FormatGNU,
+		},
+		{
+			name:   "toolchain/",
+			mode:   0775,
+			sha256: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+			format: tar.FormatGNU,
+		},
+	}, got)
+}
+
+func TestDiffTgzEntries(t *testing.T) {
+	license := tarEntry{name: "LICENSE", mode: 0664, size: 3, sha256: "aa", format: tar.FormatGNU}
+	readme := tarEntry{name: "README", mode: 0664, size: 5, sha256: "bb", format: tar.FormatGNU}
+
+	changed := readme
+	changed.mode = 0775
+	changed.size = 6
+	changed.sha256 = "cc"
+	changed.format = tar.FormatPAX
+
+	tests := []struct {
+		name string
+		want []tarEntry
+		got  []tarEntry
+		diff []string
+	}{
+		{
+			name: "identical",
+			want: []tarEntry{license, readme},
+			got:  []tarEntry{license, readme},
+		},
+		{
+			name: "file drifted",
+			want: []tarEntry{license, readme},
+			got:  []tarEntry{license, changed},
+			diff: []string{
+				"README: mode published 664, rebuilt 775",
+				"README: size published 5, rebuilt 6",
+				"README: sha256 published bb, rebuilt cc",
+				"README: header format published GNU, rebuilt PAX",
+			},
+		},
+		{
+			name: "added and removed",
+			want: []tarEntry{license},
+			got:  []tarEntry{readme},
+			diff: []string{
+				"LICENSE: only in published tarball",
+				"README: only in rebuilt tarball",
+			},
+		},
+		{
+			name: "reordered",
+			want: []tarEntry{license, readme},
+			got:  []tarEntry{readme, license},
+			diff: []string{
+				"entry #0: published LICENSE, rebuilt README (entries are ordered differently)",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.diff, diffTgzEntries(tt.want, tt.got, "published", "rebuilt"))
+		})
+	}
+}
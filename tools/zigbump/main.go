@@ -0,0 +1,188 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+// zigbump updates the Zig SDK version of hermetic_cc_toolchain and the
+// sha256 of every host platform archive.
+package main
+
+import (
+	"crypto/sha256"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+
+	"github.com/uber/hermetic_cc_toolchain/tools/internal/bzlconfig"
+	"github.com/uber/hermetic_cc_toolchain/tools/internal/zigsdk"
+)
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func log(msg string, format ...any) {
+	fmt.Fprintf(flag.CommandLine.Output(), msg+"\n", format...)
+}
+
+func run() error {
+	var (
+		repoRoot     string
+		version      string
+		archivesPath string
+		urlFormat    string
+	)
+
+	flag.StringVar(&repoRoot, "repoRoot", os.Getenv("BUILD_WORKSPACE_DIRECTORY"), "root directory of hermetic_cc_toolchain repo")
+	flag.StringVar(&version, "version", "", "new Zig SDK version, e.g. 0.16.0")
+	flag.StringVar(&archivesPath, "archives", "", "read the archives from this directory instead of downloading them")
+	flag.StringVar(&urlFormat, "urlFormat", "", "download the archives from this URL format instead of the one in zig_sdk.bzl, e.g. https://example.com/zig-{zig_platform}-{version}.{_ext}")
+
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), `usage: bazel run //tools/zigbump -- -version <version>
+
+Sets VERSION in toolchain/private/zig_sdk.bzl and recomputes
+HOST_PLATFORM_SHA256 from the Zig SDK archive of every host platform.
+
+`)
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if version == "" {
+		return errors.New("version is required")
+	}
+
+	zigSDKPath := path.Join(repoRoot, zigsdk.ZigSDKPath)
+	platforms, err := zigsdk.ParseHostPlatforms(zigSDKPath, path.Join(repoRoot, zigsdk.DefsPath))
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(zigSDKPath)
+	if err != nil {
+		return err
+	}
+
+	// Bump the version first: it decides between the release and
+	// the nightly URL format.
+	bumped, err := bumpZigSDK(zigSDKPath, data, version, nil)
+	if err != nil {
+		return err
+	}
+	upstream, err := zigsdk.ParseUpstreamData(zigSDKPath, bumped)
+	if err != nil {
+		return err
+	}
+
+	formats := upstream.URLFormats()
+	if urlFormat != "" {
+		formats = []string{urlFormat}
+	}
+
+	sha256s := make(map[string]string, len(platforms.SHA256))
+	for _, platform := range platforms.Names() {
+		var (
+			shasum string
+			err    error
+		)
+		if archivesPath != "" {
+			fname := path.Join(archivesPath, path.Base(zigsdk.URL(formats[0], version, platform, platforms.Ext[platform])))
+			log("hashing %q", fname)
+			shasum, err = hashFile(fname)
+		} else {
+			shasum, err = fetchSHA256(http.DefaultClient, formats, version, platform, platforms.Ext[platform])
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", platform, err)
+		}
+		sha256s[platform] = shasum
+	}
+
+	bumped, err = bumpZigSDK(zigSDKPath, data, version, sha256s)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(zigSDKPath, bumped, 0644); err != nil {
+		return fmt.Errorf("write %q: %w", zigSDKPath, err)
+	}
+
+	log("updated %s to zig %s", zigsdk.ZigSDKPath, version)
+	return nil
+}
+
+// bumpZigSDK sets VERSION and the values of HOST_PLATFORM_SHA256 in the
+// contents of zig_sdk.bzl. Comments and formatting are kept. sha256s must
+// have exactly the host platforms of HOST_PLATFORM_SHA256; if it is nil,
+// only VERSION is set.
+func bumpZigSDK(fpath string, data []byte, version string, sha256s map[string]string) ([]byte, error) {
+	f, err := bzlconfig.Parse(fpath, data)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := f.SetString("VERSION", version); err != nil {
+		return nil, err
+	}
+	if sha256s != nil {
+		if err := f.SetStringDictValues(zigsdk.HostSHA256Var, sha256s); err != nil {
+			return nil, err
+		}
+	}
+
+	return f.Format(), nil
+}
+
+// fetchSHA256 downloads the archive of platform from the first URL format
+// that has it and returns its sha256.
+func fetchSHA256(client *http.Client, formats []string, version, platform, ext string) (string, error) {
+	var errs []error
+	for _, format := range formats {
+		url := zigsdk.URL(format, version, platform, ext)
+		log("downloading %q", url)
+
+		shasum, err := hashURL(client, url)
+		if err == nil {
+			return shasum, nil
+		}
+		log("ignoring %q: %s", url, err)
+		errs = append(errs, fmt.Errorf("%s: %w", url, err))
+	}
+	return "", errors.Join(errs...)
+}
+
+func hashURL(client *http.Client, url string) (string, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("got non-200: %s", resp.Status)
+	}
+	return hashReader(resp.Body)
+}
+
+func hashFile(fpath string) (string, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return hashReader(f)
+}
+
+func hashReader(r io.Reader) (string, error) {
+	hashw := sha256.New()
+	if _, err := io.Copy(hashw, r); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", hashw.Sum(nil)), nil
+}
@@ -0,0 +1,106 @@
+// Copyright 2023 Uber Technologies, Inc.
+// Licensed under the MIT License
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sha256 of "MIT"
+const _mitSHA256 = "e5dcffe836b6ec8a58e492419b550e65fb8cbdc308503979e5dacb33ac7ea3b7"
+
+const _zigSDK = `VERSION = "0.15.2"
+
+HOST_PLATFORM_SHA256 = {
+    "linux-x86_64": "aa",
+    # comments are kept
+    "macos-aarch64": "bb",
+}
+
+# Official recommended version.
+URL_FORMAT_RELEASE = "https://ziglang.org/download/{version}/zig-{zig_platform}-{version}.{_ext}"
+
+URL_FORMAT_NIGHTLY = "https://ziglang.org/builds/zig-{zig_platform}-{version}.{_ext}"
+`
+
+func TestBumpZigSDK(t *testing.T) {
+	got, err := bumpZigSDK("zig_sdk.bzl", []byte(_zigSDK), "0.16.0", map[string]string{
+		"linux-x86_64":  "cc",
+		"macos-aarch64": "dd",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, `VERSION = "0.16.0"
+
+HOST_PLATFORM_SHA256 = {
+    "linux-x86_64": "cc",
+    # comments are kept
+    "macos-aarch64": "dd",
+}
+
+# Official recommended version.
+URL_FORMAT_RELEASE = "https://ziglang.org/download/{version}/zig-{zig_platform}-{version}.{_ext}"
+
+URL_FORMAT_NIGHTLY = "https://ziglang.org/builds/zig-{zig_platform}-{version}.{_ext}"
+`, string(got))
+}
+
+func TestBumpZigSDKVersionOnly(t *testing.T) {
+	got, err := bumpZigSDK("zig_sdk.bzl", []byte(_zigSDK), "0.15.2", nil)
+	require.NoError(t, err)
+	assert.Equal(t, _zigSDK, string(got))
+}
+
+func TestBumpZigSDKPlatformMismatch(t *testing.T) {
+	_, err := bumpZigSDK("zig_sdk.bzl", []byte(_zigSDK), "0.16.0", map[string]string{
+		"linux-x86_64": "cc",
+	})
+	assert.ErrorContains(t, err, `HOST_PLATFORM_SHA256: no new value for ["macos-aarch64"]`)
+
+	_, err = bumpZigSDK("zig_sdk.bzl", []byte(_zigSDK), "0.16.0", map[string]string{
+		"linux-x86_64":    "cc",
+		"macos-aarch64":   "dd",
+		"windows-aarch64": "ee",
+	})
+	assert.ErrorContains(t, err, `HOST_PLATFORM_SHA256: ["windows-aarch64"] are not in the dict`)
+}
+
+func TestFetchSHA256(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/upstream/zig-x86_64-linux-0.16.0.tar.xz" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte("MIT"))
+	}))
+	defer srv.Close()
+
+	formats := []string{
+		srv.URL + "/mirror/zig-{zig_platform}-{version}.{_ext}",
+		srv.URL + "/upstream/zig-{zig_platform}-{version}.{_ext}",
+	}
+
+	got, err := fetchSHA256(srv.Client(), formats, "0.16.0", "linux-x86_64", "tar.xz")
+	require.NoError(t, err)
+	assert.Equal(t, _mitSHA256, got)
+
+	_, err = fetchSHA256(srv.Client(), formats, "0.16.0", "macos-aarch64", "tar.xz")
+	assert.ErrorContains(t, err, "/mirror/zig-aarch64-macos-0.16.0.tar.xz: got non-200")
+	assert.ErrorContains(t, err, "/upstream/zig-aarch64-macos-0.16.0.tar.xz: got non-200")
+}
+
+func TestHashFile(t *testing.T) {
+	fname := path.Join(t.TempDir(), "zig-x86_64-linux-0.16.0.tar.xz")
+	require.NoError(t, os.WriteFile(fname, []byte("MIT"), 0644))
+
+	got, err := hashFile(fname)
+	require.NoError(t, err)
+	assert.Equal(t, _mitSHA256, got)
+}